@@ -0,0 +1,41 @@
+// Command hiveclaw is the HiveClaw command-line interface
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var version = "dev"
+
+func main() {
+	root := &cobra.Command{
+		Use:           "hiveclaw",
+		Short:         "HiveClaw AI assistant gateway",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	root.PersistentFlags().StringVar(&configPath, "config", "", "config file (default ~/.hiveclaw/config.json)")
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "version",
+			Short: "Print version",
+			Run: func(cmd *cobra.Command, args []string) {
+				fmt.Println("hiveclaw", version)
+			},
+		},
+		onboardCommand(),
+		startCommand(),
+		statusCommand(),
+		exportCommand(),
+		importCommand(),
+	)
+
+	if err := root.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/spf13/cobra"
+)
+
+var configPath string
+
+// gatewayClient talks to the REST API of a running gateway
+type gatewayClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+// newGatewayClient builds a client from the flags, falling back to the
+// config file and HIVECLAW_TOKEN
+func newGatewayClient(addr, token string) (*gatewayClient, error) {
+	if addr == "" || token == "" {
+		config, err := configs.Load(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("load config: %w", err)
+		}
+		if addr == "" {
+			host := config.Gateway.Host
+			if host == "" || host == "0.0.0.0" {
+				host = "localhost"
+			}
+			scheme := "http"
+			if config.Gateway.TLS {
+				scheme = "https"
+			}
+			addr = fmt.Sprintf("%s://%s:%d", scheme, host, config.Gateway.Port)
+		}
+		if token == "" {
+			token = os.Getenv("HIVECLAW_TOKEN")
+		}
+		if token == "" {
+			token = config.Gateway.Token
+		}
+	}
+
+	return &gatewayClient{
+		base:  strings.TrimRight(addr, "/"),
+		token: token,
+		http:  &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// do sends a request and returns the response body, turning gateway errors
+// into Go errors
+func (c *gatewayClient) do(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return nil, fmt.Errorf("gateway: %s", apiErr.Error.Message)
+		}
+		return nil, fmt.Errorf("gateway: %s", resp.Status)
+	}
+	return data, nil
+}
+
+func exportCommand() *cobra.Command {
+	var addr, token, format, output string
+
+	cmd := &cobra.Command{
+		Use:   "export <session-id>",
+		Short: "Export a session as markdown, json, openai or anthropic",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newGatewayClient(addr, token)
+			if err != nil {
+				return err
+			}
+
+			path := fmt.Sprintf("/api/sessions/%s/export?format=%s", url.PathEscape(args[0]), url.QueryEscape(format))
+			data, err := client.do(http.MethodGet, path, "", nil)
+			if err != nil {
+				return err
+			}
+
+			if output == "" || output == "-" {
+				_, err = cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %s to %s\n", args[0], output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "gateway", "", "gateway URL (default from config)")
+	cmd.Flags().StringVar(&token, "token", "", "gateway token (default $HIVECLAW_TOKEN or config)")
+	cmd.Flags().StringVarP(&format, "format", "f", "markdown", "export format: markdown, json, openai, anthropic")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file (default stdout)")
+	return cmd
+}
+
+func importCommand() *cobra.Command {
+	var addr, token string
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Recreate a session from a json export (- reads stdin)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newGatewayClient(addr, token)
+			if err != nil {
+				return err
+			}
+
+			var in io.Reader = cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+
+			data, err := client.do(http.MethodPost, "/api/sessions/import", "application/json", in)
+			if err != nil {
+				return err
+			}
+
+			var sess struct {
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				Messages int    `json:"messageCount"`
+			}
+			if err := json.Unmarshal(data, &sess); err != nil {
+				return fmt.Errorf("unexpected gateway response: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Imported %q as %s (%d messages)\n", sess.Name, sess.ID, sess.Messages)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "gateway", "", "gateway URL (default from config)")
+	cmd.Flags().StringVar(&token, "token", "", "gateway token (default $HIVECLAW_TOKEN or config)")
+	return cmd
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/spf13/cobra"
+)
+
+func onboardCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "onboard",
+		Short: "Interactive setup wizard",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := configs.Load(configPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				config, err = configs.DefaultConfig(), nil
+			}
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+			if err := onboard(config, cmd.InOrStdin(), cmd.OutOrStdout()); err != nil {
+				return err
+			}
+			if err := config.Save(configPath); err != nil {
+				return err
+			}
+
+			path := configPath
+			if path == "" {
+				path = configs.GetConfigPath()
+			}
+			out := cmd.OutOrStdout()
+			fmt.Fprintln(out, "\n✅ Setup Complete!")
+			fmt.Fprintf(out, "   Config saved to %s\n", path)
+			fmt.Fprintf(out, "   Gateway token: %s\n", config.Gateway.Token)
+			fmt.Fprintln(out, "\nRun `hiveclaw start` to launch.")
+			return nil
+		},
+	}
+}
+
+// onboard walks through the setup questions and applies the answers to
+// config. Empty answers keep the current values.
+func onboard(config *configs.Config, in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	ask := func(prompt, current string) (string, error) {
+		if current != "" {
+			fmt.Fprintf(out, "%s [%s]: ", prompt, current)
+		} else {
+			fmt.Fprintf(out, "%s: ", prompt)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+		return current, nil
+	}
+
+	fmt.Fprintln(out, "🐝 Welcome to HiveClaw!")
+	fmt.Fprintln(out, "\nStep 1: LLM Provider")
+	fmt.Fprintln(out, "━━━━━━━━━━━━━━━━━━━━")
+	fmt.Fprintln(out, "  1. Anthropic (Claude) - recommended")
+	fmt.Fprintln(out, "  2. OpenRouter (multi-model)")
+	choice := "1"
+	if config.LLM.Provider == "openrouter" {
+		choice = "2"
+	}
+	choice, err := ask("Choice", choice)
+	if err != nil {
+		return err
+	}
+	switch choice {
+	case "1":
+		if config.LLM.Provider == "openrouter" {
+			config.LLM.Model = configs.DefaultConfig().LLM.Model
+		}
+		config.LLM.Provider = "anthropic"
+	case "2":
+		if config.LLM.Provider != "openrouter" {
+			config.LLM.Model = "anthropic/claude-sonnet-4"
+		}
+		config.LLM.Provider = "openrouter"
+	default:
+		return fmt.Errorf("unknown provider choice %q", choice)
+	}
+	key, err := ask("API key (empty to use the environment)", "")
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		config.LLM.APIKey = key
+	}
+
+	fmt.Fprintln(out, "\nStep 2: Gateway Port")
+	port, err := ask("Port", strconv.Itoa(config.Gateway.Port))
+	if err != nil {
+		return err
+	}
+	if config.Gateway.Port, err = strconv.Atoi(port); err != nil || config.Gateway.Port <= 0 {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	if config.Gateway.Token == "" {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			return err
+		}
+		config.Gateway.Token = hex.EncodeToString(token)
+	}
+
+	fmt.Fprintln(out, "\nStep 3: Telegram Bot Token (optional)")
+	if config.Channels.Telegram.Token, err = ask("Token", config.Channels.Telegram.Token); err != nil {
+		return err
+	}
+	config.Channels.Telegram.Enabled = config.Channels.Telegram.Token != ""
+
+	fmt.Fprintln(out, "\nStep 4: Discord Bot Token (optional)")
+	if config.Channels.Discord.Token, err = ask("Token", config.Channels.Discord.Token); err != nil {
+		return err
+	}
+	config.Channels.Discord.Enabled = config.Channels.Discord.Token != ""
+	return nil
+}
+
+func statusCommand() *cobra.Command {
+	var addr string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Check that the gateway is running",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newGatewayClient(addr, "")
+			if err != nil {
+				return err
+			}
+			data, err := client.do(http.MethodGet, "/api/health", "", nil)
+			if err != nil {
+				return fmt.Errorf("gateway at %s is not reachable: %w", client.base, err)
+			}
+
+			var health struct {
+				Status    string `json:"status"`
+				Version   string `json:"version"`
+				Retention struct {
+					Sessions int `json:"sessions"`
+				} `json:"retention"`
+			}
+			if err := json.Unmarshal(data, &health); err != nil {
+				return fmt.Errorf("unexpected gateway response: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✅ Gateway at %s is %s (version %s, %d sessions)\n",
+				client.base, health.Status, health.Version, health.Retention.Sessions)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "gateway", "", "gateway URL (default from config)")
+	return cmd
+}
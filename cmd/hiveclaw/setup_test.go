@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+func TestOnboard(t *testing.T) {
+	config := configs.DefaultConfig()
+	answers := "2\nsk-or-1\n9090\n\n123:abc\n"
+	if err := onboard(config, strings.NewReader(answers), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	if config.LLM.Provider != "openrouter" || config.LLM.Model != "anthropic/claude-sonnet-4" || config.LLM.APIKey != "sk-or-1" {
+		t.Errorf("llm %+v", config.LLM)
+	}
+	if config.Gateway.Port != 9090 || len(config.Gateway.Token) != 32 {
+		t.Errorf("gateway %+v", config.Gateway)
+	}
+	if config.Channels.Telegram.Enabled || !config.Channels.Discord.Enabled || config.Channels.Discord.Token != "123:abc" {
+		t.Errorf("channels %+v", config.Channels)
+	}
+
+	// Running it again with empty answers keeps everything
+	token := config.Gateway.Token
+	if err := onboard(config, strings.NewReader(""), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if config.LLM.Provider != "openrouter" || config.Gateway.Port != 9090 || config.Gateway.Token != token || !config.Channels.Discord.Enabled {
+		t.Errorf("rerun changed the config: %+v", config)
+	}
+
+	if err := onboard(config, strings.NewReader("3\n"), io.Discard); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
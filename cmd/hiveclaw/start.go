@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/channels/discord"
+	"github.com/nanilabs/hiveclaw/internal/channels/telegram"
+	"github.com/nanilabs/hiveclaw/internal/gateway"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/voice"
+	"github.com/spf13/cobra"
+)
+
+// bot is a channel transport started alongside the gateway
+type bot interface {
+	Start() error
+	Stop() error
+}
+
+func startCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "start",
+		Short: "Start the gateway and the enabled bots",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := configs.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+
+			g, bots, err := build(config)
+			if err != nil {
+				return err
+			}
+			for _, b := range bots {
+				go func(b bot) {
+					if err := b.Start(); err != nil {
+						log.Printf("⚠️ %v", err)
+					}
+				}(b)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			errc := make(chan error, 1)
+			go func() { errc <- g.Start() }()
+
+			select {
+			case err = <-errc:
+			case <-ctx.Done():
+				log.Println("Shutting down...")
+			}
+			for _, b := range bots {
+				if err := b.Stop(); err != nil {
+					log.Printf("⚠️ %v", err)
+				}
+			}
+			g.Sessions.Close()
+			return err
+		},
+	}
+}
+
+// build sets up the gateway and the enabled bots from the config. The bots
+// share the gateway's sessions and are registered with it for operator
+// messages and webhooks.
+func build(config *configs.Config) (*gateway.Gateway, []bot, error) {
+	provider, err := newProvider(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	stt, err := voice.NewTranscriber(config.Voice.STT)
+	if err != nil {
+		return nil, nil, err
+	}
+	tts, err := voice.NewSynthesizer(config.Voice.TTS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g := gateway.New(config.Gateway.Port, configPath)
+	g.Sessions.Configure(config.Sessions)
+	g.LLM = provider
+	g.SystemPrompt = config.LLM.SystemPrompt
+	g.Model = config.LLM.Model
+	g.Token = config.Gateway.Token
+	g.Agents = config.Agents
+	g.Channels = make(map[string]gateway.Deliverer)
+	g.Handlers = make(map[string]http.Handler)
+
+	var bots []bot
+	if tc := config.Channels.Telegram; tc.Enabled {
+		b, err := telegram.New(telegram.Config{
+			Token:          tc.Token,
+			AllowedIDs:     tc.AllowedIDs,
+			AdminIDs:       tc.AdminIDs,
+			SystemPrompt:   config.LLM.SystemPrompt,
+			WebhookURL:     tc.WebhookURL,
+			WebhookSecret:  tc.WebhookSecret,
+			APIEndpoint:    tc.APIEndpoint,
+			GroupReplies:   tc.GroupReplies,
+			TriggerWords:   tc.TriggerWords,
+			GroupSessions:  tc.GroupSessions,
+			STT:            stt,
+			EchoTranscript: config.Voice.EchoTranscript,
+			TTS:            tts,
+			MaxSpokenChars: config.Voice.TTS.MaxChars,
+			ParseMode:      tc.ParseMode,
+		}, g.Sessions, provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.AppConfig = config
+		b.ConfigPath = configPath
+		b.Router.SetModel(config.LLM.Model)
+		if path := b.WebhookPath(); path != "" {
+			g.Handlers[path] = b
+		}
+		g.Channels[b.Name()] = b
+		bots = append(bots, b)
+	}
+	if dc := config.Channels.Discord; dc.Enabled {
+		b, err := discord.New(discord.Config{
+			Token:                dc.Token,
+			GuildID:              dc.GuildID,
+			AllowedRoles:         dc.AllowedRoles,
+			DMPolicy:             dc.DMPolicy,
+			AllowedUsers:         dc.AllowedUsers,
+			Prefix:               dc.Prefix,
+			SystemPrompt:         config.LLM.SystemPrompt,
+			ShowUsage:            dc.ShowUsage,
+			Agents:               config.Agents,
+			SessionMode:          dc.SessionMode,
+			ThreadArchiveMinutes: dc.ThreadArchiveMinutes,
+			STT:                  stt,
+			EchoTranscript:       config.Voice.EchoTranscript,
+		}, g.Sessions, provider)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.Router.SetModel(config.LLM.Model)
+		g.Channels[b.Name()] = b
+		bots = append(bots, b)
+	}
+	return g, bots, nil
+}
+
+// newProvider creates the configured LLM provider
+func newProvider(config *configs.Config) (llm.Provider, error) {
+	key := config.GetAPIKey()
+	switch config.LLM.Provider {
+	case "anthropic", "":
+		if key == "" {
+			return nil, fmt.Errorf("no Anthropic API key: set llm.apiKey or ANTHROPIC_API_KEY")
+		}
+		return llm.NewClaude(key), nil
+	case "openrouter":
+		if key == "" {
+			return nil, fmt.Errorf("no OpenRouter API key: set llm.apiKey or OPENROUTER_API_KEY")
+		}
+		return llm.NewOpenRouter(key), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", config.LLM.Provider)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Config is the main configuration structure
@@ -13,6 +14,8 @@ type Config struct {
 	LLM      LLMConfig       `json:"llm"`
 	Channels ChannelsConfig  `json:"channels"`
 	Agents   []AgentConfig   `json:"agents,omitempty"`
+	Sessions SessionsConfig  `json:"sessions,omitempty"`
+	Voice    VoiceConfig     `json:"voice,omitempty"`
 }
 
 // GatewayConfig for the WebSocket server
@@ -47,6 +50,18 @@ type TelegramConfig struct {
 	Token      string  `json:"token,omitempty"`
 	AllowedIDs []int64 `json:"allowedIds,omitempty"`
 	AdminIDs   []int64 `json:"adminIds,omitempty"`
+
+	// Webhook mode, served by the gateway; long polling when empty
+	WebhookURL    string `json:"webhookUrl,omitempty"`    // Public URL, e.g. https://bot.example.com/telegram/webhook
+	WebhookSecret string `json:"webhookSecret,omitempty"` // Generated when empty
+	APIEndpoint   string `json:"apiEndpoint,omitempty"`   // Bot API URL format, for local Bot API servers
+
+	// Group chats
+	GroupReplies  string   `json:"groupReplies,omitempty"`  // mention (default) or all
+	TriggerWords  []string `json:"triggerWords,omitempty"`  // Words that address the bot like a mention
+	GroupSessions string   `json:"groupSessions,omitempty"` // chat (default) or user
+
+	ParseMode string `json:"parseMode,omitempty"` // Answer formatting: html (default) or markdownv2
 }
 
 // DiscordConfig for Discord bot
@@ -54,8 +69,87 @@ type DiscordConfig struct {
 	Enabled      bool     `json:"enabled"`
 	Token        string   `json:"token,omitempty"`
 	GuildID      string   `json:"guildId,omitempty"`
-	AllowedRoles []string `json:"allowedRoles,omitempty"`
+	AllowedRoles []string `json:"allowedRoles,omitempty"` // Role IDs or names
+	DMPolicy     string   `json:"dmPolicy,omitempty"`     // allow (default), deny or allowlist
+	AllowedUsers []string `json:"allowedUsers,omitempty"` // DM allowlist
 	Prefix       string   `json:"prefix,omitempty"`
+	ShowUsage    bool     `json:"showUsage,omitempty"` // Footer with model and token usage on answers
+
+	SessionMode          string `json:"sessionMode,omitempty"`          // channel (default), user or thread
+	ThreadArchiveMinutes int    `json:"threadArchiveMinutes,omitempty"` // Thread mode: 60, 1440, 4320 or 10080
+}
+
+// SessionsConfig for session retention and turn queueing. Zero values
+// disable a limit.
+type SessionsConfig struct {
+	MaxSessions     int      `json:"maxSessions,omitempty"`
+	MaxMessages     int      `json:"maxMessages,omitempty"`     // Per session
+	IdleTTL         Duration `json:"idleTtl,omitempty"`         // e.g. "72h"
+	MaxAge          Duration `json:"maxAge,omitempty"`          // e.g. "720h"
+	JanitorInterval Duration `json:"janitorInterval,omitempty"` // Default: 5m
+
+	// Turn queueing per session
+	MaxQueuedTurns int      `json:"maxQueuedTurns,omitempty"` // Default: 3
+	CoalesceWindow Duration `json:"coalesceWindow,omitempty"` // Merge rapid messages, e.g. "1500ms"
+}
+
+// VoiceConfig for voice messages
+type VoiceConfig struct {
+	STT            STTConfig `json:"stt,omitempty"`
+	TTS            TTSConfig `json:"tts,omitempty"`
+	EchoTranscript bool      `json:"echoTranscript,omitempty"` // Show users what was heard
+}
+
+// STTConfig selects the speech-to-text engine for voice messages. Voice
+// messages are refused when Provider is empty.
+type STTConfig struct {
+	Provider string   `json:"provider,omitempty"` // whisper (HTTP) or command
+	URL      string   `json:"url,omitempty"`      // Whisper-compatible transcription endpoint
+	APIKey   string   `json:"apiKey,omitempty"`
+	Model    string   `json:"model,omitempty"`    // Default: whisper-1
+	Language string   `json:"language,omitempty"` // ISO-639-1 hint, e.g. "en"
+	Command  []string `json:"command,omitempty"`  // Program and arguments; {input} is the audio file
+}
+
+// TTSConfig selects the text-to-speech engine for voice replies, which
+// are off when Provider is empty
+type TTSConfig struct {
+	Provider  string   `json:"provider,omitempty"`  // openai (HTTP) or command
+	URL       string   `json:"url,omitempty"`       // OpenAI-compatible speech endpoint
+	APIKey    string   `json:"apiKey,omitempty"`
+	Model     string   `json:"model,omitempty"`     // Default: tts-1
+	Voice     string   `json:"voice,omitempty"`     // Default: alloy
+	Command   []string `json:"command,omitempty"`   // Program and arguments; reads text on stdin, {output} is the audio file
+	MediaType string   `json:"mediaType,omitempty"` // Command output format, default audio/ogg
+	MaxChars  int      `json:"maxChars,omitempty"`  // Longer answers are sent as text; default 800
+}
+
+// Duration is a time.Duration written as a string like "1h30m" in JSON
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON reads a duration string, or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var secs float64
+		if err := json.Unmarshal(data, &secs); err != nil {
+			return err
+		}
+		*d = Duration(secs * float64(time.Second))
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
 }
 
 // AgentConfig for multi-agent support
@@ -92,6 +186,10 @@ func DefaultConfig() *Config {
 				Name: "Main Agent",
 			},
 		},
+		Sessions: SessionsConfig{
+			JanitorInterval: Duration(5 * time.Minute),
+			MaxQueuedTurns:  3,
+		},
 	}
 }
 
@@ -0,0 +1,97 @@
+// Package channels connects messaging platforms to HiveClaw sessions. Each
+// platform has a transport adapter implementing Channel; the Router owns
+// the conversation itself.
+package channels
+
+import (
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/channels/markdown"
+)
+
+// Markdown dialects a channel can render
+const (
+	MarkdownNone         = ""
+	MarkdownTelegramV2   = "telegram-markdownv2" // Telegram's MarkdownV2 parse mode
+	MarkdownTelegramHTML = "telegram-html"       // Telegram's HTML parse mode
+	MarkdownDiscord      = "discord"             // Discord's CommonMark subset
+)
+
+// Capabilities describe what a channel's transport supports
+type Capabilities struct {
+	MaxMessageLength int    // Longest text a single message may carry, in bytes
+	Markdown         string // Markdown dialect rendered in messages
+	Attachments      bool   // Files can be sent
+	Typing           bool   // A typing indicator can be shown
+
+	// EditInterval is the minimum time between edits of a streamed answer,
+	// to stay within the platform's rate limits
+	EditInterval time.Duration
+}
+
+// Inbound is a user message normalized from a platform update
+type Inbound struct {
+	SessionID string // Session key, e.g. "tg_<chatid>"
+	ChatID    string // Where replies go: a Telegram chat or Discord channel
+	UserID    string
+	Text      string
+	ReplyTo   string  // Platform ID of the message to reply to, if any
+	Media     []Media // Images and documents sent with the message
+}
+
+// Outbound is a message to send to a chat
+type Outbound struct {
+	ChatID     string
+	Text       string
+	ReplyTo    string      // Platform ID of the message to reply to
+	Markdown   bool        // Text is CommonMark, to render in the channel's dialect
+	Attachment *Attachment // Sent with the message when supported
+	Regenerate bool        // Offer a control asking for another answer
+}
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Name string
+	Data []byte
+}
+
+// Channel is a transport adapter for a messaging platform. Adapters turn
+// platform updates into Inbound messages for a Router and deliver what it
+// sends back.
+type Channel interface {
+	// Name identifies the channel; it matches session.ChannelOf
+	Name() string
+	Capabilities() Capabilities
+
+	// Start connects to the platform. It may block until Stop is called.
+	Start() error
+	Stop() error
+
+	// Send delivers a single message that fits the channel's limits and
+	// returns its platform ID
+	Send(out Outbound) (string, error)
+
+	// Typing shows a typing indicator in a chat
+	Typing(chatID string) error
+}
+
+// Merger is implemented by channels that must answer every message they
+// hand to the router, such as a deferred Discord interaction. Merged is
+// called when a message was merged into a later turn, which answers it.
+type Merger interface {
+	Merged(chatID string)
+}
+
+// Render converts CommonMark to a channel's markdown dialect. Text is
+// returned as is for MarkdownNone.
+func Render(text, dialect string) string {
+	switch dialect {
+	case MarkdownTelegramV2:
+		return markdown.TelegramMarkdownV2(text)
+	case MarkdownTelegramHTML:
+		return markdown.TelegramHTML(text)
+	case MarkdownDiscord:
+		return markdown.Discord(text)
+	}
+	return text
+}
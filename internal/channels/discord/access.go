@@ -0,0 +1,157 @@
+package discord
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DM policies
+const (
+	DMAllow     = "allow"     // Anyone can DM the bot (default)
+	DMDeny      = "deny"      // DMs are ignored
+	DMAllowlist = "allowlist" // Only users in AllowedUsers can DM the bot
+)
+
+// roleCacheTTL is how long resolved member roles are trusted
+const roleCacheTTL = 5 * time.Minute
+
+// roleCache remembers member roles so access checks don't need a REST call
+// for every message
+type roleCache struct {
+	mu      sync.Mutex
+	entries map[string]roleEntry // Keyed by guild and user ID
+}
+
+type roleEntry struct {
+	roles   []string
+	expires time.Time
+}
+
+func newRoleCache() *roleCache {
+	return &roleCache{entries: make(map[string]roleEntry)}
+}
+
+func (c *roleCache) get(guildID, userID string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[guildID+"/"+userID]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	return e.roles, true
+}
+
+func (c *roleCache) put(guildID, userID string, roles []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop expired entries now and then so the cache doesn't grow unbounded
+	if len(c.entries) >= 1024 {
+		now := time.Now()
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[guildID+"/"+userID] = roleEntry{roles: roles, expires: time.Now().Add(roleCacheTTL)}
+}
+
+// isAllowed reports whether a user may use the bot in a guild, or in a DM
+// when guildID is empty. member is the member data that came with the
+// event, if any; roles are resolved and cached otherwise. Denied attempts
+// are logged.
+func (b *Bot) isAllowed(guildID, channelID, userID string, member *discordgo.Member) bool {
+	if reason := b.denyReason(guildID, userID, member); reason != "" {
+		log.Printf("Unauthorized Discord access attempt from user %s in guild %q channel %s: %s", userID, guildID, channelID, reason)
+		return false
+	}
+	return true
+}
+
+// denyReason returns why a user may not use the bot, or "" if they may
+func (b *Bot) denyReason(guildID, userID string, member *discordgo.Member) string {
+	if guildID == "" {
+		switch b.Config.DMPolicy {
+		case DMDeny:
+			return "direct messages are disabled"
+		case DMAllowlist:
+			if !contains(b.Config.AllowedUsers, userID) {
+				return "user not in DM allowlist"
+			}
+		}
+		return ""
+	}
+
+	if b.Config.GuildID != "" && guildID != b.Config.GuildID {
+		return "guild not allowed"
+	}
+	if len(b.Config.AllowedRoles) == 0 {
+		return ""
+	}
+
+	roles, err := b.memberRoles(guildID, userID, member)
+	if err != nil {
+		return fmt.Sprintf("could not resolve roles: %v", err)
+	}
+	for _, roleID := range roles {
+		if b.roleAllowed(guildID, roleID) {
+			return ""
+		}
+	}
+	return "missing an allowed role"
+}
+
+// memberRoles returns a member's role IDs, from the event, the cache, the
+// gateway state or the API, in that order
+func (b *Bot) memberRoles(guildID, userID string, member *discordgo.Member) ([]string, error) {
+	if member != nil && member.Roles != nil {
+		b.roles.put(guildID, userID, member.Roles)
+		return member.Roles, nil
+	}
+	if roles, ok := b.roles.get(guildID, userID); ok {
+		return roles, nil
+	}
+
+	m, err := b.Session.State.Member(guildID, userID)
+	if err != nil {
+		if m, err = b.Session.GuildMember(guildID, userID); err != nil {
+			return nil, err
+		}
+	}
+	b.roles.put(guildID, userID, m.Roles)
+	return m.Roles, nil
+}
+
+// roleAllowed reports whether a role is listed in AllowedRoles, by ID or
+// by name
+func (b *Bot) roleAllowed(guildID, roleID string) bool {
+	if contains(b.Config.AllowedRoles, roleID) {
+		return true
+	}
+	role, err := b.Session.State.Role(guildID, roleID)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range b.Config.AllowedRoles {
+		if strings.EqualFold(allowed, role.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
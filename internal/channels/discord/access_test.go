@@ -0,0 +1,52 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func TestDenyReason(t *testing.T) {
+	member := func(roles ...string) *discordgo.Member { return &discordgo.Member{Roles: append([]string{}, roles...)} }
+	tests := []struct {
+		name   string
+		config Config
+		guild  string
+		user   string
+		member *discordgo.Member
+		want   string // Prefix of the reason; "" when allowed
+	}{
+		{"dm by default", Config{}, "", "u1", nil, ""},
+		{"dm denied", Config{DMPolicy: DMDeny}, "", "u1", nil, "direct messages are disabled"},
+		{"dm allowlisted", Config{DMPolicy: DMAllowlist, AllowedUsers: []string{"u1"}}, "", "u1", nil, ""},
+		{"dm not allowlisted", Config{DMPolicy: DMAllowlist, AllowedUsers: []string{"u2"}}, "", "u1", nil, "user not in DM allowlist"},
+		{"dm policy spares guilds", Config{DMPolicy: DMDeny}, "g1", "u1", nil, ""},
+		{"any guild", Config{}, "g2", "u1", nil, ""},
+		{"configured guild", Config{GuildID: "g1"}, "g1", "u1", nil, ""},
+		{"other guild", Config{GuildID: "g1"}, "g2", "u1", nil, "guild not allowed"},
+		{"role by id", Config{AllowedRoles: []string{"r1"}}, "g1", "u1", member("r9", "r1"), ""},
+		{"role by name", Config{AllowedRoles: []string{"support"}}, "g1", "u1", member("r2"), ""},
+		{"missing role", Config{AllowedRoles: []string{"r1", "Support"}}, "g1", "u1", member("r9"), "missing an allowed role"},
+		{"no roles", Config{AllowedRoles: []string{"r1"}}, "g1", "u1", member(), "missing an allowed role"},
+		{"cached roles", Config{AllowedRoles: []string{"r1"}}, "g1", "cached", nil, ""},
+		{"unknown member", Config{AllowedRoles: []string{"r1"}}, "g1", "u1", nil, "could not resolve roles"},
+		{"guild checked before roles", Config{GuildID: "g1", AllowedRoles: []string{"r1"}}, "g2", "u1", member("r1"), "guild not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newAPIBot(t, nil)
+			b.Config = tt.config
+			b.Session.State.GuildAdd(&discordgo.Guild{ID: "g1", Roles: []*discordgo.Role{{ID: "r2", Name: "Support"}}})
+			b.roles.put("g1", "cached", []string{"r1"})
+
+			got := b.denyReason(tt.guild, tt.user, tt.member)
+			if tt.want == "" && got != "" || !strings.HasPrefix(got, tt.want) {
+				t.Errorf("denyReason = %q, want %q", got, tt.want)
+			}
+			if allowed := b.isAllowed(tt.guild, "c1", tt.user, tt.member); allowed != (tt.want == "") {
+				t.Errorf("isAllowed = %v", allowed)
+			}
+		})
+	}
+}
@@ -1,30 +1,66 @@
 package discord
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/channels"
 	"github.com/nanilabs/hiveclaw/internal/llm"
 	"github.com/nanilabs/hiveclaw/internal/session"
+	"github.com/nanilabs/hiveclaw/internal/voice"
 )
 
-// Bot represents a Discord bot
+// regenerateEmoji is the reaction that asks for a new answer
+const regenerateEmoji = "🔄"
+
+// Bot represents a Discord bot. It is the Discord transport for a
+// channels.Router, which runs the conversations.
 type Bot struct {
 	Session  *discordgo.Session
 	Sessions *session.Manager
-	LLM      llm.Provider
+	Router   *channels.Router
 	Config   Config
+
+	commands []*discordgo.ApplicationCommand // Slash commands registered on start
+	roles    *roleCache
+	threads  sync.Map // Channel ID -> threadInfo
 }
 
+var (
+	_ channels.Channel = (*Bot)(nil)
+	_ channels.Editor  = (*Bot)(nil)
+)
+
 // Config for Discord bot
 type Config struct {
 	Token        string   `json:"token"`
 	GuildID      string   `json:"guildId"`      // Optional: limit to specific guild
-	AllowedRoles []string `json:"allowedRoles"` // Optional: role-based access
+	AllowedRoles []string `json:"allowedRoles"` // Optional: role IDs or names allowed in guilds
+	DMPolicy     string   `json:"dmPolicy"`     // allow (default), deny or allowlist
+	AllowedUsers []string `json:"allowedUsers"` // User IDs allowed to DM under the allowlist policy
 	Prefix       string   `json:"prefix"`       // Command prefix (default: !)
 	SystemPrompt string   `json:"systemPrompt"`
+	ShowUsage    bool     `json:"showUsage"` // Footer with model and token usage on answers
+
+	// Agents offered by /agent, answering with their own system prompt and
+	// model
+	Agents []configs.AgentConfig `json:"agents"`
+
+	// SessionMode is channel (default), user or thread; see SessionPerChannel
+	SessionMode          string `json:"sessionMode"`
+	ThreadArchiveMinutes int    `json:"threadArchiveMinutes"` // Idle time before a thread is archived: 60 (default), 1440, 4320 or 10080
+
+	// Voice messages are transcribed with STT (see voice.NewTranscriber);
+	// they are refused when it is nil
+	STT            voice.Transcriber `json:"-"`
+	EchoTranscript bool              `json:"echoTranscript"` // Reply with what was heard
 }
 
 // New creates a new Discord bot
@@ -41,16 +77,24 @@ func New(config Config, sessions *session.Manager, llmProvider llm.Provider) (*B
 	bot := &Bot{
 		Session:  dg,
 		Sessions: sessions,
-		LLM:      llmProvider,
+		Router:   channels.NewRouter(sessions, llmProvider, config.SystemPrompt),
 		Config:   config,
+		roles:    newRoleCache(),
 	}
+	bot.Router.Footer = config.ShowUsage
+	bot.Router.Agents = config.Agents
+	bot.Router.STT = config.STT
+	bot.Router.EchoTranscript = config.EchoTranscript
 
 	// Register handlers
 	dg.AddHandler(bot.messageCreate)
+	dg.AddHandler(bot.messageReactionAdd)
+	dg.AddHandler(bot.interactionCreate)
 	dg.AddHandler(bot.ready)
 
 	// Set intents
-	dg.Identify.Intents = discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent
+	dg.Identify.Intents = discordgo.IntentsGuilds | discordgo.IntentsGuildMessages | discordgo.IntentsDirectMessages | discordgo.IntentsMessageContent |
+		discordgo.IntentsGuildMessageReactions | discordgo.IntentsDirectMessageReactions
 
 	return bot, nil
 }
@@ -61,20 +105,103 @@ func (b *Bot) Start() error {
 		return fmt.Errorf("failed to open Discord connection: %w", err)
 	}
 
+	// Prefix commands keep working if slash commands can't be registered
+	if err := b.registerCommands(); err != nil {
+		log.Printf("⚠️ %v", err)
+	}
+
 	log.Println("🎮 Discord bot is running...")
 	return nil
 }
 
-// Stop stops the Discord bot
+// Stop removes the slash commands and stops the Discord bot
 func (b *Bot) Stop() error {
+	b.removeCommands()
 	return b.Session.Close()
 }
 
+// Name identifies the channel
+func (b *Bot) Name() string {
+	return "discord"
+}
+
+// Capabilities describes what Discord messages support
+func (b *Bot) Capabilities() channels.Capabilities {
+	return channels.Capabilities{
+		MaxMessageLength: 2000, // Discord's message limit
+		Markdown:         channels.MarkdownDiscord,
+		Attachments:      true,
+		Typing:           true,
+
+		// Discord allows five message edits per 5 seconds in a channel
+		EditInterval: time.Second,
+	}
+}
+
+// Send sends one message to a channel. Discord always renders markdown.
+func (b *Bot) Send(out channels.Outbound) (string, error) {
+	send := &discordgo.MessageSend{Content: content(out)}
+	if out.ReplyTo != "" {
+		send.Reference = &discordgo.MessageReference{MessageID: out.ReplyTo, ChannelID: out.ChatID}
+	}
+	if out.Attachment != nil {
+		send.Files = []*discordgo.File{{
+			Name:   out.Attachment.Name,
+			Reader: bytes.NewReader(out.Attachment.Data),
+		}}
+	}
+
+	msg, err := b.Session.ChannelMessageSendComplex(out.ChatID, send)
+	if err != nil {
+		return "", retryAfter(err)
+	}
+	if out.Regenerate {
+		b.Session.MessageReactionAdd(out.ChatID, msg.ID, regenerateEmoji)
+	}
+	return msg.ID, nil
+}
+
+// Edit replaces the text of a message the bot sent. Rate limits are
+// returned rather than waited out, so streaming can skip an edit.
+func (b *Bot) Edit(chatID, messageID string, out channels.Outbound) error {
+	edit := discordgo.NewMessageEdit(chatID, messageID).SetContent(content(out))
+	if _, err := b.Session.ChannelMessageEditComplex(edit, discordgo.WithRetryOnRatelimit(false)); err != nil {
+		return retryAfter(err)
+	}
+	if out.Regenerate {
+		b.Session.MessageReactionAdd(chatID, messageID, regenerateEmoji)
+	}
+	return nil
+}
+
+// content is a message's text as sent to Discord, with answers rendered
+// from CommonMark
+func content(out channels.Outbound) string {
+	if out.Markdown {
+		return channels.Render(out.Text, channels.MarkdownDiscord)
+	}
+	return out.Text
+}
+
+// retryAfter turns Discord rate limit errors into channels.RetryAfterError
+func retryAfter(err error) error {
+	var limited *discordgo.RateLimitError
+	if errors.As(err, &limited) {
+		return &channels.RetryAfterError{Wait: limited.RetryAfter, Err: err}
+	}
+	return err
+}
+
+// Typing shows the typing indicator in a channel
+func (b *Bot) Typing(chatID string) error {
+	return b.Session.ChannelTyping(chatID)
+}
+
 func (b *Bot) ready(s *discordgo.Session, event *discordgo.Ready) {
 	log.Printf("🎮 Discord bot logged in as %s#%s", event.User.Username, event.User.Discriminator)
 
 	// Set status
-	s.UpdateGameStatus(0, "🐝 HiveClaw | !help")
+	s.UpdateGameStatus(0, "🐝 HiveClaw | /ask")
 }
 
 func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -84,10 +211,7 @@ func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}
 
 	// Check if it's a command
-	if strings.HasPrefix(m.Content, b.Config.Prefix) {
-		b.handleCommand(s, m)
-		return
-	}
+	isCommand := strings.HasPrefix(m.Content, b.Config.Prefix)
 
 	// Check if bot is mentioned or it's a DM
 	mentioned := false
@@ -101,9 +225,21 @@ func (b *Bot) messageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// In DMs, always respond
 	isDM := m.GuildID == ""
 
-	if mentioned || isDM {
-		b.handleChat(s, m)
+	// Follow-ups in the bot's conversation threads don't need a mention
+	inThread := !isDM && b.isBotThread(m.ChannelID)
+
+	if !isCommand && !mentioned && !isDM && !inThread {
+		return
+	}
+	if !b.isAllowed(m.GuildID, m.ChannelID, m.Author.ID, m.Member) {
+		return
+	}
+
+	if isCommand {
+		b.handleCommand(s, m)
+		return
 	}
+	b.handleChat(s, m)
 }
 
 func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
@@ -137,6 +273,26 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 					Value:  "Clear conversation history",
 					Inline: true,
 				},
+				{
+					Name:   "🔄 !regen",
+					Value:  "Regenerate the last answer (or react with 🔄)",
+					Inline: true,
+				},
+				{
+					Name:   "✏️ !edit <text>",
+					Value:  "Edit your last message and retry",
+					Inline: true,
+				},
+				{
+					Name:   "📤 !export [format]",
+					Value:  "Download this conversation (markdown, json, openai, anthropic)",
+					Inline: true,
+				},
+				{
+					Name:   "🔍 !search <words>",
+					Value:  "Search this conversation's history",
+					Inline: true,
+				},
 				{
 					Name:   "📊 !status",
 					Value:  "Check system status",
@@ -152,7 +308,7 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 	case "new":
 		sessionKey := b.getSessionKey(m)
 		b.Sessions.Delete(sessionKey)
-		b.Sessions.Create(sessionKey)
+		b.Sessions.CreateWithID(sessionKey, "")
 		s.ChannelMessageSend(m.ChannelID, "🆕 Started a new conversation!")
 
 	case "clear":
@@ -160,29 +316,34 @@ func (b *Bot) handleCommand(s *discordgo.Session, m *discordgo.MessageCreate) {
 		b.Sessions.Clear(sessionKey)
 		s.ChannelMessageSend(m.ChannelID, "🧹 Conversation cleared!")
 
-	case "status":
-		embed := &discordgo.MessageEmbed{
-			Title: "🐝 HiveClaw Status",
-			Color: 0x00FF00, // Green
-			Fields: []*discordgo.MessageEmbedField{
-				{
-					Name:   "Version",
-					Value:  "0.1.0",
-					Inline: true,
-				},
-				{
-					Name:   "Status",
-					Value:  "✅ Operational",
-					Inline: true,
-				},
-				{
-					Name:   "Your ID",
-					Value:  m.Author.ID,
-					Inline: true,
-				},
-			},
+	case "regen", "regenerate":
+		b.Router.Regenerate(b, b.getSessionKey(m), m.ChannelID)
+
+	case "edit":
+		text := strings.TrimSpace(strings.TrimPrefix(content, parts[0]))
+		if text == "" {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Usage: `%sedit <new message>`", b.Config.Prefix))
+			return
 		}
-		s.ChannelMessageSendEmbed(m.ChannelID, embed)
+		b.Router.EditLast(b, b.getSessionKey(m), m.ChannelID, text)
+
+	case "export":
+		format := ""
+		if len(parts) > 1 {
+			format = parts[1]
+		}
+		b.exportSession(b, m.ChannelID, b.getSessionKey(m), format)
+
+	case "search":
+		query := strings.TrimSpace(strings.TrimPrefix(content, parts[0]))
+		if query == "" {
+			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf("Usage: `%ssearch <words>`", b.Config.Prefix))
+			return
+		}
+		b.search(s, m.ChannelID, b.getSessionKey(m), query)
+
+	case "status":
+		s.ChannelMessageSendEmbed(m.ChannelID, statusEmbed(m.Author.ID))
 
 	case "ping":
 		s.ChannelMessageSend(m.ChannelID, "🏓 Pong!")
@@ -201,81 +362,183 @@ func (b *Bot) handleChat(s *discordgo.Session, m *discordgo.MessageCreate) {
 	}
 	content = strings.TrimSpace(content)
 
-	if content == "" {
+	// Voice messages are answered as if their transcript had been typed
+	transcript, ok := b.transcribe(m, m.ChannelID, m.ID)
+	if !ok {
+		return
+	}
+	content = strings.TrimSpace(content + "\n" + transcript)
+
+	media, skipped := b.media(m)
+	if note := channels.SkippedNote(skipped); note != "" {
+		content = strings.TrimSpace(content + "\n" + note)
+	}
+
+	if content == "" && len(media) == 0 {
 		s.ChannelMessageSend(m.ChannelID, "Hey! How can I help you?")
 		return
 	}
 
-	sessionKey := b.getSessionKey(m)
+	in := channels.Inbound{
+		SessionID: b.getSessionKey(m),
+		ChatID:    m.ChannelID,
+		UserID:    m.Author.ID,
+		Text:      content,
+		ReplyTo:   m.ID,
+		Media:     media,
+	}
 
-	// Get or create session
-	_, exists := b.Sessions.Get(sessionKey)
-	if !exists {
-		b.Sessions.Create(sessionKey)
+	// Move new conversations into a thread of their own
+	if b.Config.SessionMode == SessionPerThread && m.GuildID != "" && !b.isThread(m.ChannelID) {
+		threadID, err := b.startThread(m, content)
+		if err != nil {
+			log.Printf("Discord thread error, answering in channel: %v", err)
+		} else {
+			in.SessionID = b.sessionKey(m.GuildID, threadID, m.Author.ID)
+			in.ChatID = threadID
+			in.ReplyTo = ""
+		}
 	}
 
-	// Add user message
-	b.Sessions.AddMessage(sessionKey, "user", content)
+	b.Router.Handle(b, in)
+}
 
-	// Show typing indicator
-	s.ChannelTyping(m.ChannelID)
+// exportSession sends a session as a file attachment through ch, the bot
+// itself or an interaction reply
+func (b *Bot) exportSession(ch channels.Channel, channelID, sessionKey, formatName string) {
+	reply := func(text string) {
+		b.Router.Send(ch, channels.Outbound{ChatID: channelID, Text: text})
+	}
 
-	// Build messages for LLM
-	messages, _ := b.Sessions.GetMessages(sessionKey)
-	llmMessages := make([]llm.Message, len(messages))
-	for i, msg := range messages {
-		llmMessages[i] = llm.Message{Role: msg.Role, Content: msg.Content}
+	format, err := session.ParseFormat(formatName)
+	if err != nil {
+		reply(fmt.Sprintf("Usage: `%sexport [markdown|json|openai|anthropic]`", b.Config.Prefix))
+		return
 	}
 
-	// Call LLM
-	resp, err := b.LLM.Chat(llmMessages, llm.Options{
-		System: b.Config.SystemPrompt,
-	})
+	sess, ok := b.Sessions.Get(sessionKey)
+	if !ok {
+		reply("Nothing to export yet.")
+		return
+	}
 
+	data, err := b.Sessions.Export(sess.ID, format)
 	if err != nil {
-		log.Printf("LLM error: %v", err)
-		s.ChannelMessageSend(m.ChannelID, "❌ Sorry, I encountered an error. Please try again.")
+		log.Printf("Export error: %v", err)
+		reply("❌ Sorry, the export failed.")
 		return
 	}
 
-	// Add assistant response
-	b.Sessions.AddMessage(sessionKey, "assistant", resp.Content)
+	b.Router.Send(ch, channels.Outbound{
+		ChatID: channelID,
+		Attachment: &channels.Attachment{
+			Name: session.FileName(sess, format),
+			Data: data,
+		},
+	})
+}
+
+// search looks up messages in the caller's sessions
+func (b *Bot) search(s *discordgo.Session, channelID, sessionKey, query string) {
+	results := b.Sessions.Search(session.SearchQuery{
+		Query: query,
+		Scope: sessionKey,
+		Limit: 5,
+	})
+	if len(results) == 0 {
+		s.ChannelMessageSend(channelID, "🔍 No matches found.")
+		return
+	}
 
-	// Send response (split if too long)
-	b.sendMessage(s, m.ChannelID, resp.Content, m.Reference())
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("🔍 Results for \"%s\"", query),
+		Color: 0xFFD700, // Gold
+	}
+	for _, r := range results {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%s · %s", r.Message.Role, r.Message.Timestamp.Format("2006-01-02 15:04")),
+			Value: r.Snippet,
+		})
+	}
+	s.ChannelMessageSendEmbed(channelID, embed)
 }
 
-func (b *Bot) getSessionKey(m *discordgo.MessageCreate) string {
-	// Use channel ID for guilds, user ID for DMs
-	if m.GuildID == "" {
-		return fmt.Sprintf("discord_dm_%s", m.Author.ID)
+// statusEmbed describes the bot's status to a user
+func statusEmbed(userID string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title: "🐝 HiveClaw Status",
+		Color: 0x00FF00, // Green
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Version",
+				Value:  "0.1.0",
+				Inline: true,
+			},
+			{
+				Name:   "Status",
+				Value:  "✅ Operational",
+				Inline: true,
+			},
+			{
+				Name:   "Your ID",
+				Value:  userID,
+				Inline: true,
+			},
+		},
 	}
-	return fmt.Sprintf("discord_%s_%s", m.GuildID, m.ChannelID)
 }
 
-func (b *Bot) sendMessage(s *discordgo.Session, channelID, content string, ref *discordgo.MessageReference) {
-	const maxLength = 2000 // Discord's message limit
+func (b *Bot) messageReactionAdd(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	if r.UserID == s.State.User.ID || r.Emoji.Name != regenerateEmoji {
+		return
+	}
+	if !b.isAllowed(r.GuildID, r.ChannelID, r.UserID, r.Member) {
+		return
+	}
 
-	if len(content) <= maxLength {
-		s.ChannelMessageSendReply(channelID, content, ref)
+	// Only regenerate from reactions on the bot's own answers
+	msg, err := s.ChannelMessage(r.ChannelID, r.MessageID)
+	if err != nil || msg.Author == nil || msg.Author.ID != s.State.User.ID {
 		return
 	}
 
-	// Split long messages
-	for len(content) > 0 {
-		end := maxLength
-		if end > len(content) {
-			end = len(content)
-		}
+	s.MessageReactionRemove(r.ChannelID, r.MessageID, regenerateEmoji, s.State.User.ID)
+	b.Router.Regenerate(b, b.sessionKey(r.GuildID, r.ChannelID, r.UserID), r.ChannelID)
+}
+
+// Deliver sends an operator's message to the channel or DM behind a session
+func (b *Bot) Deliver(sessionID, text string) error {
+	// discord_<guild>_<channel>[_<user>] or discord_dm_<user>
+	parts := strings.Split(sessionID, "_")
+	if len(parts) < 3 || parts[0] != "discord" {
+		return fmt.Errorf("not a Discord session: %s", sessionID)
+	}
 
-		// Try to split at newline
-		if end < len(content) {
-			if idx := strings.LastIndex(content[:end], "\n"); idx > 0 {
-				end = idx + 1
-			}
+	channelID := parts[2]
+	if parts[1] == "dm" {
+		ch, err := b.Session.UserChannelCreate(parts[2])
+		if err != nil {
+			return fmt.Errorf("failed to open DM: %w", err)
 		}
+		channelID = ch.ID
+	}
 
-		s.ChannelMessageSend(channelID, content[:end])
-		content = content[end:]
+	_, err := b.Router.Send(b, channels.Outbound{ChatID: channelID, Text: text})
+	return err
+}
+
+func (b *Bot) getSessionKey(m *discordgo.MessageCreate) string {
+	return b.sessionKey(m.GuildID, m.ChannelID, m.Author.ID)
+}
+
+// sessionKey returns the session for a user in a channel, thread or DM
+func (b *Bot) sessionKey(guildID, channelID, userID string) string {
+	// Use channel ID for guilds, user ID for DMs
+	if guildID == "" {
+		return fmt.Sprintf("discord_dm_%s", userID)
+	}
+	if b.Config.SessionMode == SessionPerUser {
+		return fmt.Sprintf("discord_%s_%s_%s", guildID, channelID, userID)
 	}
+	return fmt.Sprintf("discord_%s_%s", guildID, channelID)
 }
@@ -0,0 +1,178 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// fakeAPI stands in for Discord's REST API. It records sends, edits and
+// reactions as "send <channel> <id>: <text>", "edit <id>: <text>" and
+// "react <id>", rate limits the first limitEdits edits and knows nothing
+// that can be fetched.
+type fakeAPI struct {
+	mu         sync.Mutex
+	calls      []string
+	limitEdits int
+	ids        int
+}
+
+func (f *fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	f.serve(rec, req)
+	return rec.Result(), nil
+}
+
+func (f *fakeAPI) serve(w http.ResponseWriter, req *http.Request) {
+	api, _ := url.Parse(discordgo.EndpointAPI)
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, api.Path), "/")
+	var body struct {
+		Content string `json:"content"`
+	}
+	json.NewDecoder(req.Body).Decode(&body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case req.Method == http.MethodPost && len(parts) == 3 && parts[2] == "messages":
+		f.ids++
+		id := fmt.Sprintf("m%d", f.ids)
+		f.calls = append(f.calls, fmt.Sprintf("send %s %s: %s", parts[1], id, body.Content))
+		json.NewEncoder(w).Encode(map[string]string{"id": id, "channel_id": parts[1]})
+	case req.Method == http.MethodPatch && len(parts) == 4:
+		if f.limitEdits > 0 {
+			f.limitEdits--
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 0.05}`)
+			return
+		}
+		f.calls = append(f.calls, fmt.Sprintf("edit %s: %s", parts[3], body.Content))
+		json.NewEncoder(w).Encode(map[string]string{"id": parts[3], "channel_id": parts[1]})
+	case req.Method == http.MethodPut && len(parts) > 4 && parts[4] == "reactions":
+		f.calls = append(f.calls, "react "+parts[3])
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodGet:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Unknown", "code": 10000}`)
+	default: // Typing
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (f *fakeAPI) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.calls...)
+}
+
+// newAPIBot returns a bot talking to a fake Discord API
+func newAPIBot(t *testing.T, provider llm.Provider) (*Bot, *fakeAPI) {
+	t.Helper()
+	bot, err := New(Config{Token: "test"}, session.NewManager(), provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &fakeAPI{}
+	bot.Session.Client = &http.Client{Transport: api}
+	return bot, api
+}
+
+// chunkLLM streams the given chunks
+type chunkLLM []string
+
+func (l chunkLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return nil, errors.New("not streaming")
+}
+
+func (l chunkLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk, len(l)+1)
+	for _, c := range l {
+		ch <- llm.StreamChunk{Content: c}
+	}
+	ch <- llm.StreamChunk{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func TestStreamingEdits(t *testing.T) {
+	chunk := strings.Repeat("word ", 300)
+	bot, api := newAPIBot(t, chunkLLM{chunk, chunk})
+	api.limitEdits = 1 // The forced edit at the rollover waits it out
+
+	bot.Router.Handle(bot, channels.Inbound{SessionID: "discord_dm_1", ChatID: "c1", Text: "talk"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if calls := api.recorded(); len(calls) > 0 && strings.HasPrefix(calls[len(calls)-1], "react") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no finished answer: %q", api.recorded())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A placeholder, filled in and continued in a second message once full
+	calls := api.recorded()
+	var kinds []string
+	var parts []string
+	for _, call := range calls {
+		kind, text, _ := strings.Cut(call, ": ")
+		kinds = append(kinds, kind)
+		if strings.HasPrefix(kind, "edit") {
+			if len(text) > 2000 {
+				t.Errorf("%s is %d characters", kind, len(text))
+			}
+			parts = append(parts, text)
+		}
+	}
+	want := []string{"send c1 m1", "edit m1", "send c1 m2", "edit m2", "react m2"}
+	if strings.Join(kinds, ",") != strings.Join(want, ",") {
+		t.Fatalf("calls %q, want %q", kinds, want)
+	}
+	if calls[0] != "send c1 m1: …" || calls[2] != "send c1 m2: …" {
+		t.Errorf("placeholders %q and %q", calls[0], calls[2])
+	}
+	if strings.Join(parts, "") != chunk+chunk {
+		t.Errorf("edits %q don't add up to the answer", parts)
+	}
+
+	messages, _ := bot.Sessions.GetMessages("discord_dm_1")
+	if len(messages) != 2 || messages[1].Content != chunk+chunk {
+		t.Errorf("stored %d messages", len(messages))
+	}
+}
+
+func TestEditRateLimited(t *testing.T) {
+	bot, api := newAPIBot(t, nil)
+	api.limitEdits = 1
+
+	err := bot.Edit("c1", "m1", channels.Outbound{ChatID: "c1", Text: "partial"})
+	var retry *channels.RetryAfterError
+	if !errors.As(err, &retry) || retry.Wait != 50*time.Millisecond {
+		t.Fatalf("got %v, want a RetryAfterError of 50ms", err)
+	}
+	if calls := api.recorded(); len(calls) != 0 {
+		t.Errorf("rate limited edit retried: %q", calls)
+	}
+
+	if err := bot.Edit("c1", "m1", channels.Outbound{ChatID: "c1", Text: "**done**", Markdown: true, Regenerate: true}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := api.recorded(); strings.Join(calls, ",") != "edit m1: **done**,react m1" {
+		t.Errorf("calls %q", calls)
+	}
+}
@@ -0,0 +1,321 @@
+package discord
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// applicationCommands returns the slash commands the bot registers
+func (b *Bot) applicationCommands() []*discordgo.ApplicationCommand {
+	formats := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Markdown", Value: session.FormatMarkdown},
+		{Name: "JSON", Value: session.FormatJSON},
+		{Name: "OpenAI fine-tuning", Value: session.FormatOpenAI},
+		{Name: "Anthropic fine-tuning", Value: session.FormatAnthropic},
+	}
+
+	// Discord allows at most 25 choices; beyond that the ID is typed in and
+	// checked when the command runs
+	var agents []*discordgo.ApplicationCommandOptionChoice
+	if len(b.Config.Agents) <= 25 {
+		for _, agent := range b.Config.Agents {
+			name := agent.Name
+			if name == "" {
+				name = agent.ID
+			}
+			agents = append(agents, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: agent.ID})
+		}
+	}
+
+	return []*discordgo.ApplicationCommand{
+		{
+			Name:        "ask",
+			Description: "Ask HiveClaw something",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "prompt",
+				Description: "Your message",
+				Required:    true,
+			}},
+		},
+		{Name: "new", Description: "Start a new conversation"},
+		{Name: "clear", Description: "Clear conversation history"},
+		{Name: "status", Description: "Check system status"},
+		{
+			Name:        "agent",
+			Description: "Show or switch the agent answering here",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "id",
+				Description: "Agent to switch to",
+				Choices:     agents,
+			}},
+		},
+		{
+			Name:        "export",
+			Description: "Download this conversation",
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "format",
+				Description: "File format (default: Markdown)",
+				Choices:     formats,
+			}},
+		},
+	}
+}
+
+// registerCommands registers the slash commands in the configured guild,
+// or globally when none is set. Global commands can take up to an hour to
+// show up in clients.
+func (b *Bot) registerCommands() error {
+	created, err := b.Session.ApplicationCommandBulkOverwrite(b.Session.State.User.ID, b.Config.GuildID, b.applicationCommands())
+	if err != nil {
+		return fmt.Errorf("failed to register slash commands: %w", err)
+	}
+	b.commands = created
+	return nil
+}
+
+// removeCommands deletes the slash commands registered on start
+func (b *Bot) removeCommands() {
+	for _, cmd := range b.commands {
+		if err := b.Session.ApplicationCommandDelete(cmd.ApplicationID, b.Config.GuildID, cmd.ID); err != nil {
+			log.Printf("Failed to remove Discord command /%s: %v", cmd.Name, err)
+		}
+	}
+	b.commands = nil
+}
+
+func (b *Bot) interactionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Type != discordgo.InteractionApplicationCommand {
+		return
+	}
+
+	data := i.ApplicationCommandData()
+	options := make(map[string]string)
+	for _, opt := range data.Options {
+		options[opt.Name] = opt.StringValue()
+	}
+
+	user := interactionUser(i.Interaction)
+	if !b.isAllowed(i.GuildID, i.ChannelID, user.ID, i.Member) {
+		b.respond(i.Interaction, "⛔ You're not allowed to use this bot.", true)
+		return
+	}
+	sessionKey := b.sessionKey(i.GuildID, i.ChannelID, user.ID)
+
+	switch data.Name {
+	case "ask":
+		if b.Sessions.Paused(sessionKey) {
+			b.respond(i.Interaction, channels.PausedMessage, true)
+			return
+		}
+		// Answers can take longer than the 3 seconds Discord waits for a
+		// response, so acknowledge first and fill the reply in
+		if err := b.deferResponse(i.Interaction); err != nil {
+			log.Printf("Failed to defer Discord interaction: %v", err)
+			return
+		}
+		b.Router.Handle(b.interactionReply(i.Interaction), channels.Inbound{
+			SessionID: sessionKey,
+			ChatID:    i.ChannelID,
+			UserID:    user.ID,
+			Text:      options["prompt"],
+		})
+
+	case "new":
+		b.Sessions.Delete(sessionKey)
+		b.Sessions.CreateWithID(sessionKey, "")
+		b.respond(i.Interaction, "🆕 Started a new conversation!", false)
+
+	case "clear":
+		b.Sessions.Clear(sessionKey)
+		b.respond(i.Interaction, "🧹 Conversation cleared!", false)
+
+	case "status":
+		b.respondEmbed(i.Interaction, statusEmbed(user.ID), true)
+
+	case "agent":
+		b.respond(i.Interaction, b.switchAgent(sessionKey, options["id"]), true)
+
+	case "export":
+		if err := b.deferResponse(i.Interaction); err != nil {
+			log.Printf("Failed to defer Discord interaction: %v", err)
+			return
+		}
+		b.exportSession(b.interactionReply(i.Interaction), i.ChannelID, sessionKey, options["format"])
+	}
+}
+
+// switchAgent switches the agent answering in a session, or reports the
+// current one when id is empty, and returns the reply. Only configured
+// agents can be picked.
+func (b *Bot) switchAgent(sessionKey, id string) string {
+	if id == "" {
+		agent := "main"
+		if sess, ok := b.Sessions.Get(sessionKey); ok && sess.AgentID != "" {
+			agent = sess.AgentID
+		}
+		return fmt.Sprintf("🤖 Current agent: `%s`", agent)
+	}
+
+	if _, ok := b.Router.Agent(id); !ok {
+		if len(b.Config.Agents) == 0 {
+			return "❌ No agents are configured."
+		}
+		ids := make([]string, len(b.Config.Agents))
+		for i, agent := range b.Config.Agents {
+			ids[i] = "`" + agent.ID + "`"
+		}
+		return fmt.Sprintf("❌ Unknown agent `%s`. Available: %s", id, strings.Join(ids, ", "))
+	}
+
+	b.Sessions.GetOrCreate(sessionKey)
+	if err := b.Sessions.Update(sessionKey, "", id); err != nil {
+		log.Printf("Agent switch error: %v", err)
+		return "❌ Sorry, I couldn't switch agents."
+	}
+	return fmt.Sprintf("🤖 Switched to agent `%s`", id)
+}
+
+// respond answers an interaction with a message
+func (b *Bot) respond(i *discordgo.Interaction, content string, ephemeral bool) {
+	b.interactionRespond(i, &discordgo.InteractionResponseData{Content: content}, ephemeral)
+}
+
+// respondEmbed answers an interaction with an embed
+func (b *Bot) respondEmbed(i *discordgo.Interaction, embed *discordgo.MessageEmbed, ephemeral bool) {
+	b.interactionRespond(i, &discordgo.InteractionResponseData{Embeds: []*discordgo.MessageEmbed{embed}}, ephemeral)
+}
+
+func (b *Bot) interactionRespond(i *discordgo.Interaction, data *discordgo.InteractionResponseData, ephemeral bool) {
+	if ephemeral {
+		data.Flags = discordgo.MessageFlagsEphemeral
+	}
+	err := b.Session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+	if err != nil {
+		log.Printf("Failed to respond to Discord interaction: %v", err)
+	}
+}
+
+// deferResponse acknowledges an interaction, showing "thinking…" until the
+// response is edited in
+func (b *Bot) deferResponse(i *discordgo.Interaction) error {
+	return b.Session.InteractionRespond(i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+}
+
+// interactionUser returns who invoked an interaction, in a guild or a DM
+func interactionUser(i *discordgo.Interaction) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+	return i.User
+}
+
+// interactionReply is a channels.Channel that answers a deferred
+// interaction: the first message fills in the deferred response and later
+// ones are sent as follow-ups
+type interactionReply struct {
+	bot         *Bot
+	interaction *discordgo.Interaction
+
+	mu         sync.Mutex
+	originalID string // Message ID of the deferred response once filled in
+}
+
+var (
+	_ channels.Channel = (*interactionReply)(nil)
+	_ channels.Editor  = (*interactionReply)(nil)
+	_ channels.Merger  = (*interactionReply)(nil)
+)
+
+func (b *Bot) interactionReply(i *discordgo.Interaction) *interactionReply {
+	return &interactionReply{bot: b, interaction: i}
+}
+
+func (r *interactionReply) Name() string                        { return r.bot.Name() }
+func (r *interactionReply) Capabilities() channels.Capabilities { return r.bot.Capabilities() }
+func (r *interactionReply) Start() error                        { return nil }
+func (r *interactionReply) Stop() error                         { return nil }
+
+// Typing does nothing: Discord shows the deferred response as thinking
+func (r *interactionReply) Typing(chatID string) error { return nil }
+
+// Send fills in the deferred response, or sends a follow-up once it is
+func (r *interactionReply) Send(out channels.Outbound) (string, error) {
+	var files []*discordgo.File
+	if out.Attachment != nil {
+		files = []*discordgo.File{{
+			Name:   out.Attachment.Name,
+			Reader: bytes.NewReader(out.Attachment.Data),
+		}}
+	}
+
+	text := content(out)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var msg *discordgo.Message
+	var err error
+	if r.originalID == "" {
+		msg, err = r.bot.Session.InteractionResponseEdit(r.interaction, &discordgo.WebhookEdit{Content: &text, Files: files})
+		if err == nil {
+			r.originalID = msg.ID
+		}
+	} else {
+		msg, err = r.bot.Session.FollowupMessageCreate(r.interaction, true, &discordgo.WebhookParams{Content: text, Files: files})
+	}
+	if err != nil {
+		return "", retryAfter(err)
+	}
+
+	if out.Regenerate {
+		r.bot.Session.MessageReactionAdd(r.interaction.ChannelID, msg.ID, regenerateEmoji)
+	}
+	return msg.ID, nil
+}
+
+// Merged fills in the deferred response when the prompt is answered along
+// with a later one, so it doesn't stay "thinking…"
+func (r *interactionReply) Merged(chatID string) {
+	if _, err := r.Send(channels.Outbound{ChatID: chatID, Text: channels.MergedMessage}); err != nil {
+		log.Printf("Failed to acknowledge merged Discord interaction: %v", err)
+	}
+}
+
+// Edit replaces the text of the response or one of its follow-ups
+func (r *interactionReply) Edit(chatID, messageID string, out channels.Outbound) error {
+	r.mu.Lock()
+	original := messageID == r.originalID
+	r.mu.Unlock()
+
+	text := content(out)
+	edit := &discordgo.WebhookEdit{Content: &text}
+	var err error
+	if original {
+		_, err = r.bot.Session.InteractionResponseEdit(r.interaction, edit, discordgo.WithRetryOnRatelimit(false))
+	} else {
+		_, err = r.bot.Session.FollowupMessageEdit(r.interaction, messageID, edit, discordgo.WithRetryOnRatelimit(false))
+	}
+	if err != nil {
+		return retryAfter(err)
+	}
+
+	if out.Regenerate {
+		r.bot.Session.MessageReactionAdd(r.interaction.ChannelID, messageID, regenerateEmoji)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+func newTestBot(t *testing.T, agents []configs.AgentConfig) *Bot {
+	t.Helper()
+	bot, err := New(Config{Token: "test", Agents: agents}, session.NewManager(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bot
+}
+
+func agentList(n int) []configs.AgentConfig {
+	agents := make([]configs.AgentConfig, n)
+	for i := range agents {
+		agents[i] = configs.AgentConfig{ID: fmt.Sprintf("a%d", i)}
+	}
+	return agents
+}
+
+func TestSwitchAgent(t *testing.T) {
+	coder := configs.AgentConfig{ID: "coder", Name: "Coder", SystemPrompt: "Write code."}
+
+	tests := []struct {
+		name   string
+		agents []configs.AgentConfig
+		id     string
+		reply  string
+		agent  string // Session agent afterwards
+	}{
+		{"current", []configs.AgentConfig{coder}, "", "Current agent: `main`", ""},
+		{"switch", []configs.AgentConfig{coder}, "coder", "Switched to agent `coder`", "coder"},
+		{"unknown", []configs.AgentConfig{coder}, "writer", "Unknown agent `writer`. Available: `coder`", ""},
+		{"none configured", nil, "coder", "No agents are configured", ""},
+		{"too many for choices", agentList(30), "a29", "Switched to agent `a29`", "a29"},
+		{"too many, unknown", agentList(30), "a30", "Unknown agent `a30`", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bot := newTestBot(t, tt.agents)
+			if reply := bot.switchAgent("discord_1", tt.id); !strings.Contains(reply, tt.reply) {
+				t.Errorf("replied %q, want %q", reply, tt.reply)
+			}
+			agent := ""
+			if sess, ok := bot.Sessions.Get("discord_1"); ok {
+				agent = sess.AgentID
+			}
+			if tt.agent != "" && agent != tt.agent {
+				t.Errorf("session agent %q, want %q", agent, tt.agent)
+			}
+			if tt.agent == "" && agent != "" && agent != "main" {
+				t.Errorf("session switched to %q", agent)
+			}
+		})
+	}
+}
+
+func TestAgentChoices(t *testing.T) {
+	choices := func(bot *Bot) int {
+		for _, cmd := range bot.applicationCommands() {
+			if cmd.Name == "agent" {
+				return len(cmd.Options[0].Choices)
+			}
+		}
+		t.Fatal("no /agent command")
+		return 0
+	}
+
+	bot := newTestBot(t, []configs.AgentConfig{{ID: "coder", Name: "Coder"}, {ID: "main"}})
+	if n := choices(bot); n != 2 {
+		t.Errorf("%d choices, want 2", n)
+	}
+	for _, cmd := range bot.applicationCommands() {
+		if cmd.Name == "agent" {
+			if c := cmd.Options[0].Choices[0]; c.Name != "Coder" || c.Value != "coder" {
+				t.Errorf("choice %+v", c)
+			}
+		}
+	}
+	if n := choices(newTestBot(t, agentList(26))); n != 0 {
+		t.Errorf("%d choices beyond Discord's limit", n)
+	}
+}
@@ -0,0 +1,72 @@
+package discord
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// media downloads the images and documents attached to a message. It
+// returns the names of attachments it had to skip.
+func (b *Bot) media(m *discordgo.MessageCreate) ([]channels.Media, []string) {
+	var media []channels.Media
+	var skipped []string
+	for _, a := range m.Attachments {
+		if channels.IsAudio(a.ContentType) {
+			continue // Transcribed instead
+		}
+		kind := channels.MediaKind(a.ContentType)
+		if kind == "" || a.Size > channels.MaxMediaBytes {
+			skipped = append(skipped, a.Filename)
+			continue
+		}
+
+		data, err := channels.Download(a.URL, channels.MaxMediaBytes)
+		if err != nil {
+			log.Printf("Failed to download Discord attachment %s: %v", a.Filename, err)
+			skipped = append(skipped, a.Filename)
+			continue
+		}
+		media = append(media, channels.Media{
+			Attachment: session.Attachment{
+				Type:      kind,
+				MediaType: a.ContentType,
+				Name:      a.Filename,
+				Ref:       a.URL,
+				Size:      len(data),
+			},
+			Data: data,
+		})
+	}
+	return media, skipped
+}
+
+// transcribe turns audio attachments, such as voice messages, into text.
+// ok is false when there was audio that could not be transcribed; the
+// user has been told why.
+func (b *Bot) transcribe(m *discordgo.MessageCreate, chatID, replyTo string) (string, bool) {
+	var texts []string
+	for _, a := range m.Attachments {
+		if !channels.IsAudio(a.ContentType) {
+			continue
+		}
+		audio := session.Attachment{MediaType: a.ContentType, Name: a.Filename, Ref: a.URL, Size: a.Size}
+		text, ok := b.Router.Transcribe(b, chatID, replyTo, audio, func() ([]byte, error) {
+			return channels.Download(a.URL, channels.MaxAudioBytes)
+		})
+		if !ok {
+			return "", false
+		}
+		texts = append(texts, text)
+	}
+	return strings.Join(texts, "\n"), true
+}
+
+// Fetch downloads an attachment again from its CDN URL. Discord signs
+// these URLs, so this only works until they expire.
+func (b *Bot) Fetch(ref string) ([]byte, error) {
+	return channels.Download(ref, channels.MaxMediaBytes)
+}
@@ -0,0 +1,90 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Session modes: how guild conversations map to sessions
+const (
+	SessionPerChannel = "channel" // Everyone in a channel shares a session (default)
+	SessionPerUser    = "user"    // Each user has their own session in a channel
+	SessionPerThread  = "thread"  // Mentions start a thread with its own session
+)
+
+// threadArchiveMinutes are the auto-archive durations Discord accepts
+var threadArchiveMinutes = map[int]bool{60: true, 1440: true, 4320: true, 10080: true}
+
+// maxThreadName keeps thread titles short; Discord allows 100 characters
+const maxThreadName = 60
+
+// threadInfo is what the bot knows about a channel
+type threadInfo struct {
+	thread bool // The channel is a thread
+	own    bool // The bot started it
+}
+
+// isBotThread reports whether a channel is a thread the bot started for a
+// conversation
+func (b *Bot) isBotThread(channelID string) bool {
+	if b.Config.SessionMode != SessionPerThread {
+		return false
+	}
+	return b.threadInfo(channelID).own
+}
+
+// isThread reports whether a channel is a thread of any kind
+func (b *Bot) isThread(channelID string) bool {
+	return b.threadInfo(channelID).thread
+}
+
+// threadInfo looks a channel up in the gateway state or the API. Answers
+// are cached; a channel never changes either way.
+func (b *Bot) threadInfo(channelID string) threadInfo {
+	if v, ok := b.threads.Load(channelID); ok {
+		return v.(threadInfo)
+	}
+
+	ch, err := b.Session.State.Channel(channelID)
+	if err != nil {
+		if ch, err = b.Session.Channel(channelID); err != nil {
+			return threadInfo{}
+		}
+	}
+	info := threadInfo{thread: ch.IsThread(), own: ch.IsThread() && ch.OwnerID == b.Session.State.User.ID}
+	b.threads.Store(channelID, info)
+	return info
+}
+
+// startThread starts a conversation thread from a message and returns its
+// channel ID. Discord archives it after ThreadArchiveMinutes of inactivity.
+func (b *Bot) startThread(m *discordgo.MessageCreate, content string) (string, error) {
+	minutes := b.Config.ThreadArchiveMinutes
+	if !threadArchiveMinutes[minutes] {
+		minutes = 60
+	}
+
+	thread, err := b.Session.MessageThreadStartComplex(m.ChannelID, m.ID, &discordgo.ThreadStart{
+		Name:                threadName(content, m.Author.Username),
+		AutoArchiveDuration: minutes,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start thread: %w", err)
+	}
+	b.threads.Store(thread.ID, threadInfo{thread: true, own: true})
+	return thread.ID, nil
+}
+
+// threadName titles a thread after the message that started it
+func threadName(content, username string) string {
+	name := strings.Join(strings.Fields(content), " ")
+	if name == "" {
+		return "Chat with " + username
+	}
+	if r := []rune(name); len(r) > maxThreadName {
+		name = string(r[:maxThreadName-1]) + "…"
+	}
+	return name
+}
@@ -0,0 +1,54 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSessionKey(t *testing.T) {
+	tests := []struct {
+		mode    string
+		guild   string
+		channel string
+		want    string
+	}{
+		{"", "g1", "c1", "discord_g1_c1"},
+		{SessionPerChannel, "g1", "c1", "discord_g1_c1"},
+		{SessionPerUser, "g1", "c1", "discord_g1_c1_u1"},
+		{SessionPerThread, "g1", "t1", "discord_g1_t1"}, // The thread is the channel
+		{"", "", "dm1", "discord_dm_u1"},
+		{SessionPerUser, "", "dm1", "discord_dm_u1"},
+		{SessionPerThread, "", "dm1", "discord_dm_u1"},
+	}
+	for _, tt := range tests {
+		b := &Bot{Config: Config{SessionMode: tt.mode}}
+		if got := b.sessionKey(tt.guild, tt.channel, "u1"); got != tt.want {
+			t.Errorf("mode %q, guild %q: %q, want %q", tt.mode, tt.guild, got, tt.want)
+		}
+	}
+}
+
+func TestThreadName(t *testing.T) {
+	long := strings.Repeat("ab ", 40)
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"How do I   reverse\na list?", "How do I reverse a list?"},
+		{"  \n ", "Chat with bob"},
+		{"", "Chat with bob"},
+		{long, strings.TrimSpace(long)[:maxThreadName-1] + "…"},
+		{strings.Repeat("é", maxThreadName), strings.Repeat("é", maxThreadName)},
+		{strings.Repeat("é", maxThreadName+1), strings.Repeat("é", maxThreadName-1) + "…"},
+	}
+	for _, tt := range tests {
+		got := threadName(tt.content, "bob")
+		if got != tt.want {
+			t.Errorf("threadName(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+		if n := utf8.RuneCountInString(got); n > maxThreadName {
+			t.Errorf("threadName(%q) is %d characters", tt.content, n)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package markdown
+
+import "strings"
+
+// Discord renders markdown for Discord, which reads most CommonMark
+// itself. Tables become code blocks, deep headings bold text and images
+// links; everything else is written back as it came.
+func Discord(src string) string {
+	return render(src, discord{})
+}
+
+type discord struct{}
+
+func (discord) text(s string) string    { return s }
+func (discord) escaped(c string) string { return "\\" + c }
+func (discord) code(s string) string {
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+func (discord) bold(s string) string   { return "**" + s + "**" }
+func (discord) italic(s string) string { return "*" + s + "*" }
+func (discord) strike(s string) string { return "~~" + s + "~~" }
+func (discord) rule() string           { return "———" }
+
+func (discord) link(text, url string) string {
+	if text == url {
+		return "<" + url + ">"
+	}
+	return "[" + text + "](<" + url + ">)"
+}
+
+func (discord) pre(lang, code string) string {
+	return "```" + lang + "\n" + code + "\n```"
+}
+
+// heading keeps the three levels Discord renders
+func (discord) heading(level int, s string) string {
+	if level > 3 {
+		return "**" + s + "**"
+	}
+	return strings.Repeat("#", level) + " " + s
+}
+
+func (discord) quote(lines []string) string {
+	return "> " + strings.Join(lines, "\n> ")
+}
+
+func (discord) bullet(indent, marker, s string) string {
+	if marker == "•" {
+		marker = "-"
+	}
+	return indent + marker + " " + s
+}
+
+func (discord) table(lines []string) string {
+	return "```\n" + strings.Join(lines, "\n") + "\n```"
+}
@@ -0,0 +1,292 @@
+// Package markdown renders the CommonMark that LLMs write in the markup
+// of chat platforms: Telegram's MarkdownV2 and HTML, and Discord's
+// markdown. It understands the subset answers use in practice (code,
+// emphasis, links, headings, lists, quotes and tables) and renders
+// unfinished markup literally, so partial answers can be shown while they
+// stream.
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// renderer writes parsed markdown in one dialect
+type renderer interface {
+	text(s string) string    // Literal text
+	escaped(c string) string // A character the source escaped with a backslash
+	code(s string) string
+	bold(s string) string
+	italic(s string) string
+	strike(s string) string
+	link(text, url string) string
+
+	pre(lang, code string) string // Code block; code has no trailing newline
+	heading(level int, s string) string
+	quote(lines []string) string
+	bullet(indent, marker, s string) string // marker is "•" or e.g. "1."
+	table(lines []string) string
+	rule() string
+}
+
+var (
+	fenceLine   = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([^`\\s]*)")
+	headingLine = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	ruleLine    = regexp.MustCompile(`^\s{0,3}([-*_])(\s*([-*_])){2,}\s*$`)
+	bulletLine  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedLine = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	quoteLine   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	tableLine   = regexp.MustCompile(`^\s*\|`)
+)
+
+// render renders a document block by block. Lines keep their breaks,
+// since chat messages show them as written.
+func render(src string, r renderer) string {
+	lines := strings.Split(src, "\n")
+	out := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		if m := fenceLine.FindStringSubmatch(line); m != nil {
+			// A code block runs to its closing fence, or to the end of an
+			// answer still being written
+			fence := m[1]
+			var code []string
+			for i++; i < len(lines); i++ {
+				if closing := strings.TrimSpace(lines[i]); strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			out = append(out, r.pre(m[2], strings.Join(code, "\n")))
+			continue
+		}
+
+		if tableLine.MatchString(line) {
+			var rows []string
+			for ; i < len(lines) && tableLine.MatchString(lines[i]); i++ {
+				rows = append(rows, strings.TrimSpace(lines[i]))
+			}
+			i--
+			out = append(out, r.table(rows))
+			continue
+		}
+
+		if quoteLine.MatchString(line) {
+			var quoted []string
+			for ; i < len(lines); i++ {
+				m := quoteLine.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				quoted = append(quoted, inline(m[1], r))
+			}
+			i--
+			out = append(out, r.quote(quoted))
+			continue
+		}
+
+		switch {
+		case ruleLine.MatchString(line):
+			out = append(out, r.rule())
+		case headingLine.MatchString(line):
+			m := headingLine.FindStringSubmatch(line)
+			out = append(out, r.heading(len(m[1]), inline(m[2], r)))
+		case bulletLine.MatchString(line):
+			m := bulletLine.FindStringSubmatch(line)
+			out = append(out, r.bullet(m[1], "•", inline(m[2], r)))
+		case orderedLine.MatchString(line):
+			m := orderedLine.FindStringSubmatch(line)
+			out = append(out, r.bullet(m[1], m[2]+".", inline(m[3], r)))
+		default:
+			out = append(out, inline(line, r))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// inline renders the spans in a line of text
+func inline(s string, r renderer) string {
+	var out, lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			out.WriteString(r.text(lit.String()))
+			lit.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			flush()
+			out.WriteString(r.escaped(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			if end := strings.Index(rest[ticks:], rest[:ticks]); end >= 0 {
+				flush()
+				out.WriteString(r.code(strings.TrimSpace(rest[ticks : ticks+end])))
+				i += 2*ticks + end
+				continue
+			}
+			lit.WriteString(rest[:ticks])
+			i += ticks
+			continue
+
+		case c == '[' || (c == '!' && strings.HasPrefix(rest, "![")):
+			start := 1
+			if c == '!' {
+				start = 2
+			}
+			if text, url, n, ok := parseLink(rest, start); ok {
+				flush()
+				if text == "" {
+					text = url
+				}
+				out.WriteString(r.link(inline(text, r), url))
+				i += n
+				continue
+			}
+
+		case c == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 && isURL(rest[1:end]) {
+				flush()
+				url := rest[1:end]
+				out.WriteString(r.link(r.text(url), url))
+				i += end + 1
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if n, body, wrap, ok := emphasis(s, i, r); ok {
+				flush()
+				out.WriteString(wrap(inline(body, r)))
+				i += n
+				continue
+			}
+		}
+
+		lit.WriteByte(c)
+		i++
+	}
+	flush()
+	return out.String()
+}
+
+// emphasis parses bold, italic or strikethrough starting at s[i]. It
+// returns the length consumed, the inner text and how to wrap it.
+func emphasis(s string, i int, r renderer) (int, string, func(string) string, bool) {
+	rest := s[i:]
+	var delim string
+	var wrap func(string) string
+	switch {
+	case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"):
+		delim, wrap = rest[:2], r.bold
+	case strings.HasPrefix(rest, "~~"):
+		delim, wrap = "~~", r.strike
+	case rest[0] == '*' || rest[0] == '_':
+		delim, wrap = rest[:1], r.italic
+	default:
+		return 0, "", nil, false
+	}
+
+	// Underscores inside words, as in snake_case, are literal
+	if delim[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0, "", nil, false
+	}
+	body := rest[len(delim):]
+	if body == "" || body[0] == ' ' {
+		return 0, "", nil, false
+	}
+
+	for from := 0; ; {
+		end := strings.Index(body[from:], delim)
+		if end < 0 {
+			return 0, "", nil, false
+		}
+		end += from
+		after := end + len(delim)
+		closes := end > 0 && body[end-1] != ' '
+		if delim[0] == '_' && after < len(body) && isWordByte(body[after]) {
+			closes = false
+		}
+		// A single * is not closed by half of a **
+		if len(delim) == 1 && after < len(body) && body[after] == delim[0] {
+			closes = false
+			after++
+		}
+		if closes {
+			return len(delim) + end + len(delim), body[:end], wrap, true
+		}
+		from = after
+	}
+}
+
+// parseLink parses [text](url) with the text starting at start. It returns
+// the text, the URL and the length consumed.
+func parseLink(s string, start int) (string, string, int, bool) {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := closingParen(s[i+2:])
+			if end < 0 {
+				return "", "", 0, false
+			}
+			url := strings.TrimSpace(s[i+2 : i+2+end])
+			if title := strings.IndexByte(url, ' '); title >= 0 {
+				url = url[:title] // Drop "title"
+			}
+			if url == "" {
+				return "", "", 0, false
+			}
+			return s[start:i], url, i + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+// closingParen finds the ) ending a link destination, which may itself
+// contain balanced parentheses
+func closingParen(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func isURL(s string) bool {
+	return (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) && !strings.ContainsAny(s, " \t<")
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
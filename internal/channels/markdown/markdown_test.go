@@ -0,0 +1,66 @@
+package markdown
+
+import "testing"
+
+func TestTelegramHTML(t *testing.T) {
+	tests := map[string]string{
+		"**bold** and *it* and ~~gone~~":     "<b>bold</b> and <i>it</i> and <s>gone</s>",
+		"a < b & `x<y>`":                     "a &lt; b &amp; <code>x&lt;y&gt;</code>",
+		"see [docs](https://x.io/a?b=1&c=2)": `see <a href="https://x.io/a?b=1&amp;c=2">docs</a>`,
+		"## Title":                           "<b>Title</b>",
+		"- one\n  - two\n3. three":           "• one\n  • two\n3. three",
+		"> quoted\n> **more**":               "<blockquote>quoted\n<b>more</b></blockquote>",
+		"```go\nif a < b {}\n```":            `<pre><code class="language-go">if a &lt; b {}</code></pre>`,
+		"```\nstill streaming":               "<pre>still streaming</pre>",
+		"| a | b |\n|---|---|\n| 1 | 2 |":    "<pre>| a | b |\n|---|---|\n| 1 | 2 |</pre>",
+		"snake_case_name and 2*3*4":          "snake_case_name and 2<i>3</i>4",
+		"**unfinished":                       "**unfinished",
+		`\*not italic\*`:                     "*not italic*",
+		"---":                                "———",
+		"**bold *nested* bold**":             "<b>bold <i>nested</i> bold</b>",
+		"<https://example.com>":              `<a href="https://example.com">https://example.com</a>`,
+		"![chart](https://x.io/c.png)":       `<a href="https://x.io/c.png">chart</a>`,
+	}
+	for src, want := range tests {
+		if got := TelegramHTML(src); got != want {
+			t.Errorf("TelegramHTML(%q) =\n%s\nwant\n%s", src, got, want)
+		}
+	}
+}
+
+func TestTelegramMarkdownV2(t *testing.T) {
+	tests := map[string]string{
+		"**Note:** 1+1=2. Done!":     `*Note:* 1\+1\=2\. Done\!`,
+		"use `a_b()` here":           "use `a_b()` here",
+		"[site](https://x.io/a_(b))": `[site](https://x.io/a_(b\))`,
+		"```py\nprint(`x`)\n```":     "```py\nprint(\\`x\\`)\n```",
+		"1. first\n- (second)":       "1\\. first\n• \\(second\\)",
+		"> hi.":                      ">hi\\.",
+		"# Big *deal*":               "*Big _deal_*",
+		"**open":                     `\*\*open`,
+		"path\\to\\file":             `path\\to\\file`,
+	}
+	for src, want := range tests {
+		if got := TelegramMarkdownV2(src); got != want {
+			t.Errorf("TelegramMarkdownV2(%q) =\n%s\nwant\n%s", src, got, want)
+		}
+	}
+}
+
+func TestDiscord(t *testing.T) {
+	tests := map[string]string{
+		"**bold** _it_ `code`":          "**bold** *it* `code`",
+		"#### Deep":                     "**Deep**",
+		"### Kept":                      "### Kept",
+		"* item":                        "- item",
+		"[a](https://x.io)":             "[a](<https://x.io>)",
+		"| a |\n| - |":                  "```\n| a |\n| - |\n```",
+		"-# gpt · 10 in / 5 out tokens": "-# gpt · 10 in / 5 out tokens",
+		`\*literal\*`:                   `\*literal\*`,
+	}
+	for src, want := range tests {
+		if got := Discord(src); got != want {
+			t.Errorf("Discord(%q) =\n%s\nwant\n%s", src, got, want)
+		}
+	}
+}
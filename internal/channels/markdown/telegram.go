@@ -0,0 +1,103 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// TelegramHTML renders markdown for Telegram's HTML parse mode
+func TelegramHTML(src string) string {
+	return render(src, telegramHTML{})
+}
+
+// TelegramMarkdownV2 renders markdown for Telegram's MarkdownV2 parse mode,
+// escaping every character it reserves
+func TelegramMarkdownV2(src string) string {
+	return render(src, telegramV2{})
+}
+
+type telegramHTML struct{}
+
+func (telegramHTML) text(s string) string    { return html.EscapeString(s) }
+func (telegramHTML) escaped(c string) string { return html.EscapeString(c) }
+func (telegramHTML) code(s string) string    { return "<code>" + html.EscapeString(s) + "</code>" }
+func (telegramHTML) bold(s string) string    { return "<b>" + s + "</b>" }
+func (telegramHTML) italic(s string) string  { return "<i>" + s + "</i>" }
+func (telegramHTML) strike(s string) string  { return "<s>" + s + "</s>" }
+func (telegramHTML) rule() string            { return "———" }
+
+func (telegramHTML) link(text, url string) string {
+	return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+}
+
+func (telegramHTML) pre(lang, code string) string {
+	if lang == "" {
+		return "<pre>" + html.EscapeString(code) + "</pre>"
+	}
+	return `<pre><code class="language-` + html.EscapeString(lang) + `">` + html.EscapeString(code) + "</code></pre>"
+}
+
+func (telegramHTML) heading(level int, s string) string {
+	return "<b>" + s + "</b>"
+}
+
+func (telegramHTML) quote(lines []string) string {
+	return "<blockquote>" + strings.Join(lines, "\n") + "</blockquote>"
+}
+
+func (telegramHTML) bullet(indent, marker, s string) string {
+	return indent + marker + " " + s
+}
+
+func (telegramHTML) table(lines []string) string {
+	return "<pre>" + html.EscapeString(strings.Join(lines, "\n")) + "</pre>"
+}
+
+// v2Reserved are the characters MarkdownV2 requires escaping in text
+const v2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+type telegramV2 struct{}
+
+func (telegramV2) text(s string) string    { return escapeV2(s, v2Reserved) }
+func (telegramV2) escaped(c string) string { return escapeV2(c, v2Reserved) }
+func (telegramV2) code(s string) string    { return "`" + escapeV2(s, "`\\") + "`" }
+func (telegramV2) bold(s string) string    { return "*" + s + "*" }
+func (telegramV2) italic(s string) string  { return "_" + s + "_" }
+func (telegramV2) strike(s string) string  { return "~" + s + "~" }
+func (telegramV2) rule() string            { return "———" }
+
+func (telegramV2) link(text, url string) string {
+	return "[" + text + "](" + escapeV2(url, ")\\") + ")"
+}
+
+func (telegramV2) pre(lang, code string) string {
+	return "```" + lang + "\n" + escapeV2(code, "`\\") + "\n```"
+}
+
+func (telegramV2) heading(level int, s string) string {
+	return "*" + s + "*"
+}
+
+func (telegramV2) quote(lines []string) string {
+	return ">" + strings.Join(lines, "\n>")
+}
+
+func (telegramV2) bullet(indent, marker, s string) string {
+	return indent + escapeV2(marker, v2Reserved) + " " + s
+}
+
+func (telegramV2) table(lines []string) string {
+	return "```\n" + escapeV2(strings.Join(lines, "\n"), "`\\") + "\n```"
+}
+
+// escapeV2 backslash-escapes the reserved characters in s
+func escapeV2(s, reserved string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 0x80 && strings.ContainsRune(reserved, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
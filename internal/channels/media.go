@@ -0,0 +1,188 @@
+package channels
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// Media limits
+const (
+	MaxMediaBytes     = 5 << 20   // Largest file read from a user, matching Claude's image limit
+	maxTextDocument   = 100 << 10 // Largest text document inlined into a message
+	defaultMediaCache = 64 << 20
+	mediaFetchTimeout = 30 * time.Second
+)
+
+// Media is a file a user sent with a message. Sessions keep only its
+// Attachment reference. Data may be left nil by channels that implement
+// MediaFetcher; the file is then downloaded when its turn runs.
+type Media struct {
+	session.Attachment
+	Data []byte
+}
+
+// MediaFetcher is implemented by channels that can download a file again
+// from its reference, so older attachments stay visible to the LLM after
+// the router has forgotten their bytes
+type MediaFetcher interface {
+	Fetch(ref string) ([]byte, error)
+}
+
+// imageTypes are the image formats the LLM providers accept
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// MediaKind classifies a file by its media type: llm.PartImage,
+// llm.PartDocument for PDFs and text, or "" when it can't be sent to the
+// LLM
+func MediaKind(mediaType string) string {
+	mediaType, _, _ = strings.Cut(strings.ToLower(mediaType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch {
+	case imageTypes[mediaType]:
+		return llm.PartImage
+	case mediaType == "application/pdf", strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json":
+		return llm.PartDocument
+	}
+	return ""
+}
+
+// Download fetches a file over HTTP, failing if it is larger than limit
+// bytes
+func Download(url string, limit int) ([]byte, error) {
+	client := &http.Client{Timeout: mediaFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > int64(limit) {
+		return nil, fmt.Errorf("file too large: %d bytes", resp.ContentLength)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("file too large: over %d bytes", limit)
+	}
+	return data, nil
+}
+
+// SkippedNote describes files that were not passed on, to append to the
+// user's message so the LLM knows about them
+func SkippedNote(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[Attachments not supported or too large: %s]", strings.Join(names, ", "))
+}
+
+// mediaCache keeps the bytes of recent attachments, evicting the oldest
+// once it holds more than max bytes
+type mediaCache struct {
+	mu    sync.Mutex
+	max   int
+	size  int
+	data  map[string][]byte
+	order []string
+}
+
+func (c *mediaCache) get(ref string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.data[ref]
+	return data, ok
+}
+
+func (c *mediaCache) put(ref string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.data == nil {
+		c.data = make(map[string][]byte)
+	}
+	if c.max == 0 {
+		c.max = defaultMediaCache
+	}
+	if _, ok := c.data[ref]; ok || len(data) > c.max {
+		return
+	}
+
+	c.data[ref] = data
+	c.order = append(c.order, ref)
+	c.size += len(data)
+	for c.size > c.max {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= len(c.data[oldest])
+		delete(c.data, oldest)
+	}
+}
+
+// parts turns a message's attachments into LLM content parts. Files whose
+// bytes are gone, or that have no reference (such as imported ones), become
+// a note instead.
+func (r *Router) parts(ch Channel, attachments []session.Attachment) []llm.Part {
+	var parts []llm.Part
+	for _, a := range attachments {
+		data, ok := r.media.get(a.Ref)
+		if !ok {
+			if fetcher, can := ch.(MediaFetcher); can && a.Ref != "" {
+				var err error
+				if data, err = fetcher.Fetch(a.Ref); err != nil {
+					log.Printf("Failed to fetch %s attachment %s: %v", ch.Name(), a.Name, err)
+				} else {
+					r.media.put(a.Ref, data)
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			parts = append(parts, llm.Part{Type: llm.PartText, Text: fmt.Sprintf("[Attached %s %s is no longer available]", a.Type, a.Name)})
+			continue
+		}
+		parts = append(parts, mediaPart(a, data))
+	}
+	return parts
+}
+
+// mediaPart builds the LLM part for a file. Images and PDFs are sent as
+// is; text documents are inlined.
+func mediaPart(a session.Attachment, data []byte) llm.Part {
+	if a.Type == llm.PartImage || strings.HasPrefix(a.MediaType, "application/pdf") {
+		return llm.Part{
+			Type:      a.Type,
+			MediaType: a.MediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+			Name:      a.Name,
+		}
+	}
+
+	text := string(data)
+	if len(text) > maxTextDocument {
+		text = strings.ToValidUTF8(text[:maxTextDocument], "") + "\n[truncated]"
+	}
+	fence := "```" + strings.TrimPrefix(path.Ext(a.Name), ".")
+	return llm.Part{Type: llm.PartText, Text: fmt.Sprintf("Contents of %s:\n%s\n%s\n```", a.Name, fence, text)}
+}
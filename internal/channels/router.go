@@ -0,0 +1,349 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+	"github.com/nanilabs/hiveclaw/internal/voice"
+)
+
+// Replies the router sends on its own
+const (
+	BusyMessage   = "⏳ I'm still working on your previous messages. Please wait a moment."
+	PausedMessage = "A team member is handling this conversation right now."
+	ErrorMessage  = "❌ Sorry, I encountered an error. Please try again."
+	MergedMessage = "↪️ Answered together with your next message."
+)
+
+// DefaultTimeout bounds how long the router waits for one answer
+const DefaultTimeout = 5 * time.Minute
+
+// Router runs conversations for channels: it queues turns, records
+// messages, calls the LLM and sends the answers back through the channel
+// they came from.
+type Router struct {
+	Sessions *session.Manager
+	LLM      llm.Provider
+	System   string // System prompt for every conversation
+	Model    string // Model to ask; the provider's default when empty
+	Stream   bool   // Stream answers into channels that can edit messages
+	Footer   bool   // End streamed answers with the model and token usage
+
+	// Agents sessions can switch to. A session's agent (its AgentID) answers
+	// with its own system prompt and model where set, and System and Model
+	// otherwise.
+	Agents []configs.AgentConfig
+
+	// Timeout cancels an answer that takes longer; DefaultTimeout when zero
+	Timeout time.Duration
+
+	// Voice messages are transcribed with STT; nil refuses them.
+	// EchoTranscript shows users what was heard.
+	STT            voice.Transcriber
+	EchoTranscript bool
+
+	// Guards System and Model once the router is in use, and the usage
+	// totals
+	mu    sync.Mutex
+	turns int
+	usage llm.Usage
+
+	media   mediaCache
+	pending map[string][]session.Attachment // Attachments of merged turns, by session
+}
+
+// NewRouter creates a conversation router
+func NewRouter(sessions *session.Manager, provider llm.Provider, system string) *Router {
+	return &Router{
+		Sessions: sessions,
+		LLM:      provider,
+		System:   system,
+		Stream:   true,
+	}
+}
+
+// Handle queues an inbound user message as a turn in its session and
+// answers it once earlier turns are done. Each turn records its own media;
+// a turn merged into a later one passes its media on to it.
+func (r *Router) Handle(ch Channel, in Inbound) {
+	attachments := r.cache(in.Media)
+	err := r.Sessions.Turns.Submit(in.SessionID, in.Text, func(text string) {
+		r.Sessions.GetOrCreate(in.SessionID)
+		r.Sessions.AddMessageWithAttachments(in.SessionID, "user", text, append(r.take(in.SessionID), attachments...))
+		r.respond(ch, in.SessionID, in.ChatID, in.ReplyTo)
+	}, func() {
+		r.hold(in.SessionID, attachments)
+		if m, ok := ch.(Merger); ok {
+			m.Merged(in.ChatID)
+		}
+	})
+	if errors.Is(err, session.ErrBusy) {
+		r.Send(ch, Outbound{ChatID: in.ChatID, Text: BusyMessage, ReplyTo: in.ReplyTo})
+	}
+}
+
+// Regenerate replaces the last answer in a session with a new one
+func (r *Router) Regenerate(ch Channel, sessionID, chatID string) {
+	r.exclusive(ch, sessionID, chatID, func() {
+		if r.Sessions.Paused(sessionID) {
+			r.Send(ch, Outbound{ChatID: chatID, Text: PausedMessage})
+			return
+		}
+		head, err := r.Sessions.Regenerate(sessionID)
+		if err != nil {
+			r.Send(ch, Outbound{ChatID: chatID, Text: "Nothing to regenerate yet."})
+			return
+		}
+		if err := r.respond(ch, sessionID, chatID, ""); err != nil {
+			// Keep the previous answer rather than none
+			r.Sessions.Checkout(sessionID, head)
+		}
+	})
+}
+
+// EditLast replaces the last user message in a session and answers again
+func (r *Router) EditLast(ch Channel, sessionID, chatID, text string) {
+	r.exclusive(ch, sessionID, chatID, func() {
+		messages, _ := r.Sessions.GetMessages(sessionID)
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role != "user" {
+				continue
+			}
+			if _, err := r.Sessions.Edit(sessionID, messages[i].ID, text); err != nil {
+				log.Printf("Edit error: %v", err)
+				break
+			}
+			r.respond(ch, sessionID, chatID, "")
+			return
+		}
+		r.Send(ch, Outbound{ChatID: chatID, Text: "Nothing to edit yet."})
+	})
+}
+
+// Send delivers a message of any length, split to fit the channel once
+// rendered in its markdown dialect. The reply reference goes on the first
+// part; the attachment and regenerate control go on the last. It returns
+// the platform ID of the last part.
+func (r *Router) Send(ch Channel, out Outbound) (string, error) {
+	caps := ch.Capabilities()
+	if !caps.Attachments {
+		out.Attachment = nil
+	}
+
+	dialect := MarkdownNone
+	if out.Markdown {
+		dialect = caps.Markdown
+	}
+	parts := Split(out.Text, caps.MaxMessageLength, dialect)
+
+	var lastID string
+	var failed error
+	for i, text := range parts {
+		part := Outbound{ChatID: out.ChatID, Text: text, Markdown: out.Markdown}
+		if i == 0 {
+			part.ReplyTo = out.ReplyTo
+		}
+		if i == len(parts)-1 {
+			part.Attachment = out.Attachment
+			part.Regenerate = out.Regenerate
+		}
+
+		id, err := ch.Send(part)
+		if err != nil {
+			log.Printf("Failed to send %s message: %v", ch.Name(), err)
+			failed = err
+			continue
+		}
+		lastID = id
+	}
+	if lastID == "" && failed != nil {
+		return "", fmt.Errorf("failed to send message: %w", failed)
+	}
+	return lastID, failed
+}
+
+// SetSystem changes the system prompt for later answers
+func (r *Router) SetSystem(prompt string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.System = prompt
+}
+
+// SetModel changes the model for later answers
+func (r *Router) SetModel(model string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Model = model
+}
+
+// Usage returns how many answers the router has generated and the tokens
+// they used
+func (r *Router) Usage() (int, llm.Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.turns, r.usage
+}
+
+// Options returns the LLM options answers are generated with, unless the
+// session's agent has its own
+func (r *Router) Options() llm.Options {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return llm.Options{System: r.System, Model: r.Model}
+}
+
+// Agent looks up one of the agents sessions can switch to
+func (r *Router) Agent(id string) (configs.AgentConfig, bool) {
+	for _, agent := range r.Agents {
+		if agent.ID == id {
+			return agent, true
+		}
+	}
+	return configs.AgentConfig{}, false
+}
+
+// answerOptions returns the options for generating one answer in a
+// session, as its agent, with a context that ends after the timeout.
+// cancel must be called once the answer is done so the provider stops
+// streaming.
+func (r *Router) answerOptions(sessionID string) (llm.Options, context.CancelFunc) {
+	opts := r.Options()
+	if sess, ok := r.Sessions.Get(sessionID); ok {
+		if agent, ok := r.Agent(sess.AgentID); ok {
+			if agent.SystemPrompt != "" {
+				opts.System = agent.SystemPrompt
+			}
+			if agent.Model != "" {
+				opts.Model = agent.Model
+			}
+		}
+	}
+
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	opts.Context = ctx
+	return opts, cancel
+}
+
+// record adds an answer's token usage to the totals
+func (r *Router) record(usage *llm.Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.turns++
+	if usage != nil {
+		r.usage.InputTokens += usage.InputTokens
+		r.usage.OutputTokens += usage.OutputTokens
+	}
+}
+
+// cache keeps a message's media for the LLM and returns its attachments
+func (r *Router) cache(media []Media) []session.Attachment {
+	var attachments []session.Attachment
+	for _, m := range media {
+		if m.Data != nil {
+			r.media.put(m.Ref, m.Data)
+		}
+		attachments = append(attachments, m.Attachment)
+	}
+	return attachments
+}
+
+// hold keeps the attachments of a turn merged into a later one until that
+// turn takes them. Merged turns are acknowledged just before the turn they
+// were merged into runs, on the same lane, so nothing else takes them.
+func (r *Router) hold(sessionID string, attachments []session.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending == nil {
+		r.pending = make(map[string][]session.Attachment)
+	}
+	r.pending[sessionID] = append(r.pending[sessionID], attachments...)
+}
+
+// take returns and clears the attachments merged turns left in a session
+func (r *Router) take(sessionID string) []session.Attachment {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	held := r.pending[sessionID]
+	delete(r.pending, sessionID)
+	return held
+}
+
+// exclusive runs fn as a turn of its own in a session
+func (r *Router) exclusive(ch Channel, sessionID, chatID string, fn func()) {
+	if err := r.Sessions.Turns.Do(sessionID, fn); errors.Is(err, session.ErrBusy) {
+		r.Send(ch, Outbound{ChatID: chatID, Text: BusyMessage})
+	}
+}
+
+// respond calls the LLM with the session history, stores the answer and
+// sends it with a regenerate control. It returns the LLM's error when no
+// answer was stored.
+func (r *Router) respond(ch Channel, sessionID, chatID, replyTo string) error {
+	// An operator is answering instead
+	if r.Sessions.Paused(sessionID) {
+		return nil
+	}
+
+	if editor, ok := ch.(Editor); ok && r.Stream {
+		content, err := r.respondStreaming(ch, editor, sessionID, chatID, replyTo)
+		if err != nil {
+			log.Printf("LLM error: %v", err)
+			return err
+		}
+		r.Sessions.AddMessage(sessionID, "assistant", content)
+		return nil
+	}
+
+	stopTyping := keepTyping(ch, chatID)
+	opts, cancel := r.answerOptions(sessionID)
+	defer cancel()
+	resp, err := r.LLM.Chat(r.history(ch, sessionID), opts)
+	stopTyping()
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		r.Send(ch, Outbound{ChatID: chatID, Text: ErrorMessage, ReplyTo: replyTo})
+		return err
+	}
+	r.record(&resp.Usage)
+
+	r.Sessions.AddMessage(sessionID, "assistant", resp.Content)
+
+	r.Send(ch, Outbound{
+		ChatID:     chatID,
+		Text:       resp.Content,
+		ReplyTo:    replyTo,
+		Markdown:   true,
+		Regenerate: true,
+	})
+	return nil
+}
+
+// history converts a session's messages into LLM messages, with the
+// files users sent as content parts
+func (r *Router) history(ch Channel, sessionID string) []llm.Message {
+	messages, _ := r.Sessions.GetMessages(sessionID)
+	llmMessages := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		llmMessages[i] = llm.Message{Role: session.ChatRole(m.Role), Content: m.Content}
+		if len(m.Attachments) > 0 {
+			llmMessages[i].Parts = r.parts(ch, m.Attachments)
+		}
+	}
+	return llmMessages
+}
@@ -0,0 +1,306 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// fakeChannel records what the router sends
+type fakeChannel struct {
+	mu     sync.Mutex
+	sent   []Outbound
+	merged []string
+}
+
+func (c *fakeChannel) Name() string { return "fake" }
+func (c *fakeChannel) Capabilities() Capabilities {
+	return Capabilities{MaxMessageLength: 4096}
+}
+func (c *fakeChannel) Start() error               { return nil }
+func (c *fakeChannel) Stop() error                { return nil }
+func (c *fakeChannel) Typing(chatID string) error { return nil }
+
+func (c *fakeChannel) Send(out Outbound) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, out)
+	return "m", nil
+}
+
+func (c *fakeChannel) texts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var texts []string
+	for _, out := range c.sent {
+		texts = append(texts, out.Text)
+	}
+	return texts
+}
+
+// mergingChannel is a fakeChannel that must acknowledge every message
+type mergingChannel struct{ fakeChannel }
+
+func (c *mergingChannel) Merged(chatID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.merged = append(c.merged, chatID)
+}
+
+type echoLLM struct{}
+
+func (echoLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return &llm.Response{Content: "echo: " + messages[len(messages)-1].Content}, nil
+}
+
+func (echoLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk, 2)
+	ch <- llm.StreamChunk{Content: "echo: " + messages[len(messages)-1].Content}
+	ch <- llm.StreamChunk{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMergedMessagesAreAcknowledged(t *testing.T) {
+	sessions := session.NewManager()
+	sessions.Turns = session.NewTurnQueue(0, 30*time.Millisecond)
+	r := NewRouter(sessions, echoLLM{}, "")
+
+	first, second := &mergingChannel{}, &mergingChannel{}
+	r.Handle(first, Inbound{SessionID: "s1", ChatID: "c1", Text: "one"})
+	r.Handle(second, Inbound{SessionID: "s1", ChatID: "c1", Text: "two"})
+
+	waitFor(t, "the answer", func() bool { return len(second.texts()) == 1 })
+	if got := second.texts()[0]; got != "echo: one\ntwo" {
+		t.Errorf("answered %q", got)
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	if len(first.merged) != 1 || first.merged[0] != "c1" || len(first.sent) != 0 {
+		t.Errorf("first message: merged %v, sent %v", first.merged, first.sent)
+	}
+}
+
+// editorChannel is a fakeChannel that streams answers. Sends fail while
+// failSend is set.
+type editorChannel struct {
+	fakeChannel
+	failSend bool
+}
+
+func (c *editorChannel) Send(out Outbound) (string, error) {
+	if c.failSend {
+		return "", errors.New("send failed")
+	}
+	return c.fakeChannel.Send(out)
+}
+
+func (c *editorChannel) Edit(chatID, messageID string, out Outbound) error { return nil }
+
+// endlessLLM streams until its context ends, then reports that it stopped
+type endlessLLM struct {
+	stopped chan error
+}
+
+func (l endlessLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	<-opts.Context.Done()
+	l.stopped <- opts.Context.Err()
+	return nil, opts.Context.Err()
+}
+
+func (l endlessLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case ch <- llm.StreamChunk{Content: "la "}:
+			case <-opts.Context.Done():
+				l.stopped <- opts.Context.Err()
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func TestAnswersAreCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel Channel
+		timeout time.Duration
+		want    error
+	}{
+		{"placeholder fails", &editorChannel{failSend: true}, time.Minute, context.Canceled},
+		{"answer times out", &fakeChannel{}, 20 * time.Millisecond, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := endlessLLM{stopped: make(chan error, 1)}
+			r := NewRouter(session.NewManager(), l, "")
+			r.Timeout = tt.timeout
+			r.Sessions.CreateWithID("s1", "")
+			r.Sessions.AddMessage("s1", "user", "sing")
+
+			if err := r.respond(tt.channel, "s1", "c1", ""); err == nil {
+				t.Error("no error")
+			}
+			select {
+			case err := <-l.stopped:
+				if err != tt.want {
+					t.Errorf("stopped with %v, want %v", err, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("provider still running")
+			}
+			if sess, _ := r.Sessions.Get("s1"); len(sess.Messages) != 1 {
+				t.Errorf("stored an answer: %+v", sess.Messages)
+			}
+		})
+	}
+}
+
+// recordingLLM answers with the options it was called with
+type recordingLLM struct{}
+
+func (recordingLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return &llm.Response{Content: opts.Model + "|" + opts.System}, nil
+}
+
+func (recordingLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	return nil, errors.New("not streaming")
+}
+
+func TestSessionAgents(t *testing.T) {
+	r := NewRouter(session.NewManager(), recordingLLM{}, "default prompt")
+	r.Model = "default-model"
+	r.Agents = []configs.AgentConfig{
+		{ID: "coder", Model: "big-model", SystemPrompt: "Write code."},
+		{ID: "terse", SystemPrompt: "Be brief."},
+	}
+
+	tests := []struct {
+		agent string
+		want  string
+	}{
+		{"main", "default-model|default prompt"},
+		{"coder", "big-model|Write code."},
+		{"terse", "default-model|Be brief."},
+		{"gone", "default-model|default prompt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.agent, func(t *testing.T) {
+			ch := &fakeChannel{}
+			r.Sessions.CreateWithID(tt.agent, "")
+			r.Sessions.Update(tt.agent, "", tt.agent)
+			r.Handle(ch, Inbound{SessionID: tt.agent, ChatID: "c1", Text: "hi"})
+
+			waitFor(t, "the answer", func() bool { return len(ch.texts()) == 1 })
+			if got := ch.texts()[0]; got != tt.want {
+				t.Errorf("answered with %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPausedSession(t *testing.T) {
+	r := NewRouter(session.NewManager(), echoLLM{}, "")
+	r.Sessions.CreateWithID("s1", "")
+	r.Sessions.Pause("s1", true)
+
+	// Messages are recorded for the operator but not answered
+	ch := &fakeChannel{}
+	r.Handle(ch, Inbound{SessionID: "s1", ChatID: "c1", Text: "anyone there?"})
+	waitFor(t, "the message", func() bool {
+		messages, _ := r.Sessions.GetMessages("s1")
+		return len(messages) == 1
+	})
+	r.Sessions.Turns.Do("s1", func() {})
+	if texts := ch.texts(); len(texts) != 0 {
+		t.Errorf("sent %q while paused", texts)
+	}
+
+	r.Regenerate(ch, "s1", "c1")
+	if texts := ch.texts(); len(texts) != 1 || texts[0] != PausedMessage {
+		t.Errorf("regenerate sent %q", texts)
+	}
+
+	// Handing back answers the next message
+	r.Sessions.Pause("s1", false)
+	r.Handle(ch, Inbound{SessionID: "s1", ChatID: "c1", Text: "hello"})
+	waitFor(t, "the answer", func() bool { return len(ch.texts()) == 2 })
+	if got := ch.texts()[1]; got != "echo: hello" {
+		t.Errorf("answered %q", got)
+	}
+}
+
+func TestMediaStaysWithItsTurn(t *testing.T) {
+	image := func(ref string) []Media {
+		return []Media{{Attachment: session.Attachment{Type: "image", MediaType: "image/png", Ref: ref}, Data: []byte(ref)}}
+	}
+	refs := func(m session.Message) []string {
+		var refs []string
+		for _, a := range m.Attachments {
+			refs = append(refs, a.Ref)
+		}
+		return refs
+	}
+
+	tests := []struct {
+		name     string
+		coalesce time.Duration
+		want     [][]string // Attachments of each stored user message
+	}{
+		{"queued", 0, [][]string{nil, {"img2"}, {"img3"}}},
+		{"merged", 20 * time.Millisecond, [][]string{{"img2", "img3"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := session.NewManager()
+			sessions.Turns = session.NewTurnQueue(0, tt.coalesce)
+			r := NewRouter(sessions, echoLLM{}, "")
+			ch := &fakeChannel{}
+
+			// Queue the messages behind a turn that is still running
+			release := make(chan struct{})
+			started := make(chan struct{})
+			go sessions.Turns.Do("s1", func() { close(started); <-release })
+			<-started
+			r.Handle(ch, Inbound{SessionID: "s1", ChatID: "c1", Text: "one"})
+			r.Handle(ch, Inbound{SessionID: "s1", ChatID: "c1", Text: "two", Media: image("img2")})
+			r.Handle(ch, Inbound{SessionID: "s1", ChatID: "c1", Text: "three", Media: image("img3")})
+			close(release)
+
+			waitFor(t, "the answers", func() bool { return len(ch.texts()) == len(tt.want) })
+			messages, _ := sessions.GetMessages("s1")
+			var got [][]string
+			for _, m := range messages {
+				if m.Role == "user" {
+					got = append(got, refs(m))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("attachments %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
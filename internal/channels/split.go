@@ -0,0 +1,133 @@
+package channels
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// minCut is the shortest part a message is cut into, however much
+// rendering inflates it
+const minCut = 64
+
+// Split breaks text into parts of at most maxLen bytes once rendered in
+// dialect (MarkdownNone for plain text). It prefers to break between
+// lines, moves a code block to the next part rather than cutting it when
+// there is room, closes and reopens one too long for a single part, and
+// never splits a UTF-8 sequence.
+func Split(text string, maxLen int, dialect string) []string {
+	if maxLen <= 0 {
+		return []string{text}
+	}
+
+	var parts []string
+	for len(Render(text, dialect)) > maxLen {
+		head, rest := cut(text, maxLen, dialect)
+		parts = append(parts, head)
+		text = rest
+	}
+	if text == "" && len(parts) > 0 {
+		return parts
+	}
+	return append(parts, text)
+}
+
+// cut takes the longest head of text that renders within maxLen bytes,
+// returning it and the rest. A code block open at the cut moves to the rest
+// when it starts late in the head; otherwise it is closed in the head and
+// reopened, with its language if that leaves room, in the rest. The rest is
+// always shorter than text, so splitting ends.
+func cut(text string, maxLen int, dialect string) (string, string) {
+	limit := maxLen - len("\n"+codeFence)
+	for limit > 0 {
+		head, rest := cutMessage(text, limit)
+		if lang, at, open := openFence(head); open {
+			if moved := strings.TrimRight(head[:at], "\n"); at > 0 && at >= len(head)/4 && moved != "" {
+				// Start the block in the next part instead
+				head, rest = moved, text[at:]
+			} else {
+				if len(codeFence+lang+"\n") > limit/4 {
+					lang = ""
+				}
+				head += "\n" + codeFence
+				rest = codeFence + lang + "\n" + rest
+			}
+		}
+
+		n := len(Render(head, dialect))
+		if n <= maxLen && len(rest) < len(text) {
+			return head, rest
+		}
+		if limit <= minCut {
+			break
+		}
+		if n > maxLen {
+			// Escaping made it longer; cut shorter in proportion
+			limit = max(minCut, limit*maxLen/n-1)
+		} else {
+			// Reopening the block left no room for its contents
+			limit = max(minCut, limit/2)
+		}
+	}
+	return hardCut(text, maxLen, dialect)
+}
+
+// hardCut takes the longest run of whole characters that renders within
+// maxLen bytes, ignoring lines and code blocks. It takes at least one
+// character, however long it renders.
+func hardCut(text string, maxLen int, dialect string) (string, string) {
+	_, best := utf8.DecodeRuneInString(text)
+	lo, hi := best+1, len(text)
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		end := mid
+		for end < len(text) && !utf8.RuneStart(text[end]) {
+			end++
+		}
+		if len(Render(text[:end], dialect)) <= maxLen {
+			best = max(best, end)
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return text[:best], text[best:]
+}
+
+// cutMessage splits text into a head of at most max bytes and the rest,
+// preferring a line break in the second half of the head and never
+// splitting a UTF-8 sequence
+func cutMessage(text string, max int) (string, string) {
+	if len(text) <= max {
+		return text, ""
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if i := strings.LastIndex(text[:cut], "\n"); i >= max/2 {
+		return text[:i], text[i+1:]
+	}
+	return text[:cut], text[cut:]
+}
+
+// openFence reports whether text ends inside a code block, the language
+// the block was opened with and the offset of its opening line
+func openFence(text string) (lang string, at int, open bool) {
+	offset := 0
+	for _, line := range strings.Split(text, "\n") {
+		start := offset
+		offset += len(line) + 1
+
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, codeFence) {
+			continue
+		}
+		if open {
+			open = false
+			continue
+		}
+		lang, at, open = strings.TrimSpace(strings.TrimPrefix(line, codeFence)), start, true
+	}
+	return lang, at, open
+}
@@ -0,0 +1,129 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	t.Run("short", func(t *testing.T) {
+		if parts := Split("hello", 100, MarkdownNone); len(parts) != 1 || parts[0] != "hello" {
+			t.Errorf("parts = %q", parts)
+		}
+	})
+
+	t.Run("runes", func(t *testing.T) {
+		text := strings.Repeat("héllo wörld 🐝 ", 50)
+		parts := Split(text, 64, MarkdownNone)
+		if strings.Join(parts, "") != text {
+			t.Errorf("parts don't add up to the text")
+		}
+		for _, p := range parts {
+			if len(p) > 64 || !utf8.ValidString(p) {
+				t.Errorf("bad part %q", p)
+			}
+		}
+	})
+
+	t.Run("lines", func(t *testing.T) {
+		text := strings.Repeat("a line of text\n", 20)
+		parts := Split(text, 100, MarkdownNone)
+		for _, p := range parts[:len(parts)-1] {
+			if !strings.HasSuffix(p, "text") || len(p) > 100 || len(p) < 50 {
+				t.Errorf("bad part %q", p)
+			}
+		}
+	})
+
+	t.Run("code block moves whole", func(t *testing.T) {
+		text := strings.Repeat("intro text\n", 8) + "```go\nfmt.Println(1)\nfmt.Println(2)\n```"
+		parts := Split(text, 120, MarkdownNone)
+		if len(parts) != 2 || strings.Contains(parts[0], "```") || !strings.HasPrefix(parts[1], "```go\n") {
+			t.Errorf("parts = %q", parts)
+		}
+	})
+
+	t.Run("long code block reopens", func(t *testing.T) {
+		text := "```py\n" + strings.Repeat("print('hello')\n", 30) + "```"
+		parts := Split(text, 120, MarkdownNone)
+		if len(parts) < 2 {
+			t.Fatalf("parts = %q", parts)
+		}
+		for _, p := range parts {
+			if !strings.HasPrefix(p, "```py\n") || !strings.HasSuffix(p, "```") {
+				t.Errorf("part not a whole block: %q", p)
+			}
+			if _, _, open := openFence(p); open {
+				t.Errorf("part leaves a block open: %q", p)
+			}
+		}
+	})
+
+	t.Run("rendered length", func(t *testing.T) {
+		// Every character needs escaping in MarkdownV2, doubling the length
+		text := strings.Repeat("a.b!c-d ", 100)
+		for _, p := range Split(text, 200, MarkdownTelegramV2) {
+			if n := len(Render(p, MarkdownTelegramV2)); n > 200 {
+				t.Errorf("rendered part is %d bytes", n)
+			}
+		}
+	})
+	t.Run("long language tag", func(t *testing.T) {
+		text := "```" + strings.Repeat("x", 150) + "\n" + strings.Repeat("code line\n", 40) + "```"
+		parts := splitWithin(t, text, 120, MarkdownNone)
+		if len(parts) < 2 {
+			t.Errorf("parts = %q", parts)
+		}
+	})
+
+	t.Run("short language tag reopens", func(t *testing.T) {
+		text := "```" + strings.Repeat("x", 20) + "\n" + strings.Repeat("code line\n", 40) + "```"
+		for _, p := range splitWithin(t, text, 120, MarkdownNone)[1:] {
+			if !strings.HasPrefix(p, "```"+strings.Repeat("x", 20)+"\n") {
+				t.Errorf("part doesn't reopen the block: %q", p)
+			}
+		}
+	})
+
+	t.Run("small limits", func(t *testing.T) {
+		texts := []string{
+			strings.Repeat("a.b!c-d ", 40),
+			"```go\n" + strings.Repeat("x := 1\n", 30) + "```",
+			strings.Repeat("🐝", 40),
+		}
+		for _, text := range texts {
+			for _, maxLen := range []int{1, 4, 10, 40, 70} {
+				for _, dialect := range []string{MarkdownNone, MarkdownTelegramV2} {
+					splitWithin(t, text, maxLen, dialect)
+				}
+			}
+		}
+	})
+}
+
+// splitWithin splits text, failing unless it ends with every part within
+// maxLen once rendered. A part may only exceed it when it is a single
+// character that renders longer on its own.
+func splitWithin(t *testing.T, text string, maxLen int, dialect string) []string {
+	t.Helper()
+	done := make(chan []string, 1)
+	go func() { done <- Split(text, maxLen, dialect) }()
+
+	var parts []string
+	select {
+	case parts = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Split(%d, %s) doesn't end", maxLen, dialect)
+	}
+	for _, p := range parts {
+		if n := len(Render(p, dialect)); n > maxLen && utf8.RuneCountInString(p) > 1 {
+			t.Errorf("Split(%d, %s): part renders to %d bytes: %q", maxLen, dialect, n, p)
+		}
+		if p == "" || !utf8.ValidString(p) {
+			t.Errorf("Split(%d, %s): bad part %q", maxLen, dialect, p)
+		}
+	}
+	return parts
+}
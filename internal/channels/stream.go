@@ -0,0 +1,281 @@
+package channels
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+)
+
+// Editor is implemented by channels that can edit messages they sent,
+// which lets the router stream answers into them as they are generated
+type Editor interface {
+	// Edit replaces the text of a message sent earlier
+	Edit(chatID, messageID string, out Outbound) error
+}
+
+// RetryAfterError is returned by Send or Edit when the platform asks the
+// bot to slow down
+type RetryAfterError struct {
+	Wait time.Duration
+	Err  error
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s: %v", e.Wait, e.Err)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+const (
+	// streamPlaceholder is shown until the first part of an answer arrives
+	streamPlaceholder = "…"
+
+	// streamCursor marks an answer that is still being written
+	streamCursor = " ▌"
+
+	// codeFence opens and closes markdown code blocks
+	codeFence = "```"
+
+	defaultEditInterval = time.Second
+)
+
+// typingRefresh re-sends the typing indicator before it expires
+var typingRefresh = 4 * time.Second
+
+// streamer writes a streamed answer into a chat, editing the current
+// message as text arrives and continuing in a new one when it is full
+type streamer struct {
+	ch       Channel
+	editor   Editor
+	chatID   string
+	replyTo  string
+	dialect  string // Markdown dialect the answer is rendered in
+	max      int    // Longest rendered text, leaving room for the cursor
+	interval time.Duration
+
+	msgID  string    // Message being written
+	text   string    // Its full text
+	shown  string    // Text last sent for it
+	next   time.Time // No edits before this
+	broken bool      // A follow-up message could not be sent
+}
+
+// respondStreaming streams an answer from the LLM into the chat and returns
+// the full text. If the answer fails before any text arrives, the user is
+// told and the error returned; a stream that fails later keeps what arrived.
+func (r *Router) respondStreaming(ch Channel, editor Editor, sessionID, chatID, replyTo string) (string, error) {
+	caps := ch.Capabilities()
+	s := &streamer{
+		ch:       ch,
+		editor:   editor,
+		chatID:   chatID,
+		replyTo:  replyTo,
+		dialect:  caps.Markdown,
+		max:      caps.MaxMessageLength - len(streamCursor) - len("\n"+codeFence),
+		interval: caps.EditInterval,
+	}
+	if s.interval <= 0 {
+		s.interval = defaultEditInterval
+	}
+
+	stopTyping := keepTyping(ch, chatID)
+	defer stopTyping()
+
+	// Cancelling on every return stops the provider from streaming into a
+	// channel nobody reads
+	opts, cancel := r.answerOptions(sessionID)
+	defer cancel()
+	chunks, err := r.LLM.Stream(r.history(ch, sessionID), opts)
+	if err != nil {
+		stopTyping()
+		r.Send(ch, Outbound{ChatID: chatID, Text: ErrorMessage, ReplyTo: replyTo})
+		return "", err
+	}
+
+	id, err := ch.Send(Outbound{ChatID: chatID, Text: streamPlaceholder, ReplyTo: replyTo})
+	if err != nil {
+		return "", fmt.Errorf("failed to send placeholder: %w", err)
+	}
+	s.msgID = id
+	s.next = time.Now().Add(s.interval)
+
+	var full strings.Builder
+	var footer string
+	for c := range chunks {
+		if c.Error != nil {
+			if full.Len() == 0 {
+				s.editor.Edit(chatID, s.msgID, Outbound{ChatID: chatID, Text: ErrorMessage})
+				return "", c.Error
+			}
+			log.Printf("LLM stream error: %v", c.Error)
+			break
+		}
+		if c.Done {
+			r.record(c.Usage)
+			if r.Footer {
+				footer = usageFooter(c, caps.Markdown)
+			}
+		}
+		if c.Content == "" {
+			continue
+		}
+
+		full.WriteString(c.Content)
+		r.Sessions.PublishDelta(sessionID, c.Content)
+		s.write(c.Content)
+	}
+
+	stopTyping()
+	if footer != "" {
+		s.write("\n\n" + footer)
+	}
+	s.finish()
+	return full.String(), nil
+}
+
+// write appends streamed text, rolling over to new messages as needed
+func (s *streamer) write(text string) {
+	if s.broken {
+		return
+	}
+
+	s.text += text
+	for len(Render(s.text, s.dialect)) > s.max {
+		head, rest := cut(s.text, s.max, s.dialect)
+		s.text = head
+		s.flush(false, true)
+
+		id, err := s.send(Outbound{ChatID: s.chatID, Text: streamPlaceholder})
+		if err != nil {
+			log.Printf("Failed to continue %s answer: %v", s.ch.Name(), err)
+			s.broken = true
+			return
+		}
+		s.msgID, s.text, s.shown = id, rest, ""
+	}
+
+	if time.Now().After(s.next) {
+		s.flush(false, false)
+	}
+}
+
+// finish writes the final text with the regenerate control
+func (s *streamer) finish() {
+	if s.broken {
+		return
+	}
+	if s.text == "" {
+		s.text = "(no answer)"
+	}
+	s.flush(true, true)
+}
+
+// flush edits the current message to show the text so far. When rate
+// limited, intermediate edits are skipped while forced ones wait it out.
+func (s *streamer) flush(final, force bool) {
+	text := s.text
+	if !final && !force {
+		text += streamCursor
+	}
+	// Keep a partial code block rendered as one
+	if _, _, open := openFence(s.text); open {
+		text += "\n" + codeFence
+	}
+	if text == s.shown && !final {
+		return
+	}
+
+	out := Outbound{ChatID: s.chatID, Text: text, Markdown: true, Regenerate: final}
+	for attempt := 0; attempt < 3; attempt++ {
+		err := s.editor.Edit(s.chatID, s.msgID, out)
+		s.next = time.Now().Add(s.interval)
+
+		var retry *RetryAfterError
+		if errors.As(err, &retry) {
+			s.next = time.Now().Add(retry.Wait)
+			if !force {
+				return
+			}
+			time.Sleep(retry.Wait)
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to edit %s message: %v", s.ch.Name(), err)
+			return
+		}
+		s.shown = text
+		return
+	}
+}
+
+// send sends a new message, waiting out rate limits
+func (s *streamer) send(out Outbound) (string, error) {
+	for attempt := 0; ; attempt++ {
+		id, err := s.ch.Send(out)
+		var retry *RetryAfterError
+		if attempt < 2 && errors.As(err, &retry) {
+			time.Sleep(retry.Wait)
+			continue
+		}
+		return id, err
+	}
+}
+
+// keepTyping shows the typing indicator in a chat, re-sending it before it
+// expires, until the returned function is called
+func keepTyping(ch Channel, chatID string) (stop func()) {
+	if !ch.Capabilities().Typing {
+		return func() {}
+	}
+	ch.Typing(chatID)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(typingRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ch.Typing(chatID)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-exited
+		})
+	}
+}
+
+// usageFooter describes the model and token usage on a final chunk
+func usageFooter(c llm.StreamChunk, markdown string) string {
+	var parts []string
+	if c.Model != "" {
+		parts = append(parts, c.Model)
+	}
+	if c.Usage != nil && c.Usage.InputTokens+c.Usage.OutputTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%d in / %d out tokens", c.Usage.InputTokens, c.Usage.OutputTokens))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	footer := strings.Join(parts, " · ")
+	if markdown == MarkdownDiscord {
+		footer = "-# " + footer // Small grey subtext
+	}
+	return footer
+}
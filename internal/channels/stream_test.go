@@ -0,0 +1,89 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// typingChannel is an editorChannel that shows typing indicators and
+// records them, and its edits, among the messages it sends
+type typingChannel struct {
+	editorChannel
+}
+
+func (c *typingChannel) Edit(chatID, messageID string, out Outbound) error {
+	_, err := c.fakeChannel.Send(out)
+	return err
+}
+
+func (c *typingChannel) Capabilities() Capabilities {
+	return Capabilities{MaxMessageLength: 4096, Typing: true}
+}
+
+func (c *typingChannel) Typing(chatID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, Outbound{ChatID: chatID, Text: "<typing>"})
+	return nil
+}
+
+// count returns how many typing indicators were sent, and how many after
+// the last message or edit
+func (c *typingChannel) count() (total, trailing int) {
+	for _, text := range c.texts() {
+		if text == "<typing>" {
+			total++
+			trailing++
+		} else {
+			trailing = 0
+		}
+	}
+	return total, trailing
+}
+
+// slowLLM thinks for a while before answering
+type slowLLM struct {
+	delay time.Duration
+}
+
+func (l slowLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	time.Sleep(l.delay)
+	return &llm.Response{Content: "done"}, nil
+}
+
+func (l slowLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk)
+	go func() {
+		defer close(ch)
+		time.Sleep(l.delay)
+		ch <- llm.StreamChunk{Content: "done"}
+		ch <- llm.StreamChunk{Done: true}
+	}()
+	return ch, nil
+}
+
+func TestTypingLastsTheWholeTurn(t *testing.T) {
+	defer func(d time.Duration) { typingRefresh = d }(typingRefresh)
+	typingRefresh = 10 * time.Millisecond
+
+	for _, stream := range []bool{true, false} {
+		r := NewRouter(session.NewManager(), slowLLM{delay: 100 * time.Millisecond}, "")
+		r.Stream = stream
+		r.Sessions.CreateWithID("s1", "")
+		r.Sessions.AddMessage("s1", "user", "think hard")
+
+		ch := &typingChannel{}
+		if err := r.respond(ch, "s1", "c1", ""); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(3 * typingRefresh)
+
+		// Refreshed while the provider was silent, and stopped with the answer
+		if total, trailing := ch.count(); total < 3 || trailing != 0 {
+			t.Errorf("stream %v: %d typing indicators, %d after the answer: %q", stream, total, trailing, ch.texts())
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package telegram
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+)
+
+// adminCommands are only available to users in AdminIDs
+var adminCommands = map[string]bool{
+	"sessions":  true,
+	"broadcast": true,
+	"allow":     true,
+	"deny":      true,
+	"model":     true,
+	"usage":     true,
+	"reload":    true,
+}
+
+// maxListedSessions caps the chats listed by /sessions
+const maxListedSessions = 20
+
+func (b *Bot) isAdmin(userID int64) bool {
+	b.access.RLock()
+	defer b.access.RUnlock()
+
+	for _, id := range b.Config.AdminIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// handleAdminCommand runs an admin command, rejecting anyone else
+func (b *Bot) handleAdminCommand(msg *message) {
+	if !b.isAdmin(msg.From.ID) {
+		log.Printf("Non-admin user %d tried /%s in chat %d", msg.From.ID, msg.Command(), msg.Chat.ID)
+		b.sendMessage(chatID(msg), "⛔ This command is for admins only.", false)
+		return
+	}
+	log.Printf("Admin %d ran /%s %s", msg.From.ID, msg.Command(), msg.CommandArguments())
+
+	args := strings.TrimSpace(msg.CommandArguments())
+
+	switch msg.Command() {
+	case "sessions":
+		b.listSessions(chatID(msg))
+
+	case "broadcast":
+		if args == "" {
+			b.sendMessage(chatID(msg), "Usage: /broadcast <message>", false)
+			return
+		}
+		b.broadcast(chatID(msg), args)
+
+	case "allow", "deny":
+		id, err := strconv.ParseInt(args, 10, 64)
+		if err != nil {
+			b.sendMessage(chatID(msg), fmt.Sprintf("Usage: /%s <user or chat ID>", msg.Command()), false)
+			return
+		}
+		b.updateAllowlist(chatID(msg), id, msg.Command() == "allow")
+
+	case "model":
+		if args == "" {
+			model := b.Router.Options().Model
+			if model == "" {
+				model = "provider default"
+			}
+			b.sendMessage(chatID(msg), fmt.Sprintf("🧠 Model: %s\nUsage: /model <name>", model), false)
+			return
+		}
+		b.Router.SetModel(args)
+		b.sendMessage(chatID(msg), fmt.Sprintf("🧠 Switched to %s until the next /reload or restart.", args), false)
+
+	case "usage":
+		turns, usage := b.Router.Usage()
+		b.sendMessage(chatID(msg), fmt.Sprintf("📈 Since start: %d answers, %d input and %d output tokens.",
+			turns, usage.InputTokens, usage.OutputTokens), false)
+
+	case "reload":
+		if err := b.reload(); err != nil {
+			log.Printf("Reload error: %v", err)
+			b.sendMessage(chatID(msg), fmt.Sprintf("❌ Reload failed: %v", err), false)
+			return
+		}
+		b.sendMessage(chatID(msg), "🔁 Configuration reloaded.", false)
+	}
+}
+
+// listSessions lists the most recently active Telegram chats
+func (b *Bot) listSessions(chat string) {
+	summaries := b.Sessions.Summaries(b.Name(), "")
+	if len(summaries) == 0 {
+		b.sendMessage(chat, "No active chats.", false)
+		return
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "💬 %d active chats:\n", len(summaries))
+	for i, s := range summaries {
+		if i == maxListedSessions {
+			fmt.Fprintf(&sb, "\n…and %d more", len(summaries)-i)
+			break
+		}
+		fmt.Fprintf(&sb, "\n• %s: %d messages, last active %s", s.ID, s.MessageCount, s.UpdatedAt.Format("2006-01-02 15:04"))
+		if s.Paused {
+			sb.WriteString(" (paused)")
+		}
+	}
+	b.sendMessage(chat, sb.String(), false)
+}
+
+// broadcast sends a message to every chat with a session
+func (b *Bot) broadcast(chat string, text string) {
+	sent, failed := 0, 0
+	seen := make(map[string]bool)
+	for _, s := range b.Sessions.Summaries(b.Name(), "") {
+		// Per-user group sessions share a chat
+		id, err := sessionChat(s.ID)
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := b.Router.Send(b, channels.Outbound{ChatID: id, Text: text}); err != nil {
+			failed++
+			continue
+		}
+		sent++
+	}
+	b.sendMessage(chat, fmt.Sprintf("📣 Sent to %d chats (%d failed).", sent, failed), false)
+}
+
+// updateAllowlist adds or removes an ID from AllowedIDs and reports back
+func (b *Bot) updateAllowlist(chat string, id int64, allow bool) {
+	b.sendMessage(chat, b.changeAllowlist(id, allow), false)
+}
+
+// changeAllowlist adds or removes an ID from AllowedIDs, saves it to the
+// config file when there is one and returns the reply. An empty allowlist
+// lets everyone in, so the last ID can't be removed.
+func (b *Bot) changeAllowlist(id int64, allow bool) string {
+	b.access.Lock()
+	defer b.access.Unlock()
+
+	var ids []int64
+	found := false
+	for _, existing := range b.Config.AllowedIDs {
+		if existing == id {
+			found = true
+			continue
+		}
+		ids = append(ids, existing)
+	}
+
+	var reply string
+	switch {
+	case allow && len(b.Config.AllowedIDs) == 0:
+		reply = fmt.Sprintf("✅ Allowed %d. Only allowed IDs can use the bot now.", id)
+	case allow:
+		reply = fmt.Sprintf("✅ Allowed %d.", id)
+	case !found:
+		return fmt.Sprintf("ℹ️ %d isn't on the allowlist.", id)
+	case len(ids) == 0:
+		return fmt.Sprintf("⚠️ %d is the last allowed ID. Removing it would let everyone use the bot; /allow another ID first.", id)
+	default:
+		reply = fmt.Sprintf("✅ Removed %d.", id)
+	}
+	if allow {
+		ids = append(ids, id)
+	}
+	b.Config.AllowedIDs = ids
+
+	if err := b.saveAllowlist(ids); err != nil {
+		log.Printf("Failed to save Telegram allowlist: %v", err)
+		reply += " ⚠️ Not saved: " + err.Error()
+	}
+	return reply
+}
+
+// saveAllowlist persists the allowlist to the config file. Callers hold
+// b.access.
+func (b *Bot) saveAllowlist(ids []int64) error {
+	if b.AppConfig == nil {
+		return fmt.Errorf("no config file to save to")
+	}
+	b.AppConfig.Channels.Telegram.AllowedIDs = ids
+	return b.AppConfig.Save(b.ConfigPath)
+}
+
+// reload rereads the config file and applies the allowlist, admins, model
+// and system prompt
+func (b *Bot) reload() error {
+	b.access.RLock()
+	loaded := b.AppConfig != nil
+	b.access.RUnlock()
+	if !loaded {
+		return fmt.Errorf("no config file to reload")
+	}
+
+	cfg, err := configs.Load(b.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	b.access.Lock()
+	b.AppConfig = cfg
+	b.Config.AllowedIDs = cfg.Channels.Telegram.AllowedIDs
+	b.Config.AdminIDs = cfg.Channels.Telegram.AdminIDs
+	b.access.Unlock()
+
+	b.Router.SetModel(cfg.LLM.Model)
+	if cfg.LLM.SystemPrompt != "" {
+		b.Router.SetSystem(cfg.LLM.SystemPrompt)
+	}
+	return nil
+}
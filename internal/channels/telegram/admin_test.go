@@ -0,0 +1,77 @@
+package telegram
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+func TestAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []int64
+		id      int64
+		allow   bool
+		reply   string
+		want    []int64
+	}{
+		{"allow", []int64{1}, 2, true, "Allowed 2.", []int64{1, 2}},
+		{"allow on an open bot", nil, 2, true, "Only allowed IDs", []int64{2}},
+		{"allow twice", []int64{1, 2}, 1, true, "Allowed 1.", []int64{2, 1}},
+		{"deny", []int64{1, 2}, 1, false, "Removed 1.", []int64{2}},
+		{"deny the last ID", []int64{1}, 1, false, "last allowed ID", []int64{1}},
+		{"deny an unknown ID", []int64{1}, 3, false, "isn't on the allowlist", []int64{1}},
+		{"deny on an open bot", nil, 3, false, "isn't on the allowlist", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			cfg := configs.DefaultConfig()
+			cfg.Channels.Telegram.AllowedIDs = tt.allowed
+			if err := cfg.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			b := &Bot{Config: Config{AllowedIDs: tt.allowed}, AppConfig: cfg, ConfigPath: path}
+
+			if reply := b.changeAllowlist(tt.id, tt.allow); !strings.Contains(reply, tt.reply) || strings.Contains(reply, "Not saved") {
+				t.Errorf("replied %q, want %q", reply, tt.reply)
+			}
+			if !sameIDs(b.Config.AllowedIDs, tt.want) {
+				t.Errorf("allowlist %v, want %v", b.Config.AllowedIDs, tt.want)
+			}
+
+			saved, err := configs.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameIDs(saved.Channels.Telegram.AllowedIDs, tt.want) {
+				t.Errorf("saved %v, want %v", saved.Channels.Telegram.AllowedIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowlistWithoutConfigFile(t *testing.T) {
+	b := &Bot{Config: Config{AllowedIDs: []int64{1}}}
+	if reply := b.changeAllowlist(2, true); !strings.Contains(reply, "Not saved") {
+		t.Errorf("replied %q", reply)
+	}
+	if !sameIDs(b.Config.AllowedIDs, []int64{1, 2}) {
+		t.Errorf("allowlist %v", b.Config.AllowedIDs)
+	}
+}
+
+func sameIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
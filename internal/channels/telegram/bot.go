@@ -1,69 +1,362 @@
 package telegram
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/channels"
 	"github.com/nanilabs/hiveclaw/internal/llm"
 	"github.com/nanilabs/hiveclaw/internal/session"
+	"github.com/nanilabs/hiveclaw/internal/voice"
 )
 
-// Bot represents a Telegram bot
+// Callback data for inline keyboard buttons
+const callbackRegenerate = "regenerate"
+
+// Bot represents a Telegram bot. It is the Telegram transport for a
+// channels.Router, which runs the conversations.
 type Bot struct {
 	API      *tgbotapi.BotAPI
 	Sessions *session.Manager
-	LLM      llm.Provider
+	Router   *channels.Router
 	Config   Config
+
+	// AppConfig is the application config the bot was set up from, if any.
+	// Admin commands save allowlist changes to it at ConfigPath ("" for the
+	// default location) and /reload rereads it.
+	AppConfig  *configs.Config
+	ConfigPath string
+
+	access     sync.RWMutex       // Guards the ID lists in Config and AppConfig
+	voiceChats sync.Map           // Chats with voice replies on
+	inbox      *session.TurnQueue // Chat messages waiting to be handled, in order per chat
+	secret     string             // Webhook secret token
+	webhook    atomic.Bool
+	stop       chan struct{}
+	stopOnce   sync.Once
 }
 
+var _ channels.Channel = (*Bot)(nil)
+
 // Config for Telegram bot
 type Config struct {
 	Token       string   `json:"token"`
 	AllowedIDs  []int64  `json:"allowedIds"`  // Allowed user/chat IDs
 	AdminIDs    []int64  `json:"adminIds"`    // Admin user IDs
 	SystemPrompt string  `json:"systemPrompt"`
+
+	// Webhook mode: updates are posted to WebhookURL, which must route to
+	// the gateway path returned by WebhookPath. Empty means long polling.
+	WebhookURL    string `json:"webhookUrl,omitempty"`
+	WebhookSecret string `json:"webhookSecret,omitempty"` // Generated when empty
+
+	// APIEndpoint overrides the Bot API URL format, e.g. for a local Bot API
+	// server. Default: tgbotapi.APIEndpoint
+	APIEndpoint string `json:"apiEndpoint,omitempty"`
+
+	// Group chats
+	GroupReplies  string   `json:"groupReplies,omitempty"`  // mention (default) or all; see GroupRepliesMention
+	TriggerWords  []string `json:"triggerWords,omitempty"`  // Words that address the bot like a mention
+	GroupSessions string   `json:"groupSessions,omitempty"` // chat (default) or user
+
+	// Voice notes are transcribed with STT (see voice.NewTranscriber);
+	// they are refused when it is nil
+	STT            voice.Transcriber `json:"-"`
+	EchoTranscript bool              `json:"echoTranscript,omitempty"` // Reply with what was heard
+
+	// Chats that turn on voice replies with /voice hear answers spoken
+	// with TTS, up to MaxSpokenChars (default voice.DefaultMaxSpokenChars)
+	TTS            voice.Synthesizer `json:"-"`
+	MaxSpokenChars int               `json:"maxSpokenChars,omitempty"`
+
+	// Answers are rendered from markdown in this parse mode: html
+	// (default) or markdownv2; see ParseModeHTML
+	ParseMode string `json:"parseMode,omitempty"`
 }
 
 // New creates a new Telegram bot
 func New(config Config, sessions *session.Manager, llmProvider llm.Provider) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(config.Token)
+	endpoint := config.APIEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.APIEndpoint
+	}
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.Token, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
 	}
 
+	secret := config.WebhookSecret
+	if config.WebhookURL != "" && secret == "" {
+		if secret, err = newSecret(); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Printf("🤖 Telegram bot authorized as @%s", api.Self.UserName)
 
+	router := channels.NewRouter(sessions, llmProvider, config.SystemPrompt)
+	router.STT = config.STT
+	router.EchoTranscript = config.EchoTranscript
+
 	return &Bot{
 		API:      api,
 		Sessions: sessions,
-		LLM:      llmProvider,
+		Router:   router,
 		Config:   config,
+		secret:   secret,
+		inbox:    session.NewTurnQueue(0, 0),
+		stop:     make(chan struct{}),
 	}, nil
 }
 
-// Start starts the bot
+// Start receives updates until Stop is called. With a webhook URL
+// configured it registers the webhook and waits for updates on ServeHTTP,
+// falling back to long polling if Telegram rejects the webhook.
 func (b *Bot) Start() error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	if b.Config.WebhookURL != "" {
+		err := b.setWebhook()
+		if err == nil {
+			b.webhook.Store(true)
+			log.Printf("🐝 Telegram bot receiving updates via webhook at %s", b.WebhookPath())
+			<-b.stop
+			return nil
+		}
+		log.Printf("Telegram webhook setup failed, falling back to polling: %v", err)
+	}
 
-	updates := b.API.GetUpdatesChan(u)
+	// Polling doesn't work while a webhook is registered
+	if err := b.deleteWebhook(); err != nil {
+		log.Printf("Failed to delete Telegram webhook: %v", err)
+	}
 
 	log.Println("🐝 Telegram bot listening for messages...")
+	b.poll()
+	return nil
+}
+
+// poll long-polls getUpdates until Stop is called. Updates are fetched raw
+// so decodeUpdate can read the fields tgbotapi doesn't know about.
+func (b *Bot) poll() {
+	offset := 0
+	for {
+		select {
+		case <-b.stop:
+			return
+		default:
+		}
+
+		resp, err := b.API.MakeRequest("getUpdates", tgbotapi.Params{
+			"offset":          strconv.Itoa(offset),
+			"timeout":         "60",
+			"allowed_updates": `["message","callback_query"]`,
+		})
+		if err != nil {
+			log.Printf("Failed to get Telegram updates, retrying in 3 seconds: %v", err)
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
 
-	for update := range updates {
-		if update.Message == nil {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(resp.Result, &raws); err != nil {
+			log.Printf("Invalid Telegram updates: %v", err)
 			continue
 		}
+		for _, raw := range raws {
+			u, err := decodeUpdate(raw)
+			if u.UpdateID >= offset {
+				offset = u.UpdateID + 1
+			}
+			if err != nil {
+				log.Printf("Invalid Telegram update: %v", err)
+				continue
+			}
+			b.dispatch(u)
+		}
+	}
+}
+
+// Stop stops receiving updates, removing the webhook if one was set
+func (b *Bot) Stop() error {
+	var err error
+	b.stopOnce.Do(func() {
+		if b.webhook.Load() {
+			err = b.deleteWebhook()
+		}
+		close(b.stop)
+	})
+	return err
+}
+
+// dispatch routes an update from polling or the webhook
+func (b *Bot) dispatch(u update) {
+	if u.CallbackQuery != nil {
+		go b.handleCallback(u.CallbackQuery, u.ThreadID)
+		return
+	}
+
+	if u.Message == nil {
+		return
+	}
+	msg := &message{Message: u.Message, ThreadID: u.ThreadID}
+
+	// Commands may block and get their own goroutine. Chat messages can
+	// need a transcription first, so each chat handles them in order on a
+	// worker of its own, keeping the update loop free.
+	if msg.IsCommand() {
+		go b.handleMessage(msg)
+	} else {
+		b.inbox.Submit(chatID(msg), "", func(string) { b.handleMessage(msg) }, nil)
+	}
+}
+
+// Name identifies the channel
+func (b *Bot) Name() string {
+	return "telegram"
+}
+
+// Capabilities describes what Telegram messages support
+func (b *Bot) Capabilities() channels.Capabilities {
+	return channels.Capabilities{
+		MaxMessageLength: 4096,
+		Markdown:         b.dialect(),
+		Attachments:      true,
+		Typing:           true,
+		EditInterval:     1500 * time.Millisecond, // Telegram allows about one message a second per chat
+	}
+}
+
+// Send sends one message to a chat or forum topic. The request is built
+// by hand because tgbotapi's configs can't address topics.
+func (b *Bot) Send(out channels.Outbound) (string, error) {
+	chat, thread, err := parseChatID(out.ChatID)
+	if err != nil {
+		return "", err
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chat)
+	params.AddNonZero("message_thread_id", thread)
+	replyTo, _ := strconv.Atoi(out.ReplyTo)
+	params.AddNonZero("reply_to_message_id", replyTo)
+	if out.Regenerate {
+		params.AddInterface("reply_markup", regenerateMarkup())
+	}
+
+	send := func(text, mode string) (*tgbotapi.APIResponse, error) {
+		params.AddNonEmpty("parse_mode", mode)
+		if out.Attachment != nil {
+			params.AddNonEmpty("caption", text)
+			return b.API.UploadFiles("sendDocument", params, []tgbotapi.RequestFile{{
+				Name: "document",
+				Data: tgbotapi.FileBytes{Name: out.Attachment.Name, Bytes: out.Attachment.Data},
+			}})
+		}
+		params["text"] = text
+		return b.API.MakeRequest("sendMessage", params)
+	}
 
-		go b.handleMessage(update.Message)
+	resp, err := send(b.format(out))
+	if isParseError(err) {
+		delete(params, "parse_mode")
+		resp, err = send(out.Text, "")
+	}
+	if err != nil {
+		return "", retryAfter(err)
 	}
 
+	var sent tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		return "", fmt.Errorf("invalid sent message: %w", err)
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// Edit replaces the text of a message the bot sent
+func (b *Bot) Edit(chatID, messageID string, out channels.Outbound) error {
+	chat, _, err := parseChatID(chatID)
+	if err != nil {
+		return err
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID: %s", messageID)
+	}
+
+	text, mode := b.format(out)
+	edit := tgbotapi.NewEditMessageText(chat, id, text)
+	edit.ParseMode = mode
+	if out.Regenerate {
+		markup := regenerateMarkup()
+		edit.ReplyMarkup = &markup
+	}
+
+	_, err = b.API.Send(edit)
+	if isParseError(err) {
+		edit.Text, edit.ParseMode = out.Text, ""
+		_, err = b.API.Send(edit)
+	}
+	if err != nil {
+		return retryAfter(err)
+	}
 	return nil
 }
 
-func (b *Bot) handleMessage(msg *tgbotapi.Message) {
+// retryAfter converts Telegram's flood control errors for the router
+func retryAfter(err error) error {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+		return &channels.RetryAfterError{Wait: time.Duration(tgErr.RetryAfter) * time.Second, Err: err}
+	}
+	return err
+}
+
+// regenerateMarkup is the inline keyboard offering another answer
+func regenerateMarkup() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Regenerate", callbackRegenerate),
+		),
+	)
+}
+
+// Typing shows the typing indicator in a chat or forum topic
+func (b *Bot) Typing(chatID string) error {
+	return b.chatAction(chatID, tgbotapi.ChatTyping)
+}
+
+// chatAction shows what the bot is doing, such as typing or recording a
+// voice note
+func (b *Bot) chatAction(chatID, action string) error {
+	chat, thread, err := parseChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	params := tgbotapi.Params{"action": action}
+	params.AddNonZero64("chat_id", chat)
+	params.AddNonZero("message_thread_id", thread)
+	_, err = b.API.MakeRequest("sendChatAction", params)
+	return err
+}
+
+func (b *Bot) handleMessage(msg *message) {
+	if msg.From == nil {
+		return // Channel posts and anonymous admins
+	}
+
 	// Check if user is allowed
 	if !b.isAllowed(msg.From.ID, msg.Chat.ID) {
 		log.Printf("Unauthorized access attempt from user %d in chat %d", msg.From.ID, msg.Chat.ID)
@@ -72,15 +365,49 @@ func (b *Bot) handleMessage(msg *tgbotapi.Message) {
 
 	// Handle commands
 	if msg.IsCommand() {
-		b.handleCommand(msg)
+		if !b.forOtherBot(msg) {
+			b.handleCommand(msg)
+		}
+		return
+	}
+
+	// Handle regular messages; in groups only those meant for the bot
+	text := messageText(msg)
+	if isGroup(msg) {
+		var ok bool
+		if text, ok = b.addressed(msg); !ok {
+			return
+		}
+	}
+
+	// Voice notes are answered as if their transcript had been typed
+	transcript, hasAudio, ok := b.transcribe(msg)
+	if !ok {
 		return
 	}
+	if hasAudio {
+		text = strings.TrimSpace(text + "\n" + transcript)
+	}
 
-	// Handle regular messages
-	b.handleChat(msg)
+	media, skipped := b.media(msg)
+	if note := channels.SkippedNote(skipped); note != "" {
+		text = strings.TrimSpace(text + "\n" + note)
+	}
+	if text == "" && len(media) == 0 {
+		return
+	}
+
+	// Say who is talking, since several people share the conversation
+	if isGroup(msg) && b.Config.GroupSessions != GroupSessionsUser {
+		text = senderName(msg.From) + ": " + text
+	}
+	b.handleChat(msg, text, media)
 }
 
 func (b *Bot) isAllowed(userID, chatID int64) bool {
+	b.access.RLock()
+	defer b.access.RUnlock()
+
 	// If no allowlist, allow everyone (not recommended for production)
 	if len(b.Config.AllowedIDs) == 0 {
 		return true
@@ -94,16 +421,21 @@ func (b *Bot) isAllowed(userID, chatID int64) bool {
 	return false
 }
 
-func (b *Bot) handleCommand(msg *tgbotapi.Message) {
+func (b *Bot) handleCommand(msg *message) {
 	switch msg.Command() {
 	case "start":
-		b.sendMessage(msg.Chat.ID, `🐝 *Welcome to HiveClaw!*
+		b.sendMessage(chatID(msg), `🐝 **Welcome to HiveClaw!**
 
 I'm your AI assistant powered by the Hive Mind architecture.
 
-*Commands:*
+**Commands:**
 /new - Start a new conversation
 /clear - Clear conversation history
+/regenerate - Regenerate the last answer
+/edit - Edit your last message and retry
+/export - Download this conversation
+/voice - Toggle spoken answers
+/search - Search your conversations
 /status - Check system status
 /help - Show this help message
 
@@ -112,136 +444,186 @@ Just send me a message to chat!`, true)
 	case "new":
 		sessionKey := b.getSessionKey(msg)
 		b.Sessions.Delete(sessionKey)
-		b.Sessions.Create(sessionKey)
-		b.sendMessage(msg.Chat.ID, "🆕 Started a new conversation!", false)
+		b.Sessions.CreateWithID(sessionKey, "")
+		b.sendMessage(chatID(msg), "🆕 Started a new conversation!", false)
 
 	case "clear":
 		sessionKey := b.getSessionKey(msg)
 		b.Sessions.Clear(sessionKey)
-		b.sendMessage(msg.Chat.ID, "🧹 Conversation cleared!", false)
+		b.sendMessage(chatID(msg), "🧹 Conversation cleared!", false)
+
+	case "regenerate":
+		b.Router.Regenerate(b.replyChannel(chatID(msg)), b.getSessionKey(msg), chatID(msg))
+
+	case "edit":
+		text := strings.TrimSpace(msg.CommandArguments())
+		if text == "" {
+			b.sendMessage(chatID(msg), "Usage: /edit <new message>", false)
+			return
+		}
+		b.Router.EditLast(b.replyChannel(chatID(msg)), b.getSessionKey(msg), chatID(msg), text)
+
+	case "export":
+		b.exportSession(msg)
+
+	case "voice":
+		b.toggleVoice(msg)
+
+	case "search":
+		b.search(msg)
 
 	case "status":
-		status := fmt.Sprintf(`🐝 *HiveClaw Status*
+		status := fmt.Sprintf(`🐝 **HiveClaw Status**
 
-*Version:* 0.1.0
-*Bot:* @%s
-*Your ID:* %d
-*Chat ID:* %d
+**Version:** 0.1.0
+**Bot:** @%s
+**Your ID:** %d
+**Chat ID:** %d
 
 System is operational!`, b.API.Self.UserName, msg.From.ID, msg.Chat.ID)
-		b.sendMessage(msg.Chat.ID, status, true)
+		b.sendMessage(chatID(msg), status, true)
 
 	case "help":
-		b.sendMessage(msg.Chat.ID, `🐝 *HiveClaw Help*
+		b.sendMessage(chatID(msg), `🐝 **HiveClaw Help**
 
 I'm an AI assistant that can help you with various tasks.
 
-*Tips:*
+**Tips:**
 • Just type your message to chat
 • Use /new to start fresh
 • Use /clear to reset context
+• Tap 🔄 or use /regenerate for another answer
+• Use /edit to rewrite your last message
+• Use /voice to hear answers as voice notes
 
-*About:*
+**About:**
 Built with Hive Mind architecture - swarm intelligence meets AI.`, true)
 
 	default:
-		b.sendMessage(msg.Chat.ID, "Unknown command. Try /help", false)
+		if adminCommands[msg.Command()] {
+			b.handleAdminCommand(msg)
+			return
+		}
+		b.sendMessage(chatID(msg), "Unknown command. Try /help", false)
 	}
 }
 
-func (b *Bot) handleChat(msg *tgbotapi.Message) {
-	sessionKey := b.getSessionKey(msg)
-
-	// Get or create session
-	_, exists := b.Sessions.Get(sessionKey)
-	if !exists {
-		b.Sessions.Create(sessionKey)
+func (b *Bot) handleChat(msg *message, text string, media []channels.Media) {
+	in := channels.Inbound{
+		SessionID: b.getSessionKey(msg),
+		ChatID:    chatID(msg),
+		UserID:    strconv.FormatInt(msg.From.ID, 10),
+		Text:      text,
+		Media:     media,
 	}
-
-	// Add user message to session
-	b.Sessions.AddMessage(sessionKey, "user", msg.Text)
-
-	// Send typing indicator
-	typing := tgbotapi.NewChatAction(msg.Chat.ID, tgbotapi.ChatTyping)
-	b.API.Send(typing)
-
-	// Build messages for LLM
-	messages, _ := b.Sessions.GetMessages(sessionKey)
-	llmMessages := make([]llm.Message, len(messages))
-	for i, m := range messages {
-		llmMessages[i] = llm.Message{Role: m.Role, Content: m.Content}
+	// Thread answers to the question in busy groups
+	if isGroup(msg) {
+		in.ReplyTo = strconv.Itoa(msg.MessageID)
 	}
+	b.Router.Handle(b.replyChannel(in.ChatID), in)
+}
 
-	// Call LLM
-	resp, err := b.LLM.Chat(llmMessages, llm.Options{
-		System: b.Config.SystemPrompt,
-	})
-
+// exportSession sends the chat's session as a document. The optional
+// argument selects the format: markdown (default), json, openai or anthropic.
+func (b *Bot) exportSession(msg *message) {
+	format, err := session.ParseFormat(msg.CommandArguments())
 	if err != nil {
-		log.Printf("LLM error: %v", err)
-		b.sendMessage(msg.Chat.ID, "❌ Sorry, I encountered an error. Please try again.", false)
+		b.sendMessage(chatID(msg), "Usage: /export [markdown|json|openai|anthropic]", false)
 		return
 	}
 
-	// Add assistant response to session
-	b.Sessions.AddMessage(sessionKey, "assistant", resp.Content)
+	sess, ok := b.Sessions.Get(b.getSessionKey(msg))
+	if !ok {
+		b.sendMessage(chatID(msg), "Nothing to export yet.", false)
+		return
+	}
 
-	// Send response
-	b.sendMessage(msg.Chat.ID, resp.Content, false)
-}
+	data, err := b.Sessions.Export(sess.ID, format)
+	if err != nil {
+		log.Printf("Export error: %v", err)
+		b.sendMessage(chatID(msg), "❌ Sorry, the export failed.", false)
+		return
+	}
 
-func (b *Bot) getSessionKey(msg *tgbotapi.Message) string {
-	// Use chat ID as session key (supports both DMs and groups)
-	return fmt.Sprintf("tg_%d", msg.Chat.ID)
+	b.Router.Send(b, channels.Outbound{
+		ChatID: chatID(msg),
+		Attachment: &channels.Attachment{
+			Name: session.FileName(sess, format),
+			Data: data,
+		},
+	})
 }
 
-func (b *Bot) sendMessage(chatID int64, text string, markdown bool) {
-	// Split long messages
-	const maxLength = 4096
-	texts := splitMessage(text, maxLength)
+// search looks up messages in this chat's sessions
+func (b *Bot) search(msg *message) {
+	query := strings.TrimSpace(msg.CommandArguments())
+	if query == "" {
+		b.sendMessage(chatID(msg), "Usage: /search <words>", false)
+		return
+	}
 
-	for _, t := range texts {
-		msg := tgbotapi.NewMessage(chatID, t)
-		if markdown {
-			msg.ParseMode = "Markdown"
-		}
+	results := b.Sessions.Search(session.SearchQuery{
+		Query: query,
+		Scope: b.getSessionKey(msg),
+		Limit: 5,
+	})
+	if len(results) == 0 {
+		b.sendMessage(chatID(msg), "🔍 No matches found.", false)
+		return
+	}
 
-		if _, err := b.API.Send(msg); err != nil {
-			log.Printf("Failed to send message: %v", err)
-		}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🔍 Results for \"%s\":\n", query)
+	for _, r := range results {
+		fmt.Fprintf(&sb, "\n• %s (%s): %s\n", r.Message.Role, r.Message.Timestamp.Format("2006-01-02 15:04"), r.Snippet)
 	}
+	b.sendMessage(chatID(msg), sb.String(), false)
 }
 
-func splitMessage(text string, maxLen int) []string {
-	if len(text) <= maxLen {
-		return []string{text}
+func (b *Bot) handleCallback(cb *tgbotapi.CallbackQuery, threadID int) {
+	if cb.Message == nil || !b.isAllowed(cb.From.ID, cb.Message.Chat.ID) {
+		log.Printf("Unauthorized callback from user %d", cb.From.ID)
+		return
 	}
+	msg := &message{Message: cb.Message, ThreadID: threadID}
 
-	var parts []string
-	lines := strings.Split(text, "\n")
-	var current strings.Builder
+	b.API.Request(tgbotapi.NewCallback(cb.ID, ""))
 
-	for _, line := range lines {
-		if current.Len()+len(line)+1 > maxLen {
-			if current.Len() > 0 {
-				parts = append(parts, current.String())
-				current.Reset()
-			}
-			// Handle lines longer than maxLen
-			for len(line) > maxLen {
-				parts = append(parts, line[:maxLen])
-				line = line[maxLen:]
-			}
-		}
-		if current.Len() > 0 {
-			current.WriteString("\n")
-		}
-		current.WriteString(line)
+	switch cb.Data {
+	case callbackRegenerate:
+		// Drop the button from the answer being replaced
+		b.API.Request(tgbotapi.NewEditMessageReplyMarkup(cb.Message.Chat.ID, cb.Message.MessageID,
+			tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}))
+		b.Router.Regenerate(b.replyChannel(chatID(msg)), b.sessionKey(msg, cb.From.ID), chatID(msg))
 	}
+}
 
-	if current.Len() > 0 {
-		parts = append(parts, current.String())
+// Deliver sends an operator's message to the chat behind a session
+func (b *Bot) Deliver(sessionID, text string) error {
+	chat, err := sessionChat(sessionID)
+	if err != nil {
+		return err
 	}
+	_, err = b.Router.Send(b, channels.Outbound{ChatID: chat, Text: text})
+	return err
+}
+
+func (b *Bot) getSessionKey(msg *message) string {
+	// Keyed by chat (DMs and groups), topic and, optionally, group member
+	return b.sessionKey(msg, msg.From.ID)
+}
+
+// chatID returns the chat and topic a message came from, as used in
+// channel messages
+func chatID(msg *message) string {
+	return formatChatID(msg.Chat.ID, msg.ThreadID)
+}
 
-	return parts
+func (b *Bot) sendMessage(chatID string, text string, markdown bool) error {
+	_, err := b.Router.Send(b, channels.Outbound{
+		ChatID:   chatID,
+		Text:     text,
+		Markdown: markdown,
+	})
+	return err
 }
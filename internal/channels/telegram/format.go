@@ -0,0 +1,44 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+)
+
+// Parse modes for markdown messages
+const (
+	ParseModeHTML       = "html"       // Telegram's HTML (default); forgiving of odd markup
+	ParseModeMarkdownV2 = "markdownv2" // Telegram's MarkdownV2
+)
+
+// dialect is the markdown dialect messages are rendered in
+func (b *Bot) dialect() string {
+	if strings.EqualFold(b.Config.ParseMode, ParseModeMarkdownV2) {
+		return channels.MarkdownTelegramV2
+	}
+	return channels.MarkdownTelegramHTML
+}
+
+// format renders a message's text for Telegram and returns it with the
+// parse mode to send it in; plain text has none
+func (b *Bot) format(out channels.Outbound) (string, string) {
+	if !out.Markdown {
+		return out.Text, ""
+	}
+	dialect := b.dialect()
+	mode := tgbotapi.ModeHTML
+	if dialect == channels.MarkdownTelegramV2 {
+		mode = tgbotapi.ModeMarkdownV2
+	}
+	return channels.Render(out.Text, dialect), mode
+}
+
+// isParseError reports whether Telegram rejected a message's markup, in
+// which case it is sent again as plain text
+func isParseError(err error) bool {
+	var tgErr *tgbotapi.Error
+	return errors.As(err, &tgErr) && strings.Contains(tgErr.Message, "can't parse entities")
+}
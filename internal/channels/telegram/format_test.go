@@ -0,0 +1,67 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+func TestMarkdownAnswers(t *testing.T) {
+	api := newFakeBotAPI(t)
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "s3cret",
+	}, session.NewManager(), echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(id int, text string) {
+		t.Helper()
+		update := `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":` + strconv.Itoa(id) + `,"date":0,` +
+			`"from":{"id":7,"first_name":"Ada"},"chat":{"id":7,"type":"private"},"text":"` + text + `"}}`
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+		req.Header.Set(secretHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+	}
+
+	// Answers are rendered as HTML
+	post(1, "**a** < b")
+	waitFor(t, "answer", func() bool { return len(api.called("editMessageText")) == 1 })
+	edit := api.called("editMessageText")[0]
+	if edit["text"] != "echo: <b>a</b> &lt; b" || edit["parse_mode"] != "HTML" {
+		t.Errorf("editMessageText params = %v", edit)
+	}
+
+	// Markup Telegram rejects is sent again as plain text
+	api.mu.Lock()
+	api.rejectMarkup = true
+	api.mu.Unlock()
+	post(2, "**b**")
+	waitFor(t, "plain answer", func() bool { return len(api.called("editMessageText")) == 3 })
+	if edit := api.called("editMessageText")[2]; edit["text"] != "echo: **b**" || edit["parse_mode"] != "" {
+		t.Errorf("editMessageText params = %v", edit)
+	}
+
+	// MarkdownV2 escapes what it reserves
+	api.mu.Lock()
+	api.rejectMarkup = false
+	api.mu.Unlock()
+	bot.Config.ParseMode = ParseModeMarkdownV2
+	bot.Router.Stream = false
+	post(3, "1+1=2.")
+	waitFor(t, "V2 answer", func() bool { return len(api.called("sendMessage")) == 3 })
+	if sent := api.called("sendMessage")[2]; sent["text"] != `echo: 1\+1\=2\.` || sent["parse_mode"] != "MarkdownV2" {
+		t.Errorf("sendMessage params = %v", sent)
+	}
+}
@@ -0,0 +1,203 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Group reply policies
+const (
+	GroupRepliesMention = "mention" // Answer when mentioned, replied to or triggered (default)
+	GroupRepliesAll     = "all"     // Answer every message
+)
+
+// Group session modes
+const (
+	GroupSessionsChat = "chat" // The group (or forum topic) shares a session (default)
+	GroupSessionsUser = "user" // Each member has their own session
+)
+
+// message is a Telegram message with the forum topic it was posted in.
+// tgbotapi v5.5 predates topics, so the topic is decoded separately.
+type message struct {
+	*tgbotapi.Message
+	ThreadID int // message_thread_id; 0 outside forum topics
+}
+
+// update is a Telegram update with the forum topic of its message
+type update struct {
+	tgbotapi.Update
+	ThreadID int
+}
+
+// decodeUpdate decodes an update from the Bot API, including the forum
+// topic fields tgbotapi doesn't know about
+func decodeUpdate(data []byte) (update, error) {
+	var u update
+	if err := json.Unmarshal(data, &u.Update); err != nil {
+		return u, err
+	}
+
+	type topic struct {
+		ThreadID int  `json:"message_thread_id"`
+		IsTopic  bool `json:"is_topic_message"`
+	}
+	var raw struct {
+		Message       *topic `json:"message"`
+		CallbackQuery *struct {
+			Message *topic `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return u, err
+	}
+
+	// Replies in ordinary supergroups carry a thread ID too, but only
+	// forum topics accept one when sending
+	t := raw.Message
+	if raw.CallbackQuery != nil {
+		t = raw.CallbackQuery.Message
+	}
+	if t != nil && t.IsTopic {
+		u.ThreadID = t.ThreadID
+	}
+	return u, nil
+}
+
+// isGroup reports whether a message was sent in a group chat
+func isGroup(msg *message) bool {
+	return msg.Chat.IsGroup() || msg.Chat.IsSuperGroup()
+}
+
+// addressed reports whether a group message is meant for the bot, and
+// returns its text without the bot's @mention
+func (b *Bot) addressed(msg *message) (string, bool) {
+	text := messageText(msg)
+	mention := "@" + b.API.Self.UserName
+
+	mentioned := false
+	if i := strings.Index(strings.ToLower(text), strings.ToLower(mention)); i >= 0 {
+		text = strings.TrimSpace(text[:i] + text[i+len(mention):])
+		mentioned = true
+	}
+
+	if b.Config.GroupReplies == GroupRepliesAll || mentioned {
+		return text, true
+	}
+	if r := msg.ReplyToMessage; r != nil && r.From != nil && r.From.ID == b.API.Self.ID {
+		return text, true
+	}
+	for _, word := range b.Config.TriggerWords {
+		if containsWord(text, word) {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// forOtherBot reports whether a command names another bot, as in
+// /start@otherbot
+func (b *Bot) forOtherBot(msg *message) bool {
+	_, bot, ok := strings.Cut(msg.CommandWithAt(), "@")
+	return ok && !strings.EqualFold(bot, b.API.Self.UserName)
+}
+
+// containsWord reports whether text contains word on its own, ignoring case
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	text, word = strings.ToLower(text), strings.ToLower(word)
+	for start := 0; ; {
+		i := strings.Index(text[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(word):])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// senderName is how a group member is named in the conversation
+func senderName(u *tgbotapi.User) string {
+	if u == nil {
+		return "Someone"
+	}
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = "@" + u.UserName
+	}
+	return name
+}
+
+// sessionKey returns the session for a user in a chat: tg_<chat>, with
+// _t<topic> in forum topics and _u<user> for per-user group sessions
+func (b *Bot) sessionKey(msg *message, userID int64) string {
+	key := fmt.Sprintf("tg_%d", msg.Chat.ID)
+	if msg.ThreadID != 0 {
+		key += fmt.Sprintf("_t%d", msg.ThreadID)
+	}
+	if isGroup(msg) && b.Config.GroupSessions == GroupSessionsUser {
+		key += fmt.Sprintf("_u%d", userID)
+	}
+	return key
+}
+
+// sessionChat returns the chat, as used in channel messages, that a
+// session key belongs to
+func sessionChat(sessionID string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(sessionID, "tg_"), "_")
+	chat, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || !strings.HasPrefix(sessionID, "tg_") {
+		return "", fmt.Errorf("not a Telegram session: %s", sessionID)
+	}
+
+	thread := 0
+	for _, p := range parts[1:] {
+		if strings.HasPrefix(p, "t") {
+			thread, _ = strconv.Atoi(p[1:])
+		}
+	}
+	return formatChatID(chat, thread), nil
+}
+
+// formatChatID encodes a chat and forum topic as a channel chat ID:
+// "<chat>" or "<chat>:<topic>"
+func formatChatID(chat int64, thread int) string {
+	if thread == 0 {
+		return strconv.FormatInt(chat, 10)
+	}
+	return fmt.Sprintf("%d:%d", chat, thread)
+}
+
+// parseChatID decodes a chat ID made by formatChatID
+func parseChatID(s string) (int64, int, error) {
+	chatPart, threadPart, hasThread := strings.Cut(s, ":")
+	chat, err := strconv.ParseInt(chatPart, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chat ID: %s", s)
+	}
+	if !hasThread {
+		return chat, 0, nil
+	}
+	thread, err := strconv.Atoi(threadPart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chat ID: %s", s)
+	}
+	return chat, thread, nil
+}
@@ -0,0 +1,88 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+func TestGroupReplies(t *testing.T) {
+	api := newFakeBotAPI(t)
+	sessions := session.NewManager()
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "s3cret",
+		TriggerWords:  []string{"hive"},
+		GroupSessions: GroupSessionsUser,
+	}, sessions, echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Router.Stream = false
+
+	post := func(update string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+		req.Header.Set(secretHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+	}
+	group := func(id int, text, extra string) string {
+		return `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":` + strconv.Itoa(id) + `,"date":0,` +
+			`"from":{"id":7,"first_name":"Ada"},"chat":{"id":-100,"type":"supergroup","is_forum":true},` +
+			`"text":"` + text + `"` + extra + `}}`
+	}
+
+	// Chatter between members is ignored, as are hives inside other words
+	post(group(1, "lunch anyone?", ""))
+	post(group(2, "archives are down", ""))
+	time.Sleep(50 * time.Millisecond)
+	if sent := api.called("sendMessage"); len(sent) != 0 {
+		t.Fatalf("answered chatter: %v", sent)
+	}
+
+	// A mention in a forum topic is answered in that topic
+	post(group(3, "@hive_bot what is 2+2?", `,"message_thread_id":9,"is_topic_message":true`))
+	waitFor(t, "mention answer", func() bool { return len(api.called("sendMessage")) == 1 })
+	sent := api.called("sendMessage")[0]
+	if sent["chat_id"] != "-100" || sent["message_thread_id"] != "9" || sent["text"] != "echo: what is 2+2?" {
+		t.Errorf("sendMessage params = %v", sent)
+	}
+	if _, ok := sessions.Get("tg_-100_t9_u7"); !ok {
+		t.Errorf("no per-user topic session")
+	}
+
+	// Trigger words address the bot too
+	post(group(4, "Hive, hello", ""))
+	waitFor(t, "trigger answer", func() bool { return len(api.called("sendMessage")) == 2 })
+	if sent := api.called("sendMessage")[1]; sent["message_thread_id"] != "" || sent["reply_to_message_id"] != "4" {
+		t.Errorf("sendMessage params = %v", sent)
+	}
+}
+
+func TestSessionChat(t *testing.T) {
+	tests := map[string]string{
+		"tg_42":         "42",
+		"tg_-100_t9":    "-100:9",
+		"tg_-100_u7":    "-100",
+		"tg_-100_t9_u7": "-100:9",
+	}
+	for id, want := range tests {
+		if got, err := sessionChat(id); err != nil || got != want {
+			t.Errorf("sessionChat(%q) = %q, %v; want %q", id, got, err, want)
+		}
+	}
+	if _, err := sessionChat("discord_1_2"); err == nil {
+		t.Errorf("accepted a Discord session")
+	}
+}
@@ -0,0 +1,119 @@
+package telegram
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// messageText is a message's text, or the caption of a photo or document
+func messageText(msg *message) string {
+	if msg.Text != "" {
+		return msg.Text
+	}
+	return msg.Caption
+}
+
+// media collects the photo or document sent with a message. Files aren't
+// downloaded here, which would hold up the update loop; the router fetches
+// them when the message's turn runs. It returns the names of files it had
+// to skip.
+func (b *Bot) media(msg *message) ([]channels.Media, []string) {
+	var media []channels.Media
+	var skipped []string
+
+	add := func(kind, mediaType, name, fileID string, size int) {
+		media = append(media, channels.Media{
+			Attachment: session.Attachment{
+				Type:      kind,
+				MediaType: mediaType,
+				Name:      name,
+				Ref:       fileID,
+				Size:      size,
+			},
+		})
+	}
+
+	// Photos come in several sizes; take the largest that fits
+	if len(msg.Photo) > 0 {
+		var photo *tgbotapi.PhotoSize
+		for i, p := range msg.Photo {
+			if p.FileSize <= channels.MaxMediaBytes {
+				photo = &msg.Photo[i]
+			}
+		}
+		if photo == nil {
+			skipped = append(skipped, "photo")
+		} else {
+			add(llm.PartImage, "image/jpeg", "photo.jpg", photo.FileID, photo.FileSize)
+		}
+	}
+
+	if d := msg.Document; d != nil {
+		kind := channels.MediaKind(d.MimeType)
+		if kind == "" || d.FileSize > channels.MaxMediaBytes {
+			skipped = append(skipped, d.FileName)
+		} else {
+			add(kind, d.MimeType, d.FileName, d.FileID, d.FileSize)
+		}
+	}
+	return media, skipped
+}
+
+// transcribe turns a voice note or audio file into text. ok is false when
+// the message has audio that could not be transcribed; the user has been
+// told why.
+func (b *Bot) transcribe(msg *message) (text string, hasAudio, ok bool) {
+	var audio session.Attachment
+	switch {
+	case msg.Voice != nil:
+		audio = session.Attachment{Ref: msg.Voice.FileID, MediaType: msg.Voice.MimeType, Name: "voice.ogg", Size: msg.Voice.FileSize}
+	case msg.Audio != nil:
+		audio = session.Attachment{Ref: msg.Audio.FileID, MediaType: msg.Audio.MimeType, Name: msg.Audio.FileName, Size: msg.Audio.FileSize}
+	default:
+		return "", false, true
+	}
+	if audio.MediaType == "" {
+		audio.MediaType = "audio/ogg"
+	}
+	if audio.Name == "" {
+		audio.Name = "audio.ogg"
+	}
+
+	replyTo := ""
+	if isGroup(msg) {
+		replyTo = strconv.Itoa(msg.MessageID)
+	}
+	text, ok = b.Router.Transcribe(b, chatID(msg), replyTo, audio, func() ([]byte, error) {
+		return b.fetch(audio.Ref, channels.MaxAudioBytes)
+	})
+	return text, true, ok
+}
+
+// Fetch downloads a file by its Telegram file ID
+func (b *Bot) Fetch(ref string) ([]byte, error) {
+	return b.fetch(ref, channels.MaxMediaBytes)
+}
+
+func (b *Bot) fetch(fileID string, limit int) ([]byte, error) {
+	file, err := b.API.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return nil, err
+	}
+	return channels.Download(b.fileURL(file.FilePath), limit)
+}
+
+// fileURL is where a file is downloaded from. Local Bot API servers serve
+// files next to the API, so the URL follows APIEndpoint.
+func (b *Bot) fileURL(path string) string {
+	endpoint := tgbotapi.FileEndpoint
+	if e := b.Config.APIEndpoint; strings.Contains(e, "/bot%s/%s") {
+		endpoint = strings.Replace(e, "/bot%s/%s", "/file/bot%s/%s", 1)
+	}
+	return fmt.Sprintf(endpoint, b.API.Token, path)
+}
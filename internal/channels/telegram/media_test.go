@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// partsLLM answers with the documents it was sent
+type partsLLM struct {
+	mu    sync.Mutex
+	parts []llm.Part
+}
+
+func (p *partsLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parts = append(p.parts, messages[len(messages)-1].Parts...)
+	return &llm.Response{Content: "got it"}, nil
+}
+
+func (p *partsLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	panic("not streaming")
+}
+
+func TestMediaIsFetchedInTheTurn(t *testing.T) {
+	api := newFakeBotAPI(t)
+	api.fileGate = make(chan struct{})
+	provider := &partsLLM{}
+	sessions := session.NewManager()
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "s3cret",
+	}, sessions, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Router.Stream = false
+
+	update := `{"update_id":1,"message":{"message_id":1,"date":0,` +
+		`"from":{"id":7,"first_name":"Ada"},"chat":{"id":7,"type":"private"},"caption":"summarize",` +
+		`"document":{"file_id":"d1","file_unique_id":"u","file_name":"notes.txt","mime_type":"text/plain","file_size":15}}}`
+	served := make(chan int)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+		req.Header.Set(secretHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		served <- rec.Code
+	}()
+
+	// The update is acknowledged while the download is still held up
+	select {
+	case code := <-served:
+		if code != http.StatusOK {
+			t.Fatalf("status %d", code)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook waited for the download")
+	}
+	close(api.fileGate)
+
+	waitFor(t, "answer", func() bool { return len(api.called("sendMessage")) == 1 })
+	if got := api.called("getFile"); len(got) != 1 || got[0]["file_id"] != "d1" {
+		t.Errorf("getFile calls = %v", got)
+	}
+	provider.mu.Lock()
+	if len(provider.parts) != 1 || !strings.Contains(provider.parts[0].Text, "OggS fake audio") {
+		t.Errorf("LLM got parts %+v", provider.parts)
+	}
+	provider.mu.Unlock()
+
+	messages, _ := sessions.GetMessages("tg_7")
+	if len(messages) != 2 || len(messages[0].Attachments) != 1 || messages[0].Attachments[0].Size != 15 {
+		t.Errorf("session messages = %+v", messages)
+	}
+}
@@ -0,0 +1,168 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/voice"
+)
+
+// voiceNoteTypes are the formats Telegram plays as voice notes; other
+// audio is sent as a music file
+var voiceNoteTypes = map[string]bool{
+	"audio/ogg":  true,
+	"audio/mpeg": true,
+	"audio/mp4":  true,
+}
+
+// replyChannel is the channel answers in a chat go through: the bot
+// itself, or a voice reply when the chat turned voice replies on
+func (b *Bot) replyChannel(chat string) channels.Channel {
+	if b.Config.TTS == nil {
+		return b
+	}
+	if on, _ := b.voiceChats.Load(chat); on != true {
+		return b
+	}
+	return &voiceReply{bot: b}
+}
+
+// toggleVoice handles /voice [on|off] for a chat
+func (b *Bot) toggleVoice(msg *message) {
+	if b.Config.TTS == nil {
+		b.sendMessage(chatID(msg), "🔇 Voice replies aren't set up on this bot.", false)
+		return
+	}
+
+	chat := chatID(msg)
+	on, _ := b.voiceChats.Load(chat)
+	enable := on != true
+	switch strings.ToLower(strings.TrimSpace(msg.CommandArguments())) {
+	case "on":
+		enable = true
+	case "off":
+		enable = false
+	case "":
+	default:
+		b.sendMessage(chat, "Usage: /voice [on|off]", false)
+		return
+	}
+
+	if enable {
+		b.voiceChats.Store(chat, true)
+		b.sendMessage(chat, "🔊 I'll answer with voice notes here. Long or code-heavy answers still come as text.", false)
+	} else {
+		b.voiceChats.Delete(chat)
+		b.sendMessage(chat, "🔇 Back to text answers.", false)
+	}
+}
+
+// voiceReply is a chat's channel while voice replies are on. It speaks
+// answers that suit it and sends everything else as text. It isn't an
+// editor, so answers arrive whole instead of streaming.
+type voiceReply struct {
+	bot *Bot
+}
+
+var _ channels.MediaFetcher = (*voiceReply)(nil)
+
+func (v *voiceReply) Name() string { return v.bot.Name() }
+
+// Capabilities lift the length limit so answers arrive unsplit; text
+// fallbacks are split when sent
+func (v *voiceReply) Capabilities() channels.Capabilities {
+	caps := v.bot.Capabilities()
+	caps.MaxMessageLength = 0
+	return caps
+}
+
+func (v *voiceReply) Start() error { return nil }
+func (v *voiceReply) Stop() error  { return nil }
+
+func (v *voiceReply) Typing(chatID string) error {
+	return v.bot.Typing(chatID)
+}
+
+// Fetch downloads attachments for the router like the bot does
+func (v *voiceReply) Fetch(ref string) ([]byte, error) {
+	return v.bot.Fetch(ref)
+}
+
+// Send speaks answers, which are the messages offering regeneration, and
+// falls back to text when an answer is too long, too code-heavy or can't
+// be synthesized
+func (v *voiceReply) Send(out channels.Outbound) (string, error) {
+	if !out.Regenerate || out.Attachment != nil || !voice.Speakable(out.Text, v.bot.Config.MaxSpokenChars) {
+		return v.bot.Router.Send(v.bot, out)
+	}
+
+	v.bot.chatAction(out.ChatID, tgbotapi.ChatRecordVoice)
+	audio, mediaType, err := v.bot.Config.TTS.Synthesize(voice.SpokenText(out.Text))
+	if err != nil {
+		log.Printf("Speech synthesis error, answering in text: %v", err)
+		return v.bot.Router.Send(v.bot, out)
+	}
+
+	id, err := v.bot.sendVoice(out, audio, mediaType)
+	if err != nil {
+		log.Printf("Failed to send voice reply, answering in text: %v", err)
+		return v.bot.Router.Send(v.bot, out)
+	}
+	return id, nil
+}
+
+// sendVoice sends audio as a voice note, or as a music file when Telegram
+// can't play its format as one
+func (b *Bot) sendVoice(out channels.Outbound, audio []byte, mediaType string) (string, error) {
+	chat, thread, err := parseChatID(out.ChatID)
+	if err != nil {
+		return "", err
+	}
+
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chat)
+	params.AddNonZero("message_thread_id", thread)
+	replyTo, _ := strconv.Atoi(out.ReplyTo)
+	params.AddNonZero("reply_to_message_id", replyTo)
+	if out.Regenerate {
+		params.AddInterface("reply_markup", regenerateMarkup())
+	}
+
+	method, field := "sendVoice", "voice"
+	if !voiceNoteTypes[mediaType] {
+		method, field = "sendAudio", "audio"
+	}
+	resp, err := b.API.UploadFiles(method, params, []tgbotapi.RequestFile{{
+		Name: field,
+		Data: tgbotapi.FileBytes{Name: "answer" + audioExtension(mediaType), Bytes: audio},
+	}})
+	if err != nil {
+		return "", retryAfter(err)
+	}
+
+	var sent tgbotapi.Message
+	if err := json.Unmarshal(resp.Result, &sent); err != nil {
+		return "", fmt.Errorf("invalid sent message: %w", err)
+	}
+	return strconv.Itoa(sent.MessageID), nil
+}
+
+// audioExtension names audio files by format
+func audioExtension(mediaType string) string {
+	switch mediaType {
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4":
+		return ".m4a"
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return ".wav"
+	case "audio/flac":
+		return ".flac"
+	}
+	return ".ogg"
+}
@@ -0,0 +1,195 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/channels"
+	"github.com/nanilabs/hiveclaw/internal/session"
+	"github.com/nanilabs/hiveclaw/internal/voice"
+)
+
+func TestVoiceMessages(t *testing.T) {
+	api := newFakeBotAPI(t)
+	stt := &voice.FakeTranscriber{Text: "what time is it"}
+	sessions := session.NewManager()
+	bot, err := New(Config{
+		Token:          "123:abc",
+		APIEndpoint:    api.endpoint(),
+		WebhookURL:     "https://bot.example.com/telegram/webhook",
+		WebhookSecret:  "s3cret",
+		STT:            stt,
+		EchoTranscript: true,
+	}, sessions, echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Router.Stream = false
+
+	post := func(id int) {
+		t.Helper()
+		update := `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":` + strconv.Itoa(id) + `,"date":0,` +
+			`"from":{"id":7,"first_name":"Ada"},"chat":{"id":7,"type":"private"},` +
+			`"voice":{"file_id":"v` + strconv.Itoa(id) + `","file_unique_id":"u","duration":2,"mime_type":"audio/ogg","file_size":15}}}`
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+		req.Header.Set(secretHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+	}
+
+	// The transcript is echoed, answered and stored as the user's message
+	post(1)
+	waitFor(t, "answer", func() bool { return len(api.called("sendMessage")) == 2 })
+	sent := api.called("sendMessage")
+	if sent[0]["text"] != "🎤 what time is it" || sent[1]["text"] != "echo: what time is it" {
+		t.Errorf("sent %q, %q", sent[0]["text"], sent[1]["text"])
+	}
+	if files := stt.Files(); len(files) != 1 || files[0] != "voice.ogg" {
+		t.Errorf("transcribed %v", files)
+	}
+	if got := api.called("getFile"); len(got) != 1 || got[0]["file_id"] != "v1" {
+		t.Errorf("getFile calls = %v", got)
+	}
+	messages, _ := sessions.GetMessages("tg_7")
+	if len(messages) != 2 || messages[0].Content != "what time is it" {
+		t.Errorf("session messages = %+v", messages)
+	}
+
+	// Without an STT engine voice notes are refused
+	bot.Router.STT = nil
+	post(2)
+	waitFor(t, "refusal", func() bool { return len(api.called("sendMessage")) == 3 })
+	if got := api.called("sendMessage")[2]["text"]; got != channels.VoiceDisabledMessage {
+		t.Errorf("sent %q", got)
+	}
+}
+
+func TestVoiceReplies(t *testing.T) {
+	api := newFakeBotAPI(t)
+	tts := &voice.FakeSynthesizer{Audio: []byte("OggS answer")}
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "s3cret",
+		TTS:           tts,
+	}, session.NewManager(), echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(id int, text string) {
+		t.Helper()
+		entities := ""
+		if strings.HasPrefix(text, "/") {
+			entities = `,"entities":[{"type":"bot_command","offset":0,"length":6}]`
+		}
+		update := `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":` + strconv.Itoa(id) + `,"date":0,` +
+			`"from":{"id":7,"first_name":"Ada"},"chat":{"id":7,"type":"private"},"text":"` + text + `"` + entities + `}}`
+		req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+		req.Header.Set(secretHeader, "s3cret")
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d", rec.Code)
+		}
+	}
+
+	post(1, "/voice")
+	waitFor(t, "toggle reply", func() bool { return len(api.called("sendMessage")) == 1 })
+
+	// Short answers are spoken, without markdown
+	post(2, "**hello** there")
+	waitFor(t, "voice answer", func() bool { return len(api.called("sendVoice")) == 1 })
+	if texts := tts.Texts(); len(texts) != 1 || texts[0] != "echo: hello there" {
+		t.Errorf("synthesized %q", texts)
+	}
+	if got := api.called("sendVoice")[0]; got["chat_id"] != "7" || got["reply_markup"] == "" {
+		t.Errorf("sendVoice params = %v", got)
+	}
+
+	// Code is sent as text
+	post(3, "```go\\nfmt.Println()\\n```")
+	waitFor(t, "text answer", func() bool { return len(api.called("sendMessage")) == 2 })
+	if len(tts.Texts()) != 1 {
+		t.Errorf("spoke code")
+	}
+
+	// Turned off, answers stream as text again
+	post(4, "/voice off")
+	waitFor(t, "toggle reply", func() bool { return len(api.called("sendMessage")) == 3 })
+	post(5, "hi")
+	waitFor(t, "text answer", func() bool { return len(api.called("sendMessage")) == 4 })
+	if len(api.called("sendVoice")) != 1 {
+		t.Errorf("answered with voice after /voice off")
+	}
+}
+
+func TestVoiceDoesNotBlockUpdates(t *testing.T) {
+	api := newFakeBotAPI(t)
+	api.fileGate = make(chan struct{})
+	sessions := session.NewManager()
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/telegram/webhook",
+		WebhookSecret: "s3cret",
+		STT:           &voice.FakeTranscriber{Text: "first"},
+	}, sessions, echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.Router.Stream = false
+
+	post := func(id int, chat, content string) {
+		t.Helper()
+		update := `{"update_id":` + strconv.Itoa(id) + `,"message":{"message_id":` + strconv.Itoa(id) + `,"date":0,` +
+			`"from":{"id":` + chat + `,"first_name":"Ada"},"chat":{"id":` + chat + `,"type":"private"},` + content + `}}`
+		done := make(chan int, 1)
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/telegram/webhook", strings.NewReader(update))
+			req.Header.Set(secretHeader, "s3cret")
+			rec := httptest.NewRecorder()
+			bot.ServeHTTP(rec, req)
+			done <- rec.Code
+		}()
+		select {
+		case code := <-done:
+			if code != http.StatusOK {
+				t.Fatalf("status %d", code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("update %d held up by a transcription", id)
+		}
+	}
+
+	// The voice note's download is held up; later updates still go through
+	post(1, "7", `"voice":{"file_id":"v1","file_unique_id":"u","duration":2,"mime_type":"audio/ogg","file_size":15}`)
+	post(2, "7", `"text":"second"`)
+	post(3, "8", `"text":"elsewhere"`)
+
+	// Other chats are answered meanwhile
+	waitFor(t, "other chat", func() bool { return len(api.called("sendMessage")) == 1 })
+	if got := api.called("sendMessage")[0]; got["chat_id"] != "8" {
+		t.Errorf("answered chat %s first", got["chat_id"])
+	}
+
+	// The chat with the voice note keeps its order
+	close(api.fileGate)
+	waitFor(t, "voice chat", func() bool { return len(api.called("sendMessage")) == 3 })
+	messages, _ := sessions.GetMessages("tg_7")
+	var got []string
+	for _, m := range messages {
+		got = append(got, m.Content)
+	}
+	if strings.Join(got, "|") != "first|echo: first|second|echo: second" {
+		t.Errorf("chat 7 messages %q", got)
+	}
+}
@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretHeader carries the webhook secret token on updates from Telegram
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// DefaultWebhookPath is served when the webhook URL has no path
+const DefaultWebhookPath = "/telegram/webhook"
+
+// WebhookPath returns the HTTP path webhook updates are posted to, or ""
+// when the bot is configured for long polling
+func (b *Bot) WebhookPath() string {
+	if b.Config.WebhookURL == "" {
+		return ""
+	}
+	u, err := url.Parse(b.Config.WebhookURL)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return DefaultWebhookPath
+	}
+	return u.Path
+}
+
+// ServeHTTP receives webhook updates. Requests must carry the secret token
+// registered with setWebhook.
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.Header.Get(secretHeader)
+	if b.secret == "" || subtle.ConstantTimeCompare([]byte(token), []byte(b.secret)) != 1 {
+		log.Printf("Rejected Telegram webhook request from %s: bad secret token", r.RemoteAddr)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+	u, err := decodeUpdate(body)
+	if err != nil {
+		http.Error(w, "Invalid update", http.StatusBadRequest)
+		return
+	}
+
+	b.dispatch(u)
+	w.WriteHeader(http.StatusOK)
+}
+
+// setWebhook registers the webhook URL and secret token with Telegram.
+// tgbotapi's WebhookConfig predates secret tokens, so the request is made
+// directly.
+func (b *Bot) setWebhook() error {
+	_, err := b.API.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":             b.Config.WebhookURL,
+		"secret_token":    b.secret,
+		"allowed_updates": `["message","callback_query"]`,
+	})
+	return err
+}
+
+// deleteWebhook removes any registered webhook so polling works again
+func (b *Bot) deleteWebhook() error {
+	_, err := b.API.Request(tgbotapi.DeleteWebhookConfig{})
+	return err
+}
+
+// newSecret generates a webhook secret token
+func newSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,228 @@
+package telegram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// fakeBotAPI is a local stand-in for the Telegram Bot API that records the
+// methods called on it
+type fakeBotAPI struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	calls        map[string][]map[string]string
+	rejectHook   bool
+	rejectMarkup bool // Fail messages with a parse mode
+	pollingStart chan struct{}
+	pollOnce     sync.Once
+	fileGate     chan struct{} // Holds file downloads until closed, when set
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	f := &fakeBotAPI{
+		calls:        make(map[string][]map[string]string),
+		pollingStart: make(chan struct{}),
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeBotAPI) endpoint() string {
+	return f.URL + "/bot%s/%s"
+}
+
+func (f *fakeBotAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/file/") {
+		if f.fileGate != nil {
+			<-f.fileGate
+		}
+		w.Write([]byte("OggS fake audio"))
+		return
+	}
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	r.ParseForm()
+	r.ParseMultipartForm(1 << 20)
+	params := make(map[string]string)
+	for k := range r.Form {
+		params[k] = r.Form.Get(k)
+	}
+
+	f.mu.Lock()
+	f.calls[method] = append(f.calls[method], params)
+	reject, rejectMarkup := f.rejectHook, f.rejectMarkup
+	f.mu.Unlock()
+
+	if rejectMarkup && params["parse_mode"] != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: can't parse entities: unexpected end tag"})
+		return
+	}
+
+	var result interface{} = true
+	switch method {
+	case "getMe":
+		result = map[string]interface{}{"id": 1, "is_bot": true, "first_name": "Hive", "username": "hive_bot"}
+	case "setWebhook":
+		if reject {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": "Bad Request: bad webhook"})
+			return
+		}
+	case "getUpdates":
+		f.pollOnce.Do(func() { close(f.pollingStart) })
+		time.Sleep(10 * time.Millisecond)
+		result = []interface{}{}
+	case "getFile":
+		result = map[string]interface{}{"file_id": params["file_id"], "file_path": "voice/file_1.oga"}
+	case "sendMessage", "editMessageText", "sendVoice":
+		result = map[string]interface{}{
+			"message_id": len(f.calls[method]),
+			"date":       time.Now().Unix(),
+			"chat":       map[string]interface{}{"id": json.Number(params["chat_id"]), "type": "private"},
+			"text":       params["text"],
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *fakeBotAPI) called(method string) []map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]string{}, f.calls[method]...)
+}
+
+type echoLLM struct{}
+
+func (echoLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return &llm.Response{Content: "echo: " + messages[len(messages)-1].Content}, nil
+}
+
+func (echoLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk, 2)
+	ch <- llm.StreamChunk{Content: "echo: " + messages[len(messages)-1].Content}
+	ch <- llm.StreamChunk{Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookMode(t *testing.T) {
+	api := newFakeBotAPI(t)
+	bot, err := New(Config{
+		Token:         "123:abc",
+		APIEndpoint:   api.endpoint(),
+		WebhookURL:    "https://bot.example.com/hooks/telegram",
+		WebhookSecret: "s3cret",
+	}, session.NewManager(), echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bot.WebhookPath(); got != "/hooks/telegram" {
+		t.Errorf("WebhookPath() = %q", got)
+	}
+
+	done := make(chan error)
+	go func() { done <- bot.Start() }()
+	waitFor(t, "setWebhook", func() bool { return len(api.called("setWebhook")) == 1 })
+
+	hook := api.called("setWebhook")[0]
+	if hook["url"] != "https://bot.example.com/hooks/telegram" || hook["secret_token"] != "s3cret" {
+		t.Errorf("setWebhook params = %v", hook)
+	}
+
+	update := `{"update_id":1,"message":{"message_id":7,"date":0,"from":{"id":42,"first_name":"A"},"chat":{"id":42,"type":"private"},"text":"hello"}}`
+	post := func(secret string) int {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/telegram", strings.NewReader(update))
+		if secret != "" {
+			req.Header.Set(secretHeader, secret)
+		}
+		rec := httptest.NewRecorder()
+		bot.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := post(""); code != http.StatusUnauthorized {
+		t.Errorf("missing secret: status %d", code)
+	}
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d", code)
+	}
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Fatalf("valid update: status %d", code)
+	}
+
+	// The answer is streamed into a placeholder
+	waitFor(t, "reply", func() bool { return len(api.called("editMessageText")) == 1 })
+	if sent := api.called("sendMessage"); len(sent) != 1 || sent[0]["chat_id"] != "42" {
+		t.Errorf("sendMessage calls = %v", sent)
+	}
+	if edit := api.called("editMessageText")[0]; edit["text"] != "echo: hello" || edit["reply_markup"] == "" {
+		t.Errorf("editMessageText params = %v", edit)
+	}
+
+	if err := bot.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(api.called("deleteWebhook")) != 1 {
+		t.Errorf("deleteWebhook not called on Stop")
+	}
+	if len(api.called("getUpdates")) != 0 {
+		t.Errorf("polled in webhook mode")
+	}
+}
+
+func TestWebhookFallsBackToPolling(t *testing.T) {
+	api := newFakeBotAPI(t)
+	api.rejectHook = true
+
+	bot, err := New(Config{
+		Token:       "123:abc",
+		APIEndpoint: api.endpoint(),
+		WebhookURL:  "https://bot.example.com/",
+	}, session.NewManager(), echoLLM{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bot.WebhookPath(); got != DefaultWebhookPath {
+		t.Errorf("WebhookPath() = %q", got)
+	}
+
+	done := make(chan error)
+	go func() { done <- bot.Start() }()
+
+	select {
+	case <-api.pollingStart:
+	case <-time.After(2 * time.Second):
+		t.Fatal("did not fall back to polling")
+	}
+	if hook := api.called("setWebhook"); len(hook) != 1 || hook[0]["secret_token"] == "" {
+		t.Errorf("setWebhook calls = %v", hook)
+	}
+	if len(api.called("deleteWebhook")) != 1 {
+		t.Errorf("webhook not cleared before polling")
+	}
+
+	bot.Stop()
+	<-done
+}
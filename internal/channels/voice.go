@@ -0,0 +1,62 @@
+package channels
+
+import (
+	"log"
+	"strings"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// MaxAudioBytes is the largest voice message transcribed. Telegram bots
+// can't download more, and Whisper APIs take little more.
+const MaxAudioBytes = 20 << 20
+
+// Replies about voice messages
+const (
+	VoiceDisabledMessage = "🎤 Voice messages aren't enabled here. Please type your message."
+	VoiceFailedMessage   = "🎤 Sorry, I couldn't make out that voice message. Please try again or type it."
+	VoiceTooLongMessage  = "🎤 That recording is too long for me."
+)
+
+// IsAudio reports whether a media type is audio that can be transcribed
+func IsAudio(mediaType string) bool {
+	return strings.HasPrefix(strings.ToLower(mediaType), "audio/")
+}
+
+// Transcribe turns a voice message into text with the router's STT
+// engine, downloading it with fetch. It tells the user when it can't and,
+// with EchoTranscript, shows them what was heard. The transcript becomes
+// the user's message.
+func (r *Router) Transcribe(ch Channel, chatID, replyTo string, audio session.Attachment, fetch func() ([]byte, error)) (string, bool) {
+	fail := func(text string) (string, bool) {
+		r.Send(ch, Outbound{ChatID: chatID, Text: text, ReplyTo: replyTo})
+		return "", false
+	}
+	if r.STT == nil {
+		return fail(VoiceDisabledMessage)
+	}
+	if audio.Size > MaxAudioBytes {
+		return fail(VoiceTooLongMessage)
+	}
+
+	if ch.Capabilities().Typing {
+		ch.Typing(chatID)
+	}
+	data, err := fetch()
+	if err != nil {
+		log.Printf("Failed to download %s voice message: %v", ch.Name(), err)
+		return fail(VoiceFailedMessage)
+	}
+	text, err := r.STT.Transcribe(data, audio.Name, audio.MediaType)
+	if err != nil || text == "" {
+		if err != nil {
+			log.Printf("Transcription error: %v", err)
+		}
+		return fail(VoiceFailedMessage)
+	}
+
+	if r.EchoTranscript {
+		r.Send(ch, Outbound{ChatID: chatID, Text: "🎤 " + text, ReplyTo: replyTo})
+	}
+	return text, true
+}
@@ -0,0 +1,191 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+)
+
+func anthropicError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": "error",
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+func anthropicStopReason(stopReason string) string {
+	switch stopReason {
+	case "", "stop":
+		return "end_turn"
+	case "length":
+		return "max_tokens"
+	default:
+		return stopReason
+	}
+}
+
+func (g *Gateway) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		anthropicError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+		return
+	}
+
+	var req llm.ClaudeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		anthropicError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if len(req.Messages) == 0 {
+		anthropicError(w, http.StatusBadRequest, "invalid_request_error", "messages is required")
+		return
+	}
+	if g.LLM == nil {
+		anthropicError(w, http.StatusServiceUnavailable, "api_error", "LLM not configured")
+		return
+	}
+
+	opts := g.resolveModel(req.Model)
+	opts.MaxTokens = req.MaxTokens
+	opts.Temperature = req.Temperature
+	opts.Context = r.Context()
+	if req.System != "" {
+		opts.System = req.System
+	}
+
+	prompt := ""
+	if last := req.Messages[len(req.Messages)-1]; last.Role == "user" {
+		prompt = last.Content
+	}
+
+	id := fmt.Sprintf("msg_%d", time.Now().UnixNano())
+
+	if req.Stream {
+		g.streamMessages(w, r, id, req.Model, prompt, req.Messages, opts)
+		return
+	}
+
+	resp, err := g.LLM.Chat(req.Messages, opts)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		anthropicError(w, http.StatusBadGateway, "api_error", fmt.Sprintf("LLM error: %v", err))
+		return
+	}
+
+	g.recordExchange(r, prompt, resp.Content)
+
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":   id,
+		"type": "message",
+		"role": "assistant",
+		"content": []map[string]string{
+			{"type": "text", "text": resp.Content},
+		},
+		"model":         model,
+		"stop_reason":   anthropicStopReason(resp.StopReason),
+		"stop_sequence": nil,
+		"usage":         resp.Usage,
+	})
+}
+
+func (g *Gateway) streamMessages(w http.ResponseWriter, r *http.Request, id, model, prompt string, messages []llm.Message, opts llm.Options) {
+	chunks, err := g.LLM.Stream(messages, opts)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		anthropicError(w, http.StatusBadGateway, "api_error", fmt.Sprintf("LLM error: %v", err))
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		anthropicError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+
+	sse.Event("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            id,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []interface{}{},
+			"model":         model,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         llm.Usage{},
+		},
+	})
+	sse.Event("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         0,
+		"content_block": map[string]string{"type": "text", "text": ""},
+	})
+
+	var content strings.Builder
+	var final llm.StreamChunk
+	for c := range chunks {
+		if c.Error != nil {
+			log.Printf("LLM stream error: %v", c.Error)
+			sse.Event("error", map[string]interface{}{
+				"type": "error",
+				"error": map[string]string{
+					"type":    "api_error",
+					"message": c.Error.Error(),
+				},
+			})
+			return
+		}
+		if c.Done {
+			final = c
+			continue
+		}
+		if c.Content != "" {
+			content.WriteString(c.Content)
+			sse.Event("content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": 0,
+				"delta": map[string]string{"type": "text_delta", "text": c.Content},
+			})
+		}
+	}
+
+	if r.Context().Err() != nil {
+		return
+	}
+
+	usage := llm.Usage{}
+	if final.Usage != nil {
+		usage = *final.Usage
+	}
+
+	sse.Event("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": 0,
+	})
+	sse.Event("message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   anthropicStopReason(final.StopReason),
+			"stop_sequence": nil,
+		},
+		"usage": map[string]int{"output_tokens": usage.OutputTokens},
+	})
+	sse.Event("message_stop", map[string]string{"type": "message_stop"})
+
+	g.recordExchange(r, prompt, content.String())
+}
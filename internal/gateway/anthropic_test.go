@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMessages(t *testing.T) {
+	g, provider, url := newProxyGateway(t, (*Gateway).handleMessages)
+
+	var resp struct {
+		Type    string `json:"type"`
+		Role    string `json:"role"`
+		Model   string `json:"model"`
+		Content []struct{ Type, Text string }
+		Stop    string `json:"stop_reason"`
+		Usage   struct {
+			Input  int `json:"input_tokens"`
+			Output int `json:"output_tokens"`
+		}
+	}
+	r := post(t, url, `{"model":"hiveclaw/coder","max_tokens":100,
+		"system":[{"type":"text","text":"Answer in Go."}],
+		"messages":[{"role":"user","content":"Hi"}]}`,
+		map[string]string{"Authorization": "", "x-api-key": "t0ken", SessionHeader: "api_1"}, &resp)
+
+	if r.StatusCode != http.StatusOK || resp.Type != "message" || resp.Role != "assistant" || resp.Model != "big-model" {
+		t.Fatalf("status %d, response %+v", r.StatusCode, resp)
+	}
+	if len(resp.Content) != 1 || resp.Content[0].Text != "Hello there" || resp.Stop != "end_turn" || resp.Usage.Input != 5 || resp.Usage.Output != 2 {
+		t.Errorf("response %+v", resp)
+	}
+
+	messages, opts := provider.called()
+	if opts.Model != "big-model" || opts.System != "Answer in Go." || opts.MaxTokens != 100 {
+		t.Errorf("options %+v", opts)
+	}
+	if len(messages) != 1 || messages[0].Content != "Hi" {
+		t.Errorf("messages %+v", messages)
+	}
+
+	stored, _ := g.Sessions.GetMessages("api_1")
+	if len(stored) != 2 || stored[0].Content != "Hi" || stored[1].Content != "Hello there" {
+		t.Errorf("recorded %+v", stored)
+	}
+}
+
+func TestMessagesStream(t *testing.T) {
+	_, provider, url := newProxyGateway(t, (*Gateway).handleMessages)
+
+	r := post(t, url, `{"model":"claude-x","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, nil, nil)
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("content type %q", ct)
+	}
+
+	var types []string
+	var text strings.Builder
+	var stop string
+	for _, d := range sseData(t, r) {
+		var event struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			}
+		}
+		if err := json.Unmarshal([]byte(d), &event); err != nil {
+			t.Fatalf("event %s", d)
+		}
+		types = append(types, event.Type)
+		text.WriteString(event.Delta.Text)
+		if event.Delta.StopReason != "" {
+			stop = event.Delta.StopReason
+		}
+	}
+
+	want := []string{"message_start", "content_block_start", "content_block_delta", "content_block_delta", "content_block_stop", "message_delta", "message_stop"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("events %q, want %q", types, want)
+	}
+	if text.String() != "Hello there" || stop != "max_tokens" {
+		t.Errorf("streamed %q, stop reason %q", text.String(), stop)
+	}
+	if _, opts := provider.called(); opts.Model != "claude-x" || opts.System != "" {
+		t.Errorf("options %+v", opts)
+	}
+}
+
+func TestMessagesErrors(t *testing.T) {
+	g, _, url := newProxyGateway(t, (*Gateway).handleMessages)
+
+	tests := []struct {
+		name   string
+		body   string
+		key    string
+		status int
+	}{
+		{"no key", `{"messages":[{"role":"user","content":"Hi"}]}`, "", http.StatusUnauthorized},
+		{"wrong key", `{"messages":[{"role":"user","content":"Hi"}]}`, "nope", http.StatusUnauthorized},
+		{"bad json", `{`, "t0ken", http.StatusBadRequest},
+		{"no messages", `{"messages":[]}`, "t0ken", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(tt.body))
+		if tt.key != "" {
+			req.Header.Set("x-api-key", tt.key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+
+	g.LLM = nil
+	var body struct {
+		Type  string `json:"type"`
+		Error struct{ Type string }
+	}
+	r := post(t, url, `{"messages":[{"role":"user","content":"Hi"}]}`, nil, &body)
+	if r.StatusCode != http.StatusServiceUnavailable || body.Type != "error" || body.Error.Type != "api_error" {
+		t.Errorf("without an LLM: status %d, body %+v", r.StatusCode, body)
+	}
+}
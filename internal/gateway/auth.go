@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// requireToken wraps a handler so it only runs for requests carrying the
+// gateway token, either as a Bearer token or an x-api-key header.
+func (g *Gateway) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !g.authorized(r) {
+			unauthorized(w)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// unauthorized responds that the gateway token is missing or wrong
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"type":    "authentication_error",
+			"message": "Invalid or missing gateway token",
+		},
+	})
+}
+
+// authorized reports whether the request carries the gateway token.
+// If no token is configured, every request is allowed.
+func (g *Gateway) authorized(r *http.Request) bool {
+	token := r.Header.Get("x-api-key")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return g.validToken(token)
+}
+
+// validToken reports whether token is the gateway token. If no token is
+// configured, every token is valid.
+func (g *Gateway) validToken(token string) bool {
+	if g.Token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(g.Token)) == 1
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+)
+
+// stallingLLM streams "Hel" and then waits for the request to be cancelled
+type stallingLLM struct {
+	cancelled chan struct{}
+}
+
+func (s stallingLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (s stallingLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	ch := make(chan llm.StreamChunk, 1)
+	ch <- llm.StreamChunk{Content: "Hel"}
+	go func() {
+		defer close(ch)
+		<-opts.Context.Done()
+		close(s.cancelled)
+	}()
+	return ch, nil
+}
+
+// postChat starts a streaming /api/chat request
+func postChat(t *testing.T, ctx context.Context, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url+"/api/chat?stream=true", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// readFrame reads one server-sent event, up to the blank line ending it
+func readFrame(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("after %q: %v", lines, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestChatStream(t *testing.T) {
+	g, srv := newTestGateway(t)
+	g.LLM = &scriptedLLM{}
+
+	resp := postChat(t, context.Background(), srv.URL, `{"sessionId":"s1","message":"Hi"}`)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for _, want := range []string{`{"content":"Hello"}`, `{"content":" there"}`} {
+		if frame := readFrame(t, r); len(frame) != 2 || frame[0] != "event: delta" || frame[1] != "data: "+want {
+			t.Errorf("frame %q, want the delta %s", frame, want)
+		}
+	}
+
+	frame := readFrame(t, r)
+	if len(frame) != 2 || frame[0] != "event: done" {
+		t.Fatalf("frame %q, want done", frame)
+	}
+	var done struct {
+		SessionID  string    `json:"sessionId"`
+		MessageID  string    `json:"messageId"`
+		StopReason string    `json:"stopReason"`
+		Usage      llm.Usage `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(frame[1], "data: ")), &done); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(r); len(rest) != 0 {
+		t.Errorf("data after done: %q", rest)
+	}
+
+	messages, _ := g.Sessions.GetMessages("s1")
+	if len(messages) != 2 || messages[0].Content != "Hi" || messages[1].Content != "Hello there" {
+		t.Fatalf("stored %+v", messages)
+	}
+	if done.SessionID != "s1" || done.MessageID != messages[1].ID || done.StopReason != "max_tokens" || done.Usage.OutputTokens != 2 {
+		t.Errorf("done %+v", done)
+	}
+}
+
+func TestChatStreamCancelled(t *testing.T) {
+	g, srv := newTestGateway(t)
+	provider := stallingLLM{cancelled: make(chan struct{})}
+	g.LLM = provider
+	g.Sessions.CreateWithID("s1", "")
+	g.Sessions.AddMessage("s1", "user", "q1")
+	g.Sessions.AddMessage("s1", "assistant", "a1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := postChat(t, ctx, srv.URL, `{"sessionId":"s1","message":"q2"}`)
+	if frame := readFrame(t, bufio.NewReader(resp.Body)); len(frame) != 2 || frame[1] != `data: {"content":"Hel"}` {
+		t.Fatalf("frame %q", frame)
+	}
+	cancel()
+
+	select {
+	case <-provider.cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream request not cancelled")
+	}
+
+	// The turn ends without an answer, and without the prompt
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		messages, _ := g.Sessions.GetMessages("s1")
+		if len(messages) == 2 && messages[1].Content == "a1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("messages after cancelling %+v", messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,305 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/llm"
+)
+
+// SessionHeader binds a /v1 request to a HiveClaw session so the exchange
+// is recorded in the session manager.
+const SessionHeader = "X-HiveClaw-Session"
+
+type openAIChatRequest struct {
+	Model               string          `json:"model"`
+	Messages            []openAIMessage `json:"messages"`
+	MaxTokens           int             `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int             `json:"max_completion_tokens,omitempty"`
+	Temperature         float64         `json:"temperature,omitempty"`
+	Stream              bool            `json:"stream,omitempty"`
+}
+
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text flattens string or content-part message bodies into plain text
+func (m openAIMessage) text() string {
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(m.Content, &parts)
+
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			b.WriteString(p.Text)
+		}
+	}
+	return b.String()
+}
+
+// resolveModel maps a requested model name to provider options. Agent IDs
+// (optionally prefixed with "hiveclaw/") select that agent's model and system
+// prompt; any other name is passed through to the provider unchanged.
+func (g *Gateway) resolveModel(name string) llm.Options {
+	id := strings.TrimPrefix(name, "hiveclaw/")
+	for _, agent := range g.Agents {
+		if agent.ID != id {
+			continue
+		}
+		opts := llm.Options{Model: agent.Model, System: agent.SystemPrompt}
+		if opts.Model == "" {
+			opts.Model = g.Model
+		}
+		if opts.System == "" {
+			opts.System = g.SystemPrompt
+		}
+		return opts
+	}
+	return llm.Options{Model: name}
+}
+
+// recordExchange stores a proxied exchange in the session named by the
+// session header, if any.
+func (g *Gateway) recordExchange(r *http.Request, prompt, reply string) {
+	sessionID := r.Header.Get(SessionHeader)
+	if sessionID == "" {
+		return
+	}
+
+	g.Sessions.GetOrCreate(sessionID)
+	if prompt != "" {
+		g.Sessions.AddMessage(sessionID, "user", prompt)
+	}
+	g.Sessions.AddMessage(sessionID, "assistant", reply)
+}
+
+func openAIError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"type":    errType,
+			"message": message,
+		},
+	})
+}
+
+func openAIFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens", "length":
+		return "length"
+	default:
+		return "stop"
+	}
+}
+
+func (g *Gateway) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		openAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+		return
+	}
+
+	models := []map[string]interface{}{}
+	if g.Model != "" {
+		models = append(models, map[string]interface{}{
+			"id":       g.Model,
+			"object":   "model",
+			"owned_by": "hiveclaw",
+		})
+	}
+	for _, agent := range g.Agents {
+		models = append(models, map[string]interface{}{
+			"id":       "hiveclaw/" + agent.ID,
+			"object":   "model",
+			"owned_by": "hiveclaw",
+			"name":     agent.Name,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+func (g *Gateway) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		openAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "Method not allowed")
+		return
+	}
+
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		openAIError(w, http.StatusBadRequest, "invalid_request_error", "Invalid request body")
+		return
+	}
+	if len(req.Messages) == 0 {
+		openAIError(w, http.StatusBadRequest, "invalid_request_error", "messages is required")
+		return
+	}
+	if g.LLM == nil {
+		openAIError(w, http.StatusServiceUnavailable, "api_error", "LLM not configured")
+		return
+	}
+
+	opts := g.resolveModel(req.Model)
+	opts.MaxTokens = req.MaxTokens
+	if req.MaxCompletionTokens > 0 {
+		opts.MaxTokens = req.MaxCompletionTokens
+	}
+	opts.Temperature = req.Temperature
+	opts.Context = r.Context()
+
+	// System messages go to the provider's system prompt; the rest become
+	// the conversation.
+	var system []string
+	var messages []llm.Message
+	prompt := ""
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			system = append(system, m.text())
+		case "user", "assistant":
+			messages = append(messages, llm.Message{Role: m.Role, Content: m.text()})
+			if m.Role == "user" {
+				prompt = m.text()
+			}
+		}
+	}
+	if len(system) > 0 {
+		opts.System = strings.Join(system, "\n\n")
+	}
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+
+	if req.Stream {
+		g.streamChatCompletion(w, r, id, created, req.Model, prompt, messages, opts)
+		return
+	}
+
+	resp, err := g.LLM.Chat(messages, opts)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		openAIError(w, http.StatusBadGateway, "api_error", fmt.Sprintf("LLM error: %v", err))
+		return
+	}
+
+	g.recordExchange(r, prompt, resp.Content)
+
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []map[string]interface{}{
+			{
+				"index": 0,
+				"message": map[string]string{
+					"role":    "assistant",
+					"content": resp.Content,
+				},
+				"finish_reason": openAIFinishReason(resp.StopReason),
+			},
+		},
+		"usage": map[string]int{
+			"prompt_tokens":     resp.Usage.InputTokens,
+			"completion_tokens": resp.Usage.OutputTokens,
+			"total_tokens":      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	})
+}
+
+func (g *Gateway) streamChatCompletion(w http.ResponseWriter, r *http.Request, id string, created int64, model, prompt string, messages []llm.Message, opts llm.Options) {
+	chunks, err := g.LLM.Stream(messages, opts)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		openAIError(w, http.StatusBadGateway, "api_error", fmt.Sprintf("LLM error: %v", err))
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		openAIError(w, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
+
+	chunk := func(delta map[string]string, finishReason interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": finishReason,
+				},
+			},
+		}
+	}
+
+	sse.Event("", chunk(map[string]string{"role": "assistant"}, nil))
+
+	var content strings.Builder
+	var final llm.StreamChunk
+	for c := range chunks {
+		if c.Error != nil {
+			log.Printf("LLM stream error: %v", c.Error)
+			sse.Event("", map[string]interface{}{
+				"error": map[string]string{
+					"type":    "api_error",
+					"message": c.Error.Error(),
+				},
+			})
+			return
+		}
+		if c.Done {
+			final = c
+			continue
+		}
+		if c.Content != "" {
+			content.WriteString(c.Content)
+			sse.Event("", chunk(map[string]string{"content": c.Content}, nil))
+		}
+	}
+
+	if r.Context().Err() != nil {
+		return
+	}
+
+	last := chunk(map[string]string{}, openAIFinishReason(final.StopReason))
+	if final.Usage != nil {
+		last["usage"] = map[string]int{
+			"prompt_tokens":     final.Usage.InputTokens,
+			"completion_tokens": final.Usage.OutputTokens,
+			"total_tokens":      final.Usage.InputTokens + final.Usage.OutputTokens,
+		}
+	}
+	sse.Event("", last)
+	sse.Raw("", "[DONE]")
+
+	g.recordExchange(r, prompt, content.String())
+}
@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/configs"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+)
+
+// scriptedLLM answers "Hello there" in two chunks and records how it was
+// called
+type scriptedLLM struct {
+	mu       sync.Mutex
+	messages []llm.Message
+	opts     llm.Options
+}
+
+func (s *scriptedLLM) record(messages []llm.Message, opts llm.Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages, s.opts = messages, opts
+}
+
+func (s *scriptedLLM) called() ([]llm.Message, llm.Options) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages, s.opts
+}
+
+func (s *scriptedLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	s.record(messages, opts)
+	return &llm.Response{
+		Content:    "Hello there",
+		Model:      opts.Model,
+		StopReason: "end_turn",
+		Usage:      llm.Usage{InputTokens: 5, OutputTokens: 2},
+	}, nil
+}
+
+func (s *scriptedLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	s.record(messages, opts)
+	ch := make(chan llm.StreamChunk, 3)
+	ch <- llm.StreamChunk{Content: "Hello"}
+	ch <- llm.StreamChunk{Content: " there"}
+	ch <- llm.StreamChunk{Done: true, StopReason: "max_tokens", Usage: &llm.Usage{InputTokens: 5, OutputTokens: 2}}
+	close(ch)
+	return ch, nil
+}
+
+// post sends a JSON request with the gateway token and decodes the reply
+func post(t *testing.T, url, body string, header map[string]string, out interface{}) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer t0ken")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+// sseData returns the data lines of a server-sent event stream
+func sseData(t *testing.T, resp *http.Response) []string {
+	t.Helper()
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			data = append(data, line)
+		}
+	}
+	return data
+}
+
+// newProxyGateway serves one of the gateway's /v1 handlers, behind the
+// gateway token, with a scripted provider
+func newProxyGateway(t *testing.T, handler func(*Gateway, http.ResponseWriter, *http.Request)) (*Gateway, *scriptedLLM, string) {
+	t.Helper()
+	provider := &scriptedLLM{}
+	g := New(0, "")
+	g.Token = "t0ken"
+	g.LLM = provider
+	g.Model = "default-model"
+	g.SystemPrompt = "Be helpful."
+	g.Agents = []configs.AgentConfig{{ID: "coder", Name: "Coder", Model: "big-model", SystemPrompt: "Write code."}}
+	srv := httptest.NewServer(g.requireToken(func(w http.ResponseWriter, r *http.Request) {
+		handler(g, w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return g, provider, srv.URL
+}
+
+func TestChatCompletions(t *testing.T) {
+	g, provider, url := newProxyGateway(t, (*Gateway).handleChatCompletions)
+
+	var resp struct {
+		Object  string `json:"object"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message      struct{ Role, Content string }
+			FinishReason string `json:"finish_reason"`
+		}
+		Usage struct {
+			Total int `json:"total_tokens"`
+		}
+	}
+	r := post(t, url, `{"model":"hiveclaw/coder","messages":[
+		{"role":"system","content":"Answer in Go."},
+		{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`,
+		map[string]string{SessionHeader: "api_1"}, &resp)
+
+	if r.StatusCode != http.StatusOK || resp.Object != "chat.completion" || resp.Model != "big-model" {
+		t.Fatalf("status %d, response %+v", r.StatusCode, resp)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello there" || resp.Choices[0].FinishReason != "stop" || resp.Usage.Total != 7 {
+		t.Errorf("response %+v", resp)
+	}
+
+	messages, opts := provider.called()
+	if opts.Model != "big-model" || opts.System != "Answer in Go." {
+		t.Errorf("options %+v", opts)
+	}
+	if len(messages) != 1 || messages[0].Role != "user" || messages[0].Content != "Hi" {
+		t.Errorf("messages %+v", messages)
+	}
+
+	stored, _ := g.Sessions.GetMessages("api_1")
+	if len(stored) != 2 || stored[0].Content != "Hi" || stored[1].Content != "Hello there" {
+		t.Errorf("recorded %+v", stored)
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	_, provider, url := newProxyGateway(t, (*Gateway).handleChatCompletions)
+
+	r := post(t, url, `{"model":"gpt-x","stream":true,"messages":[{"role":"user","content":"Hi"}]}`, nil, nil)
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("content type %q", ct)
+	}
+	data := sseData(t, r)
+	if len(data) != 5 || data[4] != "[DONE]" {
+		t.Fatalf("events %q", data)
+	}
+
+	var text strings.Builder
+	for _, d := range data[:4] {
+		var chunk struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta        map[string]string
+				FinishReason *string `json:"finish_reason"`
+			}
+		}
+		if err := json.Unmarshal([]byte(d), &chunk); err != nil || chunk.Object != "chat.completion.chunk" {
+			t.Fatalf("chunk %s", d)
+		}
+		text.WriteString(chunk.Choices[0].Delta["content"])
+		if f := chunk.Choices[0].FinishReason; f != nil && *f != "length" {
+			t.Errorf("finish reason %q", *f)
+		}
+	}
+	if text.String() != "Hello there" {
+		t.Errorf("streamed %q", text.String())
+	}
+	if _, opts := provider.called(); opts.Model != "gpt-x" || opts.System != "" {
+		t.Errorf("options %+v", opts)
+	}
+}
+
+func TestChatCompletionsErrors(t *testing.T) {
+	g, _, url := newProxyGateway(t, (*Gateway).handleChatCompletions)
+
+	tests := []struct {
+		name   string
+		body   string
+		token  string
+		status int
+	}{
+		{"no token", `{"messages":[{"role":"user","content":"Hi"}]}`, "", http.StatusUnauthorized},
+		{"bad json", `{`, "t0ken", http.StatusBadRequest},
+		{"no messages", `{"messages":[]}`, "t0ken", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+
+	g.LLM = nil
+	if r := post(t, url, `{"messages":[{"role":"user","content":"Hi"}]}`, nil, nil); r.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("without an LLM: status %d", r.StatusCode)
+	}
+}
+
+func TestModels(t *testing.T) {
+	_, _, url := newProxyGateway(t, (*Gateway).handleModels)
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("x-api-key", "t0ken")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Data []struct{ ID string }
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	if len(list.Data) != 2 || list.Data[0].ID != "default-model" || list.Data[1].ID != "hiveclaw/coder" {
+		t.Errorf("models %+v", list.Data)
+	}
+}
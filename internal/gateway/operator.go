@@ -0,0 +1,142 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// Deliverer sends messages into the chats behind channel-backed sessions
+type Deliverer interface {
+	Deliver(sessionID, text string) error
+}
+
+// errNoChannel is returned when no connected channel can reach a session
+var errNoChannel = errors.New("session is not backed by a connected channel")
+
+// operatorSend delivers an operator's message to the chat behind a session
+// and records it with role "operator"
+func (g *Gateway) operatorSend(sessionID, content string) (*session.Message, error) {
+	if _, ok := g.Sessions.Get(sessionID); !ok {
+		return nil, fmt.Errorf("%w: %s", session.ErrNotFound, sessionID)
+	}
+	d, ok := g.Channels[session.ChannelOf(sessionID)]
+	if !ok {
+		return nil, errNoChannel
+	}
+
+	var msg *session.Message
+	var err error
+	busy := g.Sessions.Turns.Do(sessionID, func() {
+		if err = d.Deliver(sessionID, content); err != nil {
+			return
+		}
+		msg, err = g.Sessions.AddMessage(sessionID, "operator", content)
+	})
+	if busy != nil {
+		return nil, busy
+	}
+	return msg, err
+}
+
+// writeOperatorError maps operatorSend errors to HTTP responses
+func writeOperatorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+	case errors.Is(err, errNoChannel):
+		writeError(w, http.StatusConflict, "NO_CHANNEL", err.Error())
+	case errors.Is(err, session.ErrBusy):
+		writeError(w, http.StatusTooManyRequests, "SESSION_BUSY", err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, "DELIVERY_FAILED", err.Error())
+	}
+}
+
+func (g *Gateway) handleOperatorMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Content) == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "content is required")
+		return
+	}
+
+	msg, err := g.operatorSend(r.PathValue("id"), req.Content)
+	if err != nil {
+		writeOperatorError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, msg)
+}
+
+// handleTakeover pauses LLM replies in a session (PUT) or hands the
+// conversation back to the LLM (DELETE)
+func (g *Gateway) handleTakeover(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := g.Sessions.Pause(id, r.Method == http.MethodPut); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	// The session may have been deleted in the meantime
+	sess, ok := g.Sessions.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, sess.Summary())
+}
+
+func (c *Client) handleOperatorSend(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		Content   string `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil || strings.TrimSpace(params.Content) == "" {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	sent, err := c.Gateway.operatorSend(params.SessionID, params.Content)
+	if err != nil {
+		code := "DELIVERY_FAILED"
+		switch {
+		case errors.Is(err, session.ErrNotFound):
+			code = "NOT_FOUND"
+		case errors.Is(err, errNoChannel):
+			code = "NO_CHANNEL"
+		case errors.Is(err, session.ErrBusy):
+			code = "SESSION_BUSY"
+		}
+		c.sendError(msg.ID, code, err.Error())
+		return
+	}
+	c.sendResult(msg.ID, sent)
+}
+
+func (c *Client) handleSessionPause(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		Paused    bool   `json:"paused"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	if err := c.Gateway.Sessions.Pause(params.SessionID, params.Paused); err != nil {
+		c.sendError(msg.ID, "NOT_FOUND", err.Error())
+		return
+	}
+	sess, ok := c.Gateway.Sessions.Get(params.SessionID)
+	if !ok {
+		c.sendError(msg.ID, "NOT_FOUND", "Session not found")
+		return
+	}
+	c.sendResult(msg.ID, sess.Summary())
+}
@@ -0,0 +1,162 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// fakeDeliverer records delivered messages, failing while err is set
+type fakeDeliverer struct {
+	mu   sync.Mutex
+	sent []string
+	err  error
+}
+
+func (d *fakeDeliverer) Deliver(sessionID, text string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return d.err
+	}
+	d.sent = append(d.sent, sessionID+": "+text)
+	return nil
+}
+
+// newOperatorGateway returns a test gateway with a connected Telegram
+// channel and sessions tg_42, discord_1_2 and web
+func newOperatorGateway(t *testing.T) (*Gateway, *fakeDeliverer, *httptest.Server) {
+	t.Helper()
+	g, srv := newTestGateway(t)
+	d := &fakeDeliverer{}
+	g.Channels = map[string]Deliverer{"telegram": d}
+	g.Sessions.CreateWithID("tg_42", "")
+	g.Sessions.CreateWithID("discord_1_2", "")
+	g.Sessions.CreateWithID("web", "")
+	return g, d, srv
+}
+
+func TestOperatorMessage(t *testing.T) {
+	g, d, srv := newOperatorGateway(t)
+
+	tests := []struct {
+		name    string
+		session string
+		body    string
+		fail    error
+		status  int
+		code    string
+	}{
+		{"delivered", "tg_42", `{"content":"Hi, this is Sam"}`, nil, http.StatusCreated, ""},
+		{"empty", "tg_42", `{"content":"  "}`, nil, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"unknown session", "tg_7", `{"content":"hi"}`, nil, http.StatusNotFound, "NOT_FOUND"},
+		{"channel not connected", "discord_1_2", `{"content":"hi"}`, nil, http.StatusConflict, "NO_CHANNEL"},
+		{"web session", "web", `{"content":"hi"}`, nil, http.StatusConflict, "NO_CHANNEL"},
+		{"delivery fails", "tg_42", `{"content":"lost"}`, errors.New("blocked"), http.StatusBadGateway, "DELIVERY_FAILED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d.err = tt.fail
+			var body struct {
+				Role    string
+				Content string
+				Error   struct{ Code string }
+			}
+			r := post(t, srv.URL+"/api/sessions/"+tt.session+"/operator", tt.body, nil, &body)
+			if r.StatusCode != tt.status || body.Error.Code != tt.code {
+				t.Errorf("status %d, body %+v", r.StatusCode, body)
+			}
+			if tt.status == http.StatusCreated && (body.Role != "operator" || body.Content != "Hi, this is Sam") {
+				t.Errorf("message %+v", body)
+			}
+		})
+	}
+
+	if len(d.sent) != 1 || d.sent[0] != "tg_42: Hi, this is Sam" {
+		t.Errorf("delivered %q", d.sent)
+	}
+	messages, _ := g.Sessions.GetMessages("tg_42")
+	if len(messages) != 1 || messages[0].Role != "operator" {
+		t.Errorf("stored %+v", messages)
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	g, _, srv := newOperatorGateway(t)
+
+	for _, tt := range []struct {
+		method string
+		paused bool
+	}{
+		{http.MethodPut, true},
+		{http.MethodDelete, false},
+	} {
+		req, _ := http.NewRequest(tt.method, srv.URL+"/api/sessions/tg_42/takeover", nil)
+		req.Header.Set("Authorization", "Bearer t0ken")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var summary session.Summary
+		json.NewDecoder(resp.Body).Decode(&summary)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || summary.ID != "tg_42" || summary.Paused != tt.paused {
+			t.Errorf("%s: status %d, summary %+v", tt.method, resp.StatusCode, summary)
+		}
+		if g.Sessions.Paused("tg_42") != tt.paused {
+			t.Errorf("%s: paused %v", tt.method, !tt.paused)
+		}
+	}
+
+	if resp := do(t, srv, http.MethodPut, "/api/sessions/tg_7/takeover", "", "t0ken"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown session: status %d", resp.StatusCode)
+	}
+}
+
+func TestOperatorOverWebSocket(t *testing.T) {
+	g, d, srv := newOperatorGateway(t)
+	c := dialWS(t, srv.URL, "t0ken")
+
+	c.call("1", "session.pause", map[string]interface{}{"sessionId": "tg_42", "paused": true})
+	var summary session.Summary
+	if resp := c.response("1"); resp.Error != nil || json.Unmarshal(resp.Payload, &summary) != nil || !summary.Paused {
+		t.Errorf("pause: %+v", resp)
+	}
+
+	c.call("2", "operator.send", map[string]string{"sessionId": "tg_42", "content": "Sam here"})
+	var msg session.Message
+	if resp := c.response("2"); resp.Error != nil || json.Unmarshal(resp.Payload, &msg) != nil || msg.Role != "operator" {
+		t.Errorf("send: %+v", resp)
+	}
+	if len(d.sent) != 1 || !strings.HasSuffix(d.sent[0], "Sam here") {
+		t.Errorf("delivered %q", d.sent)
+	}
+
+	tests := []struct {
+		method string
+		params map[string]interface{}
+		code   string
+	}{
+		{"session.pause", map[string]interface{}{"sessionId": "tg_7", "paused": true}, "NOT_FOUND"},
+		{"operator.send", map[string]interface{}{"sessionId": "tg_7", "content": "hi"}, "NOT_FOUND"},
+		{"operator.send", map[string]interface{}{"sessionId": "web", "content": "hi"}, "NO_CHANNEL"},
+		{"operator.send", map[string]interface{}{"sessionId": "tg_42", "content": ""}, "INVALID_PARAMS"},
+	}
+	for _, tt := range tests {
+		c.call("3", tt.method, tt.params)
+		if resp := c.response("3"); resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%s %v: %+v, want %s", tt.method, tt.params, resp, tt.code)
+		}
+	}
+
+	c.call("4", "session.pause", map[string]interface{}{"sessionId": "tg_42", "paused": false})
+	if resp := c.response("4"); resp.Error != nil || g.Sessions.Paused("tg_42") {
+		t.Errorf("resume: %+v", resp)
+	}
+}
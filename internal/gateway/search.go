@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// parseSearchQuery builds a search query from URL parameters:
+// q, role, agent, channel, since, until and limit
+func parseSearchQuery(v url.Values) (session.SearchQuery, error) {
+	q := session.SearchQuery{
+		Query:   v.Get("q"),
+		Role:    v.Get("role"),
+		AgentID: v.Get("agent"),
+		Channel: v.Get("channel"),
+	}
+	if q.Query == "" {
+		return q, fmt.Errorf("q is required")
+	}
+
+	var err error
+	if q.Since, err = parseSearchTime(v.Get("since"), false); err != nil {
+		return q, fmt.Errorf("invalid since: %w", err)
+	}
+	if q.Until, err = parseSearchTime(v.Get("until"), true); err != nil {
+		return q, fmt.Errorf("invalid until: %w", err)
+	}
+
+	if l := v.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil || q.Limit <= 0 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	return q, nil
+}
+
+// searchParams are the session.search parameters sent over WebSocket. They
+// take the same values as the REST query string.
+type searchParams struct {
+	Query   string `json:"q"`
+	Role    string `json:"role"`
+	AgentID string `json:"agent"`
+	Channel string `json:"channel"`
+	Since   string `json:"since"`
+	Until   string `json:"until"`
+	Limit   int    `json:"limit"`
+	Scope   string `json:"scope"`
+}
+
+// query parses the parameters the way the REST endpoint does
+func (p searchParams) query() (session.SearchQuery, error) {
+	v := url.Values{}
+	for key, value := range map[string]string{
+		"q": p.Query, "role": p.Role, "agent": p.AgentID, "channel": p.Channel,
+		"since": p.Since, "until": p.Until,
+	} {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	if p.Limit != 0 {
+		v.Set("limit", strconv.Itoa(p.Limit))
+	}
+	q, err := parseSearchQuery(v)
+	q.Scope = p.Scope
+	return q, err
+}
+
+// parseSearchTime accepts RFC 3339 timestamps or plain dates. A date as an
+// upper bound covers the whole day: it stops just before the next one.
+func parseSearchTime(s string, until bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil || !until {
+		return t, err
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+func (g *Gateway) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, g.Sessions.Search(q))
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	day := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query        string
+		since, until time.Time
+	}{
+		{"q=x", time.Time{}, time.Time{}},
+		{"q=x&since=2026-03-14", day, time.Time{}},
+		{"q=x&until=2026-03-14", time.Time{}, day.AddDate(0, 0, 1).Add(-time.Nanosecond)},
+		{"q=x&until=2026-03-14T12:00:00Z", time.Time{}, day.Add(12 * time.Hour)},
+	}
+	for _, tt := range tests {
+		v, _ := url.ParseQuery(tt.query)
+		q, err := parseSearchQuery(v)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if !q.Since.Equal(tt.since) || !q.Until.Equal(tt.until) {
+			t.Errorf("%s: since %v, until %v", tt.query, q.Since, q.Until)
+		}
+	}
+
+	for _, bad := range []string{"", "q=x&until=14/03/2026", "q=x&limit=0"} {
+		v, _ := url.ParseQuery(bad)
+		if _, err := parseSearchQuery(v); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestSearchUntilDate(t *testing.T) {
+	g := New(0, "")
+	g.Sessions.CreateWithID("s1", "")
+	g.Sessions.AddMessage("s1", "user", "hello today")
+
+	// Messages from the named day are included
+	v, _ := url.ParseQuery("q=hello&until=" + time.Now().UTC().Format("2006-01-02"))
+	q, err := parseSearchQuery(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := g.Sessions.Search(q); len(results) != 1 {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestSearchOverWebSocket(t *testing.T) {
+	g, srv := newTestGateway(t)
+	g.Sessions.CreateWithID("s1", "")
+	g.Sessions.AddMessage("s1", "user", "hello today")
+	today := time.Now().UTC().Format("2006-01-02")
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+
+	c := dialWS(t, srv.URL, "t0ken")
+	tests := []struct {
+		params map[string]interface{}
+		want   int
+	}{
+		{map[string]interface{}{"q": "hello", "until": today}, 1},
+		{map[string]interface{}{"q": "hello", "since": today, "limit": 5}, 1},
+		{map[string]interface{}{"q": "hello", "since": tomorrow}, 0},
+	}
+	for i, tt := range tests {
+		id := strconv.Itoa(i)
+		c.call(id, "session.search", tt.params)
+		resp := c.response(id)
+		var results []session.SearchResult
+		if resp.Error != nil || json.Unmarshal(resp.Payload, &results) != nil || len(results) != tt.want {
+			t.Errorf("%v: error %+v, payload %s", tt.params, resp.Error, resp.Payload)
+		}
+	}
+
+	for _, bad := range []map[string]interface{}{{"until": today}, {"q": "hello", "until": "14/03/2026"}, {"q": "hello", "limit": -1}} {
+		c.call("bad", "session.search", bad)
+		if resp := c.response("bad"); resp.Error == nil || resp.Error.Code != "INVALID_PARAMS" {
+			t.Errorf("%v: %+v", bad, resp)
+		}
+	}
+}
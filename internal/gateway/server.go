@@ -1,14 +1,19 @@
 package gateway
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/nanilabs/hiveclaw/configs"
 	"github.com/nanilabs/hiveclaw/internal/llm"
 	"github.com/nanilabs/hiveclaw/internal/session"
 )
@@ -53,6 +58,14 @@ type Client struct {
 	Gateway   *Gateway
 	SessionID string
 	Role      string // "operator" or "node"
+	authed    bool   // Presented the gateway token
+
+	events  *session.Subscription // Events for watched sessions
+	watch   map[string]bool       // Watched session IDs, "*" for all
+	watchMu sync.RWMutex
+
+	sendMu sync.Mutex // Guards closing Send
+	closed bool
 }
 
 // Gateway is the main WebSocket server
@@ -63,6 +76,11 @@ type Gateway struct {
 	Sessions     *session.Manager
 	LLM          llm.Provider
 	SystemPrompt string
+	Model        string                  // Default model for the LLM provider
+	Token        string                  // Gateway token for authenticated endpoints
+	Agents       []configs.AgentConfig   // Agents exposed as models on /v1
+	Channels     map[string]Deliverer    // Connected bots by channel name, for operator messages
+	Handlers     map[string]http.Handler // Extra routes by pattern, e.g. channel webhooks
 	mu           sync.RWMutex
 	hub          *Hub
 }
@@ -98,7 +116,7 @@ func (h *Hub) run() {
 			h.mu.Lock()
 			if _, ok := h.Clients[client]; ok {
 				delete(h.Clients, client)
-				close(client.Send)
+				client.close()
 			}
 			h.mu.Unlock()
 			log.Printf("Client disconnected: %s", client.ID)
@@ -109,7 +127,7 @@ func (h *Hub) run() {
 				select {
 				case client.Send <- message:
 				default:
-					close(client.Send)
+					client.close()
 					delete(h.Clients, client)
 				}
 			}
@@ -125,6 +143,8 @@ func New(port int, configPath string) *Gateway {
 		ConfigPath: configPath,
 		Clients:    make(map[string]*Client),
 		Sessions:   session.NewManager(),
+		Channels:   make(map[string]Deliverer),
+		Handlers:   make(map[string]http.Handler),
 		hub:        newHub(),
 	}
 }
@@ -133,23 +153,54 @@ func New(port int, configPath string) *Gateway {
 func (g *Gateway) Start() error {
 	go g.hub.run()
 
+	addr := fmt.Sprintf(":%d", g.Port)
+	log.Printf("🐝 HiveClaw gateway listening on %s", addr)
+	log.Printf("   WebSocket: ws://localhost%s/ws", addr)
+	log.Printf("   Dashboard: http://localhost%s", addr)
+
+	return http.ListenAndServe(addr, g.Handler())
+}
+
+// Handler returns the gateway's routes
+func (g *Gateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+
 	// WebSocket endpoint
-	http.HandleFunc("/ws", g.handleWebSocket)
+	mux.HandleFunc("/ws", g.handleWebSocket)
 
 	// REST API endpoints
-	http.HandleFunc("/api/health", g.handleHealth)
-	http.HandleFunc("/api/sessions", g.handleSessions)
-	http.HandleFunc("/api/chat", g.handleChat)
+	mux.HandleFunc("/api/health", g.handleHealth)
+	mux.HandleFunc("GET /api/sessions", g.requireToken(g.handleSessions))
+	mux.HandleFunc("POST /api/sessions", g.requireToken(g.handleSessionCreate))
+	mux.HandleFunc("GET /api/sessions/{id}", g.requireToken(g.handleSessionGet))
+	mux.HandleFunc("PATCH /api/sessions/{id}", g.requireToken(g.handleSessionUpdate))
+	mux.HandleFunc("DELETE /api/sessions/{id}", g.requireToken(g.handleSessionDelete))
+	mux.HandleFunc("GET /api/sessions/{id}/messages", g.requireToken(g.handleSessionMessages))
+	mux.HandleFunc("DELETE /api/sessions/{id}/messages", g.requireToken(g.handleSessionClear))
+	mux.HandleFunc("GET /api/sessions/{id}/export", g.requireToken(g.handleSessionExport))
+	mux.HandleFunc("POST /api/sessions/import", g.requireToken(g.handleSessionImport))
+	mux.HandleFunc("POST /api/sessions/{id}/operator", g.requireToken(g.handleOperatorMessage))
+	mux.HandleFunc("PUT /api/sessions/{id}/takeover", g.requireToken(g.handleTakeover))
+	mux.HandleFunc("DELETE /api/sessions/{id}/takeover", g.requireToken(g.handleTakeover))
+	mux.HandleFunc("GET /api/search", g.requireToken(g.handleSearch))
+	mux.HandleFunc("/api/chat", g.handleChat)
+
+	// OpenAI-compatible endpoints
+	mux.HandleFunc("/v1/chat/completions", g.requireToken(g.handleChatCompletions))
+	mux.HandleFunc("/v1/models", g.requireToken(g.handleModels))
+
+	// Anthropic-compatible endpoint
+	mux.HandleFunc("/v1/messages", g.requireToken(g.handleMessages))
+
+	// Channel webhooks and other extra routes
+	for pattern, h := range g.Handlers {
+		mux.Handle(pattern, h)
+	}
 
 	// Serve embedded frontend files
-	http.Handle("/", DebugFileServer(GetFrontendFS()))
-
-	addr := fmt.Sprintf(":%d", g.Port)
-	log.Printf("🐝 HiveClaw gateway listening on %s", addr)
-	log.Printf("   WebSocket: ws://localhost%s/ws", addr)
-	log.Printf("   Dashboard: http://localhost%s", addr)
+	mux.Handle("/", DebugFileServer(GetFrontendFS()))
 
-	return http.ListenAndServe(addr, nil)
+	return mux
 }
 
 func (g *Gateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -165,7 +216,10 @@ func (g *Gateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Send:    make(chan []byte, 256),
 		Gateway: g,
 		Role:    "operator",
+		authed:  g.authorized(r) || g.validToken(r.URL.Query().Get("token")),
+		watch:   make(map[string]bool),
 	}
+	client.events = g.Sessions.Events.Subscribe(client.watching, session.DefaultEventBuffer)
 
 	g.hub.Register <- client
 
@@ -208,16 +262,61 @@ func (c *Client) readPump() {
 }
 
 func (c *Client) writePump() {
-	defer c.Conn.Close()
+	defer func() {
+		c.events.Close()
+		c.Conn.Close()
+	}()
+
+	for {
+		var message []byte
+		select {
+		case data, ok := <-c.Send:
+			if !ok {
+				return
+			}
+			message = data
+
+		case e, ok := <-c.events.C:
+			if !ok {
+				// Dropped for falling behind; the client reconnects and
+				// resubscribes
+				log.Printf("Client %s too slow for session events, disconnecting", c.ID)
+				return
+			}
+			payload, _ := json.Marshal(e)
+			message, _ = json.Marshal(WSMessage{
+				Type:    TypeEvent,
+				Event:   string(e.Type),
+				Payload: payload,
+			})
+		}
 
-	for message := range c.Send {
 		if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 			return
 		}
 	}
 }
 
+// watching reports whether the client subscribed to an event's session
+func (c *Client) watching(e session.Event) bool {
+	c.watchMu.RLock()
+	defer c.watchMu.RUnlock()
+	return c.watch["*"] || c.watch[e.SessionID]
+}
+
+// publicMethods may be called without the gateway token. Everything else
+// reads or changes sessions, like the token-protected REST routes.
+var publicMethods = map[string]bool{
+	"connect":   true,
+	"chat.send": true,
+}
+
 func (c *Client) handleMessage(msg WSMessage) {
+	if !c.authed && !publicMethods[msg.Method] {
+		c.sendError(msg.ID, "UNAUTHORIZED", "Invalid or missing gateway token")
+		return
+	}
+
 	switch msg.Method {
 	case "connect":
 		c.handleConnect(msg)
@@ -227,12 +326,42 @@ func (c *Client) handleMessage(msg WSMessage) {
 		c.handleSessionList(msg)
 	case "session.create":
 		c.handleSessionCreate(msg)
+	case "session.search":
+		c.handleSessionSearch(msg)
+	case "session.export":
+		c.handleSessionExport(msg)
+	case "session.fork":
+		c.handleSessionFork(msg)
+	case "session.subscribe":
+		c.handleSessionSubscribe(msg, true)
+	case "session.unsubscribe":
+		c.handleSessionSubscribe(msg, false)
+	case "session.pause":
+		c.handleSessionPause(msg)
+	case "operator.send":
+		c.handleOperatorSend(msg)
+	case "message.regenerate":
+		c.handleMessageRegenerate(msg)
+	case "message.edit":
+		c.handleMessageEdit(msg)
+	case "message.variants":
+		c.handleMessageVariants(msg)
+	case "message.checkout":
+		c.handleMessageCheckout(msg)
 	default:
 		c.sendError(msg.ID, "UNKNOWN_METHOD", fmt.Sprintf("Unknown method: %s", msg.Method))
 	}
 }
 
 func (c *Client) handleConnect(msg WSMessage) {
+	var params struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(msg.Params, &params)
+	if params.Token != "" && c.Gateway.validToken(params.Token) {
+		c.authed = true
+	}
+
 	ok := true
 	response := WSMessage{
 		Type: TypeResponse,
@@ -305,6 +434,248 @@ func (c *Client) handleSessionCreate(msg WSMessage) {
 	c.Send <- respData
 }
 
+func (c *Client) handleSessionSearch(msg WSMessage) {
+	var params searchParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+	q, err := params.query()
+	if err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", err.Error())
+		return
+	}
+	c.sendResult(msg.ID, c.Gateway.Sessions.Search(q))
+}
+
+func (c *Client) handleSessionExport(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		Format    string `json:"format"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	format, err := session.ParseFormat(params.Format)
+	if err != nil {
+		c.sendError(msg.ID, "INVALID_FORMAT", err.Error())
+		return
+	}
+
+	sess, ok := c.Gateway.Sessions.Get(params.SessionID)
+	if !ok {
+		c.sendError(msg.ID, "NOT_FOUND", "Session not found")
+		return
+	}
+
+	data, err := c.Gateway.Sessions.Export(sess.ID, format)
+	if err != nil {
+		c.sendError(msg.ID, "EXPORT_FAILED", err.Error())
+		return
+	}
+
+	c.sendResult(msg.ID, map[string]string{
+		"filename":    session.FileName(sess, format),
+		"contentType": session.ContentType(format),
+		"data":        string(data),
+	})
+}
+
+func (c *Client) handleSessionFork(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+		Name      string `json:"name"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	sess, err := c.Gateway.Sessions.Fork(params.SessionID, params.MessageID, params.Name)
+	if err != nil {
+		c.sendError(msg.ID, "FORK_FAILED", err.Error())
+		return
+	}
+	c.sendResult(msg.ID, sess)
+}
+
+// handleSessionSubscribe starts or stops streaming events for sessions to
+// the client. A session ID of "*" covers every session.
+func (c *Client) handleSessionSubscribe(msg WSMessage, subscribe bool) {
+	var params struct {
+		SessionID  string   `json:"sessionId"`
+		SessionIDs []string `json:"sessionIds"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	ids := params.SessionIDs
+	if params.SessionID != "" {
+		ids = append(ids, params.SessionID)
+	}
+	if len(ids) == 0 {
+		c.sendError(msg.ID, "INVALID_PARAMS", "sessionId is required")
+		return
+	}
+
+	c.watchMu.Lock()
+	for _, id := range ids {
+		if subscribe {
+			c.watch[id] = true
+		} else {
+			delete(c.watch, id)
+		}
+	}
+	watching := make([]string, 0, len(c.watch))
+	for id := range c.watch {
+		watching = append(watching, id)
+	}
+	c.watchMu.Unlock()
+
+	sort.Strings(watching)
+	c.sendResult(msg.ID, map[string][]string{"sessionIds": watching})
+}
+
+func (c *Client) handleMessageRegenerate(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	// The turn includes the LLM call, so keep it off the read loop
+	go func() {
+		err := c.Gateway.Sessions.Turns.Do(params.SessionID, func() {
+			head, err := c.Gateway.Sessions.Regenerate(params.SessionID)
+			if err != nil {
+				c.sendError(msg.ID, "REGENERATE_FAILED", err.Error())
+				return
+			}
+			if c.sendReply(msg.ID, params.SessionID) != nil {
+				// Keep the previous answer rather than none
+				c.Gateway.Sessions.Checkout(params.SessionID, head)
+			}
+		})
+		if err != nil {
+			c.sendError(msg.ID, "SESSION_BUSY", err.Error())
+		}
+	}()
+}
+
+func (c *Client) handleMessageEdit(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+		Content   string `json:"content"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	go func() {
+		err := c.Gateway.Sessions.Turns.Do(params.SessionID, func() {
+			head := ""
+			if messages, _ := c.Gateway.Sessions.GetMessages(params.SessionID); len(messages) > 0 {
+				head = messages[len(messages)-1].ID
+			}
+			if _, err := c.Gateway.Sessions.Edit(params.SessionID, params.MessageID, params.Content); err != nil {
+				c.sendError(msg.ID, "EDIT_FAILED", err.Error())
+				return
+			}
+			if c.sendReply(msg.ID, params.SessionID) != nil && head != "" {
+				// Go back to the answered branch rather than leave the edit unanswered
+				c.Gateway.Sessions.Checkout(params.SessionID, head)
+			}
+		})
+		if err != nil {
+			c.sendError(msg.ID, "SESSION_BUSY", err.Error())
+		}
+	}()
+}
+
+func (c *Client) handleMessageVariants(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	siblings, err := c.Gateway.Sessions.Siblings(params.SessionID, params.MessageID)
+	if err != nil {
+		c.sendError(msg.ID, "NOT_FOUND", err.Error())
+		return
+	}
+	c.sendResult(msg.ID, siblings)
+}
+
+func (c *Client) handleMessageCheckout(msg WSMessage) {
+	var params struct {
+		SessionID string `json:"sessionId"`
+		MessageID string `json:"messageId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.sendError(msg.ID, "INVALID_PARAMS", "Invalid parameters")
+		return
+	}
+
+	if err := c.Gateway.Sessions.Checkout(params.SessionID, params.MessageID); err != nil {
+		c.sendError(msg.ID, "NOT_FOUND", err.Error())
+		return
+	}
+
+	sess, ok := c.Gateway.Sessions.Get(params.SessionID)
+	if !ok {
+		c.sendError(msg.ID, "NOT_FOUND", "Session not found")
+		return
+	}
+	c.sendResult(msg.ID, sess)
+}
+
+// errNoLLM is returned when the gateway has no LLM provider
+var errNoLLM = errors.New("LLM not configured")
+
+// sendReply asks the LLM for the next assistant message in a session and
+// responds with it. The error is returned too when there is no reply.
+func (c *Client) sendReply(id, sessionID string) error {
+	if c.Gateway.LLM == nil {
+		c.sendError(id, "LLM_UNAVAILABLE", errNoLLM.Error())
+		return errNoLLM
+	}
+
+	reply, err := c.Gateway.reply(context.Background(), sessionID)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		c.sendError(id, "LLM_ERROR", err.Error())
+		return err
+	}
+	c.sendResult(id, reply)
+	return nil
+}
+
+func (c *Client) sendResult(id string, v interface{}) {
+	data, _ := json.Marshal(v)
+	ok := true
+	response := WSMessage{
+		Type:    TypeResponse,
+		ID:      id,
+		OK:      &ok,
+		Payload: data,
+	}
+	respData, _ := json.Marshal(response)
+	c.send(respData)
+}
+
 func (c *Client) sendError(id, code, message string) {
 	ok := false
 	response := WSMessage{
@@ -314,24 +685,47 @@ func (c *Client) sendError(id, code, message string) {
 		Error: &WSError{Code: code, Message: message},
 	}
 	data, _ := json.Marshal(response)
-	c.Send <- data
+	c.send(data)
+}
+
+// send queues a message for the client. Responses to turns run off the
+// read loop may arrive after the client has gone, and are then dropped.
+func (c *Client) send(data []byte) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return
+	}
+	select {
+	case c.Send <- data:
+	default:
+		log.Printf("Client %s send buffer full, dropping response", c.ID)
+	}
+}
+
+// close closes Send once the hub lets go of the client
+func (c *Client) close() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
 }
 
 // REST handlers
 func (g *Gateway) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "ok",
-		"version": "0.1.0",
-		"uptime":  time.Now().Unix(),
+		"status":    "ok",
+		"version":   "0.1.0",
+		"uptime":    time.Now().Unix(),
+		"retention": g.Sessions.RetentionStats(),
 	})
 }
 
-func (g *Gateway) handleSessions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(g.Sessions.List())
-}
-
 func (g *Gateway) handleChat(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -347,6 +741,19 @@ func (g *Gateway) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = "main"
+	}
+	// The dashboard chats without the token, but bot conversations need it
+	if session.ChannelOf(sessionID) != "web" && !g.authorized(r) {
+		unauthorized(w)
+		return
+	}
+
+	stream := r.URL.Query().Get("stream") == "true" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
 	w.Header().Set("Content-Type", "application/json")
 
 	// Check if LLM is configured
@@ -357,39 +764,123 @@ func (g *Gateway) handleChat(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get or create session
-	sessionID := req.SessionID
-	if sessionID == "" {
-		sessionID = "main"
-	}
-	g.Sessions.GetOrCreate(sessionID)
+	// Wait for earlier turns in the session so history stays in order
+	err := g.Sessions.Turns.Do(sessionID, func() {
+		g.Sessions.GetOrCreate(sessionID)
 
-	// Add user message to session
-	g.Sessions.AddMessage(sessionID, "user", req.Message)
+		// Add user message to session
+		prompt, err := g.Sessions.AddMessage(sessionID, "user", req.Message)
+		if err != nil {
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 
-	// Build messages for LLM
-	messages, _ := g.Sessions.GetMessages(sessionID)
-	llmMessages := make([]llm.Message, len(messages))
-	for i, m := range messages {
-		llmMessages[i] = llm.Message{Role: m.Role, Content: m.Content}
+		if stream {
+			g.streamChat(w, r, sessionID, prompt.ID, llm.Options{
+				System:  g.SystemPrompt,
+				Context: r.Context(),
+			})
+			return
+		}
+
+		// Call LLM and add the response to the session
+		reply, err := g.reply(r.Context(), sessionID)
+		if err != nil {
+			log.Printf("LLM error: %v", err)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("LLM error: %v", err),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"response": reply.Content,
+		})
+	})
+	if errors.Is(err, session.ErrBusy) {
+		writeError(w, http.StatusTooManyRequests, "SESSION_BUSY", "Session has too many queued messages")
 	}
+}
 
-	// Call LLM
-	resp, err := g.LLM.Chat(llmMessages, llm.Options{
-		System: g.SystemPrompt,
+// reply calls the LLM with a session's history and stores its answer
+func (g *Gateway) reply(ctx context.Context, sessionID string) (*session.Message, error) {
+	resp, err := g.LLM.Chat(g.history(sessionID), llm.Options{
+		System:  g.SystemPrompt,
+		Context: ctx,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Sessions.AddMessage(sessionID, "assistant", resp.Content)
+}
+
+// streamChat streams a chat turn as server-sent events: "delta" events as
+// content arrives, then a "done" event with the stored message ID and usage.
+// The upstream request is cancelled if the client disconnects, and the
+// unanswered prompt is removed from the session again.
+func (g *Gateway) streamChat(w http.ResponseWriter, r *http.Request, sessionID, promptID string, opts llm.Options) {
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chunks, err := g.LLM.Stream(g.history(sessionID), opts)
 	if err != nil {
 		log.Printf("LLM error: %v", err)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": fmt.Sprintf("LLM error: %v", err),
-		})
+		sse.Event("error", map[string]string{"error": fmt.Sprintf("LLM error: %v", err)})
 		return
 	}
 
-	// Add assistant response to session
-	g.Sessions.AddMessage(sessionID, "assistant", resp.Content)
+	var content strings.Builder
+	var final llm.StreamChunk
+	for c := range chunks {
+		if c.Error != nil {
+			if r.Context().Err() != nil {
+				break
+			}
+			log.Printf("LLM stream error: %v", c.Error)
+			sse.Event("error", map[string]string{"error": fmt.Sprintf("LLM error: %v", c.Error)})
+			return
+		}
+		if c.Done {
+			final = c
+			continue
+		}
+		if c.Content != "" {
+			content.WriteString(c.Content)
+			sse.Event("delta", map[string]string{"content": c.Content})
+			g.Sessions.PublishDelta(sessionID, c.Content)
+		}
+	}
+
+	if r.Context().Err() != nil {
+		log.Printf("Chat stream aborted: client disconnected from %s", sessionID)
+		g.Sessions.Retract(sessionID, promptID)
+		return
+	}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"response": resp.Content,
+	msg, err := g.Sessions.AddMessage(sessionID, "assistant", content.String())
+	if err != nil {
+		sse.Event("error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	sse.Event("done", map[string]interface{}{
+		"sessionId":  sessionID,
+		"messageId":  msg.ID,
+		"stopReason": final.StopReason,
+		"usage":      final.Usage,
 	})
 }
+
+// history converts a session's messages into LLM messages
+func (g *Gateway) history(sessionID string) []llm.Message {
+	messages, _ := g.Sessions.GetMessages(sessionID)
+	llmMessages := make([]llm.Message, len(messages))
+	for i, m := range messages {
+		llmMessages[i] = llm.Message{Role: session.ChatRole(m.Role), Content: m.Content}
+	}
+	return llmMessages
+}
@@ -0,0 +1,190 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// writeSessionError maps session manager errors to HTTP responses
+func writeSessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, session.ErrNotFound):
+		writeError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+		return
+	case errors.Is(err, session.ErrExists):
+		writeError(w, http.StatusConflict, "ALREADY_EXISTS", err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+}
+
+func (g *Gateway) handleSessions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	writeJSON(w, http.StatusOK, g.Sessions.Summaries(q.Get("channel"), q.Get("agent")))
+}
+
+func (g *Gateway) handleSessionCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID      string `json:"id"`
+		Name    string `json:"name"`
+		AgentID string `json:"agentId"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+			return
+		}
+	}
+
+	var sess *session.Session
+	if req.ID != "" {
+		var err error
+		if sess, err = g.Sessions.CreateUnique(req.ID, req.Name); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+	} else {
+		sess = g.Sessions.Create(req.Name)
+	}
+
+	if req.AgentID != "" {
+		g.Sessions.Update(sess.ID, "", req.AgentID)
+	}
+
+	sess, _ = g.Sessions.Get(sess.ID)
+	writeJSON(w, http.StatusCreated, sess)
+}
+
+func (g *Gateway) handleSessionGet(w http.ResponseWriter, r *http.Request) {
+	sess, ok := g.Sessions.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, sess)
+}
+
+func (g *Gateway) handleSessionUpdate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string `json:"name"`
+		AgentID string `json:"agentId"`
+		Pinned  *bool  `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := g.Sessions.Update(id, req.Name, req.AgentID); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	if req.Pinned != nil {
+		if err := g.Sessions.Pin(id, *req.Pinned); err != nil {
+			writeSessionError(w, err)
+			return
+		}
+	}
+
+	sess, ok := g.Sessions.Get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, sess.Summary())
+}
+
+func (g *Gateway) handleSessionDelete(w http.ResponseWriter, r *http.Request) {
+	if !g.Sessions.Delete(r.PathValue("id")) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleSessionMessages(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	messages, next, err := g.Sessions.MessagesPage(r.PathValue("id"), q.Get("cursor"), limit)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"messages":   messages,
+		"nextCursor": next,
+	})
+}
+
+func (g *Gateway) handleSessionClear(w http.ResponseWriter, r *http.Request) {
+	if err := g.Sessions.Clear(r.PathValue("id")); err != nil {
+		writeSessionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) handleSessionExport(w http.ResponseWriter, r *http.Request) {
+	format, err := session.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_FORMAT", err.Error())
+		return
+	}
+
+	sess, ok := g.Sessions.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Session not found")
+		return
+	}
+
+	data, err := g.Sessions.Export(sess.ID, format)
+	if err != nil {
+		writeSessionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", session.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.FileName(sess, format)))
+	w.Write(data)
+}
+
+func (g *Gateway) handleSessionImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, 32<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", "Invalid request body")
+		return
+	}
+
+	sess, err := g.Sessions.Import(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_REQUEST", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, sess.Summary())
+}
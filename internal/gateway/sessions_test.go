@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestGateway returns a gateway with the token "t0ken" and a server for
+// its routes
+func newTestGateway(t *testing.T) (*Gateway, *httptest.Server) {
+	t.Helper()
+	g := New(0, "")
+	g.Token = "t0ken"
+	go g.hub.run()
+	srv := httptest.NewServer(g.Handler())
+	t.Cleanup(srv.Close)
+	return g, srv
+}
+
+// do sends a request to the test server, with the gateway token unless
+// token is empty
+func do(t *testing.T, srv *httptest.Server, method, path, body, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestSessionRoutesRequireToken(t *testing.T) {
+	g, srv := newTestGateway(t)
+	g.Sessions.CreateWithID("tg_42", "")
+
+	routes := []struct{ method, path, body string }{
+		{"GET", "/api/sessions", ""},
+		{"POST", "/api/sessions", `{"name":"x"}`},
+		{"GET", "/api/sessions/tg_42", ""},
+		{"PATCH", "/api/sessions/tg_42", `{"name":"x"}`},
+		{"GET", "/api/sessions/tg_42/messages", ""},
+		{"GET", "/api/sessions/tg_42/export", ""},
+		{"POST", "/api/sessions/import", `{"session":{"name":"x"}}`},
+		{"GET", "/api/search?q=hello", ""},
+		{"DELETE", "/api/sessions/tg_42/messages", ""},
+		{"DELETE", "/api/sessions/tg_42", ""},
+	}
+	for _, r := range routes {
+		if resp := do(t, srv, r.method, r.path, r.body, ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: status %d", r.method, r.path, resp.StatusCode)
+		}
+		if resp := do(t, srv, r.method, r.path, r.body, "wrong"); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s %s with wrong token: status %d", r.method, r.path, resp.StatusCode)
+		}
+	}
+	if _, ok := g.Sessions.Get("tg_42"); !ok {
+		t.Fatal("session deleted without a token")
+	}
+
+	for _, r := range routes {
+		if resp := do(t, srv, r.method, r.path, r.body, "t0ken"); resp.StatusCode >= 300 {
+			t.Errorf("%s %s with token: status %d", r.method, r.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestChatRequiresTokenForBotSessions(t *testing.T) {
+	_, srv := newTestGateway(t)
+
+	tests := []struct {
+		sessionID, token string
+		status           int
+	}{
+		{"tg_42", "", http.StatusUnauthorized},
+		{"discord_1_2", "wrong", http.StatusUnauthorized},
+		{"tg_42", "t0ken", http.StatusOK},
+		{"", "", http.StatusOK}, // The dashboard's "main" session
+		{"sess_1", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"sessionId":%q,"message":"hi"}`, tt.sessionID)
+		if resp := do(t, srv, "POST", "/api/chat", body, tt.token); resp.StatusCode != tt.status {
+			t.Errorf("session %q, token %q: status %d, want %d", tt.sessionID, tt.token, resp.StatusCode, tt.status)
+		}
+	}
+}
+
+func TestSessionCreateConflict(t *testing.T) {
+	_, srv := newTestGateway(t)
+
+	const posts = 8
+	statuses := make(chan int, posts)
+	var wg sync.WaitGroup
+	for i := 0; i < posts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", srv.URL+"/api/sessions", strings.NewReader(`{"id":"shared"}`))
+			req.Header.Set("Authorization", "Bearer t0ken")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created, conflicts := 0, 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		default:
+			t.Errorf("status %d", status)
+		}
+	}
+	if created != 1 || conflicts != posts-1 {
+		t.Errorf("%d created, %d conflicts", created, conflicts)
+	}
+}
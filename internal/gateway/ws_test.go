@@ -0,0 +1,218 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nanilabs/hiveclaw/internal/llm"
+	"github.com/nanilabs/hiveclaw/internal/session"
+)
+
+// blockingLLM answers once release is closed
+type blockingLLM struct {
+	release chan struct{}
+}
+
+func (b blockingLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	<-b.release
+	return &llm.Response{Content: "answer"}, nil
+}
+
+func (b blockingLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	<-b.release
+	ch := make(chan llm.StreamChunk, 1)
+	ch <- llm.StreamChunk{Content: "answer", Done: true}
+	close(ch)
+	return ch, nil
+}
+
+// failingLLM never answers
+type failingLLM struct{}
+
+func (failingLLM) Chat(messages []llm.Message, opts llm.Options) (*llm.Response, error) {
+	return nil, errors.New("upstream down")
+}
+
+func (failingLLM) Stream(messages []llm.Message, opts llm.Options) (<-chan llm.StreamChunk, error) {
+	return nil, errors.New("upstream down")
+}
+
+// wsClient is a test WebSocket connection to a gateway
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialWS(t *testing.T, url, token string) *wsClient {
+	t.Helper()
+	url = "ws" + strings.TrimPrefix(url, "http") + "/ws"
+	if token != "" {
+		url += "?token=" + token
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &wsClient{t: t, conn: conn}
+	if msg := c.read(); msg.Event != "connected" {
+		t.Fatalf("first message %+v", msg)
+	}
+	return c
+}
+
+func (c *wsClient) call(id, method string, params interface{}) {
+	c.t.Helper()
+	data, _ := json.Marshal(params)
+	if err := c.conn.WriteJSON(WSMessage{Type: TypeRequest, ID: id, Method: method, Params: data}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) read() WSMessage {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg WSMessage
+	if err := c.conn.ReadJSON(&msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+// response reads messages until the response to request id
+func (c *wsClient) response(id string) WSMessage {
+	c.t.Helper()
+	for {
+		if msg := c.read(); msg.Type == TypeResponse && msg.ID == id {
+			return msg
+		}
+	}
+}
+
+func TestRegenerateDoesNotBlockSocket(t *testing.T) {
+	g, srv := newTestGateway(t)
+	release := make(chan struct{})
+	g.LLM = blockingLLM{release: release}
+	g.Sessions.CreateWithID("s1", "")
+	g.Sessions.AddMessage("s1", "user", "hi")
+	g.Sessions.AddMessage("s1", "assistant", "hello")
+
+	c := dialWS(t, srv.URL, "t0ken")
+	c.call("1", "message.regenerate", map[string]string{"sessionId": "s1"})
+	c.call("2", "session.list", nil)
+
+	// The list comes back while the answer is still being generated
+	if msg := c.read(); msg.ID != "2" || msg.OK == nil || !*msg.OK {
+		t.Fatalf("got %+v before the list", msg)
+	}
+	close(release)
+	if msg := c.response("1"); msg.OK == nil || !*msg.OK {
+		t.Errorf("regenerate response %+v", msg)
+	}
+}
+
+func TestFailedAnswerKeepsBranch(t *testing.T) {
+	tests := []struct {
+		method   string
+		params   func(q *session.Message) map[string]string
+		variants int
+	}{
+		{
+			method: "message.regenerate",
+			params: func(*session.Message) map[string]string {
+				return map[string]string{"sessionId": "s1"}
+			},
+		},
+		{
+			method: "message.edit",
+			params: func(q *session.Message) map[string]string {
+				return map[string]string{"sessionId": "s1", "messageId": q.ID, "content": "q2"}
+			},
+			variants: 1, // The edit is kept, unanswered
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			g, srv := newTestGateway(t)
+			g.LLM = failingLLM{}
+			g.Sessions.CreateWithID("s1", "")
+			q, _ := g.Sessions.AddMessage("s1", "user", "q1")
+			g.Sessions.AddMessage("s1", "assistant", "a1")
+
+			c := dialWS(t, srv.URL, "t0ken")
+			c.call("1", tt.method, tt.params(q))
+			if resp := c.response("1"); resp.Error == nil || resp.Error.Code != "LLM_ERROR" {
+				t.Fatalf("response %+v", resp)
+			}
+
+			sess, _ := g.Sessions.Get("s1")
+			if len(sess.Messages) != 2 || sess.Messages[0].Content != "q1" || sess.Messages[1].Content != "a1" {
+				t.Errorf("active branch %+v", sess.Messages)
+			}
+			if len(sess.Variants) != tt.variants {
+				t.Errorf("%d variants, want %d", len(sess.Variants), tt.variants)
+			}
+		})
+	}
+}
+
+func TestWSRequiresToken(t *testing.T) {
+	g, srv := newTestGateway(t)
+	g.Sessions.CreateWithID("s1", "")
+	msg, _ := g.Sessions.AddMessage("s1", "user", "hi")
+
+	c := dialWS(t, srv.URL, "")
+	methods := []struct {
+		method string
+		params interface{}
+	}{
+		{"session.list", nil},
+		{"session.create", map[string]string{"name": "x"}},
+		{"session.search", map[string]string{"q": "hi"}},
+		{"session.export", map[string]string{"sessionId": "s1"}},
+		{"session.fork", map[string]string{"sessionId": "s1", "messageId": msg.ID}},
+		{"session.subscribe", map[string]string{"sessionId": "*"}},
+		{"session.pause", map[string]interface{}{"sessionId": "s1", "paused": true}},
+		{"operator.send", map[string]string{"sessionId": "s1", "content": "hi"}},
+		{"message.regenerate", map[string]string{"sessionId": "s1"}},
+		{"message.edit", map[string]string{"sessionId": "s1", "messageId": msg.ID, "content": "x"}},
+		{"message.variants", map[string]string{"sessionId": "s1", "messageId": msg.ID}},
+		{"message.checkout", map[string]string{"sessionId": "s1", "messageId": msg.ID}},
+	}
+	for i, m := range methods {
+		id := strconv.Itoa(i)
+		c.call(id, m.method, m.params)
+		if resp := c.response(id); resp.Error == nil || resp.Error.Code != "UNAUTHORIZED" {
+			t.Errorf("%s without a token: %+v", m.method, resp)
+		}
+	}
+	if n := len(g.Sessions.List()); n != 1 {
+		t.Errorf("%d sessions, want 1", n)
+	}
+	if sess, _ := g.Sessions.Get("s1"); sess.Paused || len(sess.Messages) != 1 {
+		t.Errorf("session changed without a token: %+v", sess)
+	}
+
+	// Presenting the token in connect unlocks them
+	c.call("c", "connect", map[string]string{"token": "t0ken"})
+	c.response("c")
+	c.call("s", "session.subscribe", map[string]string{"sessionId": "*"})
+	if resp := c.response("s"); resp.Error != nil {
+		t.Fatalf("subscribe with the token: %+v", resp.Error)
+	}
+	g.Sessions.AddMessage("s1", "assistant", "hello")
+	for {
+		if e := c.read(); e.Type == TypeEvent {
+			if e.Event != string(session.EventMessageAdded) {
+				t.Errorf("event %s", e.Event)
+			}
+			break
+		}
+	}
+}
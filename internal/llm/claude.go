@@ -2,12 +2,14 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 )
 
 // Provider interface for LLM providers
@@ -16,10 +18,42 @@ type Provider interface {
 	Stream(messages []Message, opts Options) (<-chan StreamChunk, error)
 }
 
-// Message represents a chat message
+// Message represents a chat message. Content is its text; images and
+// documents go in Parts.
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	Parts   []Part `json:"-"`
+}
+
+// UnmarshalJSON accepts content either as a plain string or as an array of
+// Anthropic-style content blocks, keeping the text, image and document
+// blocks.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	m.Role = raw.Role
+	m.Content = ""
+	m.Parts = nil
+	if len(raw.Content) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw.Content, &m.Content); err == nil {
+		return nil
+	}
+
+	text, parts, err := parseClaudeBlocks(raw.Content)
+	if err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	m.Content, m.Parts = text, parts
+	return nil
 }
 
 // Options for LLM requests
@@ -28,6 +62,16 @@ type Options struct {
 	MaxTokens   int     `json:"max_tokens"`
 	Temperature float64 `json:"temperature"`
 	System      string  `json:"system,omitempty"`
+
+	// Context cancels the upstream request when done; nil means no deadline
+	Context context.Context `json:"-"`
+}
+
+func (o Options) context() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
 }
 
 // Response from LLM
@@ -50,6 +94,11 @@ type StreamChunk struct {
 	Content string `json:"content,omitempty"`
 	Error   error  `json:"error,omitempty"`
 	Done    bool   `json:"done"`
+
+	// Set on the final chunk
+	Model      string `json:"model,omitempty"`
+	StopReason string `json:"stop_reason,omitempty"`
+	Usage      *Usage `json:"usage,omitempty"`
 }
 
 // ClaudeProvider implements Provider for Anthropic Claude
@@ -71,10 +120,50 @@ func NewClaude(apiKey string) *ClaudeProvider {
 
 // ClaudeRequest is the API request format
 type ClaudeRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	Messages  []Message `json:"messages"`
-	System    string    `json:"system,omitempty"`
+	Model       string    `json:"model"`
+	MaxTokens   int       `json:"max_tokens"`
+	Messages    []Message `json:"messages"`
+	System      string    `json:"system,omitempty"`
+	Temperature float64   `json:"temperature,omitempty"`
+	Stream      bool      `json:"stream,omitempty"`
+}
+
+// UnmarshalJSON accepts the system prompt either as a string or as an array
+// of text blocks.
+func (r *ClaudeRequest) UnmarshalJSON(data []byte) error {
+	type alias ClaudeRequest
+	var raw struct {
+		alias
+		System json.RawMessage `json:"system,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = ClaudeRequest(raw.alias)
+	r.System = ""
+	if len(raw.System) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw.System, &r.System); err == nil {
+		return nil
+	}
+
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw.System, &blocks); err != nil {
+		return fmt.Errorf("invalid system prompt: %w", err)
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" {
+			parts = append(parts, b.Text)
+		}
+	}
+	r.System = strings.Join(parts, "\n\n")
+	return nil
 }
 
 // ClaudeResponse is the API response format
@@ -101,10 +190,11 @@ func (c *ClaudeProvider) Chat(messages []Message, opts Options) (*Response, erro
 	}
 
 	req := ClaudeRequest{
-		Model:     opts.Model,
-		MaxTokens: opts.MaxTokens,
-		Messages:  messages,
-		System:    opts.System,
+		Model:       opts.Model,
+		MaxTokens:   opts.MaxTokens,
+		Messages:    messages,
+		System:      opts.System,
+		Temperature: opts.Temperature,
 	}
 
 	body, err := json.Marshal(req)
@@ -112,7 +202,7 @@ func (c *ClaudeProvider) Chat(messages []Message, opts Options) (*Response, erro
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", c.BaseURL+"/messages", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(opts.context(), "POST", c.BaseURL+"/messages", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -155,20 +245,94 @@ func (c *ClaudeProvider) Chat(messages []Message, opts Options) (*Response, erro
 
 // Stream sends a streaming chat request to Claude
 func (c *ClaudeProvider) Stream(messages []Message, opts Options) (<-chan StreamChunk, error) {
+	if opts.Model == "" {
+		opts.Model = "claude-sonnet-4-20250514"
+	}
+	if opts.MaxTokens == 0 {
+		opts.MaxTokens = 4096
+	}
+
+	req := ClaudeRequest{
+		Model:       opts.Model,
+		MaxTokens:   opts.MaxTokens,
+		Messages:    messages,
+		System:      opts.System,
+		Temperature: opts.Temperature,
+		Stream:      true,
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := opts.context()
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", c.APIKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := openStream(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
 	ch := make(chan StreamChunk)
 
 	go func() {
 		defer close(ch)
-
-		// For now, fall back to non-streaming
-		resp, err := c.Chat(messages, opts)
+		defer resp.Body.Close()
+
+		var usage Usage
+		model, stopReason := opts.Model, ""
+
+		err := readSSE(resp.Body, func(event, data string) error {
+			var ev struct {
+				Type    string `json:"type"`
+				Message struct {
+					Model string `json:"model"`
+					Usage Usage  `json:"usage"`
+				} `json:"message"`
+				Delta struct {
+					Type       string `json:"type"`
+					Text       string `json:"text"`
+					StopReason string `json:"stop_reason"`
+				} `json:"delta"`
+				Usage Usage `json:"usage"`
+				Error struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				return err
+			}
+
+			switch ev.Type {
+			case "message_start":
+				model = ev.Message.Model
+				usage.InputTokens = ev.Message.Usage.InputTokens
+			case "content_block_delta":
+				if ev.Delta.Type == "text_delta" && !sendChunk(ctx, ch, StreamChunk{Type: "content", Content: ev.Delta.Text}) {
+					return ctx.Err()
+				}
+			case "message_delta":
+				usage.OutputTokens = ev.Usage.OutputTokens
+				stopReason = ev.Delta.StopReason
+			case "error":
+				return fmt.Errorf("API error: %s", ev.Error.Message)
+			}
+			return nil
+		})
 		if err != nil {
-			ch <- StreamChunk{Error: err, Done: true}
+			sendChunk(ctx, ch, StreamChunk{Error: err, Done: true})
 			return
 		}
 
-		ch <- StreamChunk{Type: "content", Content: resp.Content}
-		ch <- StreamChunk{Type: "done", Done: true}
+		sendChunk(ctx, ch, StreamChunk{Type: "done", Done: true, Model: model, StopReason: stopReason, Usage: &usage})
 	}()
 
 	return ch, nil
@@ -206,23 +370,30 @@ func (o *OpenRouterProvider) Chat(messages []Message, opts Options) (*Response,
 		if len(preview) > 50 {
 			preview = preview[:50]
 		}
-		log.Printf("  [%d] %s: %s", i, m.Role, preview)
+		log.Printf("  [%d] %s: %s (%d parts)", i, m.Role, preview, len(m.Parts))
 	}
 
 	// OpenRouter uses OpenAI-compatible format
 	reqBody := map[string]interface{}{
 		"model":      opts.Model,
 		"max_tokens": opts.MaxTokens,
-		"messages":   messages,
+		"messages":   openAIMessages(messages),
+	}
+	if opts.Temperature != 0 {
+		reqBody["temperature"] = opts.Temperature
 	}
 
 	body, err := json.Marshal(reqBody)
-	log.Printf("Request body: %s", string(body))
+	if len(body) > maxLoggedBody {
+		log.Printf("Request body: %s… (%d bytes)", body[:maxLoggedBody], len(body))
+	} else {
+		log.Printf("Request body: %s", string(body))
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", o.BaseURL+"/chat/completions", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(opts.context(), "POST", o.BaseURL+"/chat/completions", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -280,17 +451,102 @@ func (o *OpenRouterProvider) Chat(messages []Message, opts Options) (*Response,
 
 // Stream sends a streaming chat request to OpenRouter
 func (o *OpenRouterProvider) Stream(messages []Message, opts Options) (<-chan StreamChunk, error) {
+	if opts.Model == "" {
+		opts.Model = "anthropic/claude-sonnet-4"
+	}
+	if opts.MaxTokens == 0 {
+		opts.MaxTokens = 4096
+	}
+
+	reqBody := map[string]interface{}{
+		"model":      opts.Model,
+		"max_tokens": opts.MaxTokens,
+		"messages":   openAIMessages(messages),
+		"stream":     true,
+	}
+	if opts.Temperature != 0 {
+		reqBody["temperature"] = opts.Temperature
+	}
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := opts.context()
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+o.APIKey)
+
+	resp, err := openStream(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
 	ch := make(chan StreamChunk)
 
 	go func() {
 		defer close(ch)
-		resp, err := o.Chat(messages, opts)
+		defer resp.Body.Close()
+
+		var usage Usage
+		model, stopReason := opts.Model, ""
+
+		err := readSSE(resp.Body, func(event, data string) error {
+			if data == "[DONE]" {
+				return nil
+			}
+
+			var chunk struct {
+				Model   string `json:"model"`
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+					FinishReason string `json:"finish_reason"`
+				} `json:"choices"`
+				Usage *struct {
+					PromptTokens     int `json:"prompt_tokens"`
+					CompletionTokens int `json:"completion_tokens"`
+				} `json:"usage"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return err
+			}
+			if chunk.Error != nil {
+				return fmt.Errorf("API error: %s", chunk.Error.Message)
+			}
+
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				usage.InputTokens = chunk.Usage.PromptTokens
+				usage.OutputTokens = chunk.Usage.CompletionTokens
+			}
+			for _, choice := range chunk.Choices {
+				if choice.FinishReason != "" {
+					stopReason = choice.FinishReason
+				}
+				if choice.Delta.Content != "" && !sendChunk(ctx, ch, StreamChunk{Type: "content", Content: choice.Delta.Content}) {
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
 		if err != nil {
-			ch <- StreamChunk{Error: err, Done: true}
+			sendChunk(ctx, ch, StreamChunk{Error: err, Done: true})
 			return
 		}
-		ch <- StreamChunk{Type: "content", Content: resp.Content}
-		ch <- StreamChunk{Type: "done", Done: true}
+
+		sendChunk(ctx, ch, StreamChunk{Type: "done", Done: true, Model: model, StopReason: stopReason, Usage: &usage})
 	}()
 
 	return ch, nil
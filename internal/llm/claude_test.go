@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// openRouterServer answers every request with text and sends the decoded
+// request bodies on the returned channel
+func openRouterServer(t *testing.T) (*OpenRouterProvider, <-chan map[string]interface{}) {
+	t.Helper()
+	bodies := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+		if body["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	o := NewOpenRouter("key")
+	o.BaseURL = srv.URL
+	return o, bodies
+}
+
+func TestOpenRouterTemperature(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "Hi"}}
+	tests := []struct {
+		name        string
+		temperature float64
+		want        interface{}
+	}{
+		{"set", 0.2, 0.2},
+		{"default", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, bodies := openRouterServer(t)
+
+			if _, err := o.Chat(messages, Options{Temperature: tt.temperature}); err != nil {
+				t.Fatal(err)
+			}
+			if got := (<-bodies)["temperature"]; got != tt.want {
+				t.Errorf("chat temperature %v, want %v", got, tt.want)
+			}
+
+			chunks, err := o.Stream(messages, Options{Temperature: tt.temperature})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range chunks {
+			}
+			if got := (<-bodies)["temperature"]; got != tt.want {
+				t.Errorf("stream temperature %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
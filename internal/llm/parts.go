@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Part types
+const (
+	PartText     = "text"
+	PartImage    = "image"
+	PartDocument = "document"
+)
+
+// maxLoggedBody caps how much of a request body is logged, since images
+// make them large
+const maxLoggedBody = 2000
+
+// Part is one piece of multi-part message content. Images and documents
+// carry either base64 Data with its MediaType or a URL.
+type Part struct {
+	Type      string
+	Text      string // Text parts
+	MediaType string // e.g. image/png or application/pdf
+	Data      string // Base64 encoded
+	URL       string
+	Name      string // File name of a document
+}
+
+// MarshalJSON writes a message in the Anthropic Messages format: content is
+// a plain string unless the message has parts.
+func (m Message) MarshalJSON() ([]byte, error) {
+	if len(m.Parts) == 0 {
+		return json.Marshal(struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}{m.Role, m.Content})
+	}
+	return json.Marshal(struct {
+		Role    string        `json:"role"`
+		Content []claudeBlock `json:"content"`
+	}{m.Role, claudeBlocks(m)})
+}
+
+// claudeBlock is an Anthropic content block
+type claudeBlock struct {
+	Type   string        `json:"type"`
+	Text   string        `json:"text,omitempty"`
+	Source *claudeSource `json:"source,omitempty"`
+	Title  string        `json:"title,omitempty"`
+}
+
+type claudeSource struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// claudeBlocks converts a message's parts to Anthropic content blocks. The
+// message text, if any, comes first.
+func claudeBlocks(m Message) []claudeBlock {
+	var blocks []claudeBlock
+	if m.Content != "" {
+		blocks = append(blocks, claudeBlock{Type: "text", Text: m.Content})
+	}
+	for _, p := range m.Parts {
+		switch p.Type {
+		case PartText:
+			blocks = append(blocks, claudeBlock{Type: "text", Text: p.Text})
+		case PartImage, PartDocument:
+			source := &claudeSource{Type: "base64", MediaType: p.MediaType, Data: p.Data}
+			if p.Data == "" {
+				source = &claudeSource{Type: "url", URL: p.URL}
+			}
+			block := claudeBlock{Type: p.Type, Source: source}
+			if p.Type == PartDocument {
+				block.Title = p.Name
+			}
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// parseClaudeBlocks reads Anthropic content blocks into message text and
+// parts. Text blocks are joined into the text; image and document blocks
+// become parts.
+func parseClaudeBlocks(data []byte) (string, []Part, error) {
+	var blocks []claudeBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return "", nil, err
+	}
+
+	var text strings.Builder
+	var parts []Part
+	for _, b := range blocks {
+		switch b.Type {
+		case "text":
+			text.WriteString(b.Text)
+		case PartImage, PartDocument:
+			if b.Source == nil {
+				continue
+			}
+			parts = append(parts, Part{
+				Type:      b.Type,
+				MediaType: b.Source.MediaType,
+				Data:      b.Source.Data,
+				URL:       b.Source.URL,
+				Name:      b.Title,
+			})
+		}
+	}
+	return text.String(), parts, nil
+}
+
+// openAIMessages converts messages to the OpenAI chat format, with
+// multi-part content as content parts
+func openAIMessages(messages []Message) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(messages))
+	for i, m := range messages {
+		if len(m.Parts) == 0 {
+			out[i] = map[string]interface{}{"role": m.Role, "content": m.Content}
+			continue
+		}
+
+		var content []map[string]interface{}
+		if m.Content != "" {
+			content = append(content, map[string]interface{}{"type": "text", "text": m.Content})
+		}
+		for _, p := range m.Parts {
+			switch p.Type {
+			case PartText:
+				content = append(content, map[string]interface{}{"type": "text", "text": p.Text})
+			case PartImage:
+				content = append(content, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]string{"url": p.dataURL()},
+				})
+			case PartDocument:
+				content = append(content, map[string]interface{}{
+					"type": "file",
+					"file": map[string]string{"filename": p.Name, "file_data": p.dataURL()},
+				})
+			}
+		}
+		out[i] = map[string]interface{}{"role": m.Role, "content": content}
+	}
+	return out
+}
+
+// dataURL returns the part's URL, or its data as a data: URL
+func (p Part) dataURL() string {
+	if p.Data == "" {
+		return p.URL
+	}
+	return "data:" + p.MediaType + ";base64," + p.Data
+}
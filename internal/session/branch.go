@@ -0,0 +1,269 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Sessions keep every message ever added as a tree linked by ParentID.
+// Session.Messages holds the active branch from the root to the head, and
+// Session.Variants holds the messages on every other branch. New messages
+// are always appended to the head of the active branch.
+
+// find returns the message with the given ID from any branch
+func (s *Session) find(id string) (Message, bool) {
+	for _, msg := range s.Messages {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	for _, msg := range s.Variants {
+		if msg.ID == id {
+			return msg, true
+		}
+	}
+	return Message{}, false
+}
+
+// checkout makes the branch ending at headID active. An empty headID
+// leaves the active branch empty, with every message kept as a variant.
+func (s *Session) checkout(headID string) {
+	all := make([]Message, 0, len(s.Messages)+len(s.Variants))
+	all = append(all, s.Messages...)
+	all = append(all, s.Variants...)
+
+	byID := make(map[string]Message, len(all))
+	for _, msg := range all {
+		byID[msg.ID] = msg
+	}
+
+	var path []Message
+	onPath := make(map[string]bool)
+	for id := headID; id != ""; {
+		msg, ok := byID[id]
+		if !ok || onPath[id] {
+			break
+		}
+		path = append(path, msg)
+		onPath[id] = true
+		id = msg.ParentID
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	var variants []Message
+	for _, msg := range all {
+		if !onPath[msg.ID] {
+			variants = append(variants, msg)
+		}
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		return variants[i].Timestamp.Before(variants[j].Timestamp)
+	})
+
+	if path == nil {
+		path = []Message{}
+	}
+	s.Messages = path
+	s.Variants = variants
+}
+
+// latestLeaf follows the most recent child of each message starting at id
+func (s *Session) latestLeaf(id string) string {
+	for {
+		next := ""
+		var newest time.Time
+		for _, list := range [][]Message{s.Messages, s.Variants} {
+			for _, msg := range list {
+				if msg.ParentID == id && (next == "" || msg.Timestamp.After(newest)) {
+					next = msg.ID
+					newest = msg.Timestamp
+				}
+			}
+		}
+		if next == "" {
+			return id
+		}
+		id = next
+	}
+}
+
+// Regenerate rewinds the active branch to just before its last assistant
+// message so the next assistant message added becomes a sibling variant of
+// it. The previous answer is kept as a variant. It returns the ID of the
+// message that headed the branch, so a regeneration that fails can be
+// undone with Checkout.
+func (m *Manager) Regenerate(sessionID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	for i := len(sess.Messages) - 1; i >= 0; i-- {
+		if sess.Messages[i].Role == "assistant" {
+			head := sess.Messages[len(sess.Messages)-1].ID
+			sess.checkout(sess.Messages[i].ParentID)
+			sess.UpdatedAt = time.Now()
+			m.publish(EventSessionUpdated, sess, nil)
+			return head, nil
+		}
+	}
+	return "", fmt.Errorf("no assistant message to regenerate in session: %s", sessionID)
+}
+
+// Edit adds a new version of a user message as a sibling of the original
+// and makes it the head of the active branch. The original message and
+// everything after it are kept as variants.
+func (m *Manager) Edit(sessionID, messageID, content string) (*Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	orig, ok := sess.find(messageID)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", messageID)
+	}
+	if orig.Role != "user" {
+		return nil, fmt.Errorf("only user messages can be edited: %s", messageID)
+	}
+
+	sess.checkout(orig.ParentID)
+
+	msg := Message{
+		ID:          newID("msg"),
+		ParentID:    orig.ParentID,
+		Role:        "user",
+		Content:     content,
+		Timestamp:   time.Now(),
+		Attachments: orig.Attachments,
+	}
+	sess.Messages = append(sess.Messages, msg)
+	sess.UpdatedAt = time.Now()
+	m.index.add(sessionID, msg)
+	m.publish(EventSessionUpdated, sess, nil)
+	m.publish(EventMessageAdded, sess, &msg)
+
+	return &msg, nil
+}
+
+// Checkout switches the active branch to the one containing messageID,
+// continuing through its most recent descendants.
+func (m *Manager) Checkout(sessionID, messageID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	if _, ok := sess.find(messageID); !ok {
+		return fmt.Errorf("message not found: %s", messageID)
+	}
+
+	sess.checkout(sess.latestLeaf(messageID))
+	sess.UpdatedAt = time.Now()
+	m.publish(EventSessionUpdated, sess, nil)
+	return nil
+}
+
+// Retract removes the message heading the active branch, such as a user
+// message whose answer was abandoned. Its parent becomes the head again.
+func (m *Manager) Retract(sessionID, messageID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	n := len(sess.Messages)
+	if n == 0 || sess.Messages[n-1].ID != messageID {
+		return fmt.Errorf("message is not the head of the active branch: %s", messageID)
+	}
+
+	msg := sess.Messages[n-1]
+	sess.Messages = sess.Messages[:n-1]
+	m.index.remove(sessionID, msg)
+	sess.UpdatedAt = time.Now()
+	m.publish(EventSessionUpdated, sess, nil)
+	return nil
+}
+
+// Siblings returns every variant of a message (including itself), oldest
+// first.
+func (m *Manager) Siblings(sessionID, messageID string) ([]Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	target, ok := sess.find(messageID)
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", messageID)
+	}
+
+	var siblings []Message
+	for _, list := range [][]Message{sess.Messages, sess.Variants} {
+		for _, msg := range list {
+			if msg.ParentID == target.ParentID {
+				siblings = append(siblings, msg)
+			}
+		}
+	}
+	sort.SliceStable(siblings, func(i, j int) bool {
+		return siblings[i].Timestamp.Before(siblings[j].Timestamp)
+	})
+	return siblings, nil
+}
+
+// Fork creates a new session whose history is the branch ending at
+// messageID.
+func (m *Manager) Fork(sessionID, messageID, name string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	src, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+	if _, ok := src.find(messageID); !ok {
+		return nil, fmt.Errorf("message not found: %s", messageID)
+	}
+
+	branch := &Session{
+		Messages: append([]Message{}, src.Messages...),
+		Variants: append([]Message{}, src.Variants...),
+	}
+	branch.checkout(messageID)
+
+	if name == "" {
+		name = src.Name + " (fork)"
+	}
+
+	sess := &Session{
+		ID:        newID("sess"),
+		Name:      name,
+		AgentID:   src.AgentID,
+		Messages:  branch.Messages,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Metadata:  map[string]interface{}{"forkedFrom": sessionID},
+	}
+
+	m.sessions[sess.ID] = sess
+	m.index.addSession(sess)
+	m.publish(EventSessionCreated, sess, nil)
+	return sess.Clone(), nil
+}
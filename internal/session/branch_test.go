@@ -0,0 +1,213 @@
+package session
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// contents returns the contents of messages, in order
+func contents(messages []Message) []string {
+	out := make([]string, len(messages))
+	for i, msg := range messages {
+		out[i] = msg.Content
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// conversation creates a session with a question and an answer
+func conversation(t *testing.T) (*Manager, *Message, *Message) {
+	t.Helper()
+	m := NewManager()
+	m.CreateWithID("s1", "")
+	q, _ := m.AddMessage("s1", "user", "q1")
+	a, _ := m.AddMessage("s1", "assistant", "a1")
+	return m, q, a
+}
+
+func TestBranching(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      func(m *Manager, q, a *Message) error
+		active   []string
+		variants int
+	}{
+		{
+			name: "regenerate",
+			run: func(m *Manager, q, a *Message) error {
+				if _, err := m.Regenerate("s1"); err != nil {
+					return err
+				}
+				_, err := m.AddMessage("s1", "assistant", "a2")
+				return err
+			},
+			active:   []string{"q1", "a2"},
+			variants: 1,
+		},
+		{
+			name: "regenerate undone",
+			run: func(m *Manager, q, a *Message) error {
+				head, err := m.Regenerate("s1")
+				if err != nil {
+					return err
+				}
+				return m.Checkout("s1", head)
+			},
+			active: []string{"q1", "a1"},
+		},
+		{
+			name: "edit",
+			run: func(m *Manager, q, a *Message) error {
+				if _, err := m.Edit("s1", q.ID, "q2"); err != nil {
+					return err
+				}
+				_, err := m.AddMessage("s1", "assistant", "a2")
+				return err
+			},
+			active:   []string{"q2", "a2"},
+			variants: 2,
+		},
+		{
+			name: "checkout the original",
+			run: func(m *Manager, q, a *Message) error {
+				if _, err := m.Edit("s1", q.ID, "q2"); err != nil {
+					return err
+				}
+				return m.Checkout("s1", q.ID)
+			},
+			active:   []string{"q1", "a1"},
+			variants: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, q, a := conversation(t)
+			if err := tt.run(m, q, a); err != nil {
+				t.Fatal(err)
+			}
+			sess, _ := m.Get("s1")
+			if got := contents(sess.Messages); !equal(got, tt.active) {
+				t.Errorf("active branch %q, want %q", got, tt.active)
+			}
+			if len(sess.Variants) != tt.variants {
+				t.Errorf("%d variants, want %d", len(sess.Variants), tt.variants)
+			}
+		})
+	}
+}
+
+func TestBranchingErrors(t *testing.T) {
+	m, _, a := conversation(t)
+	if _, err := m.Edit("s1", a.ID, "x"); err == nil {
+		t.Errorf("edited an assistant message")
+	}
+	if _, err := m.Edit("s1", "missing", "x"); err == nil {
+		t.Errorf("edited a missing message")
+	}
+	if err := m.Checkout("s1", "missing"); err == nil {
+		t.Errorf("checked out a missing message")
+	}
+
+	m.CreateWithID("empty", "")
+	if _, err := m.Regenerate("empty"); err == nil {
+		t.Errorf("regenerated without an answer")
+	}
+	if _, err := m.Regenerate("nope"); err == nil {
+		t.Errorf("regenerated a missing session")
+	}
+	if _, err := m.Fork("s1", "missing", ""); err == nil {
+		t.Errorf("forked at a missing message")
+	}
+}
+
+func TestRetract(t *testing.T) {
+	m, q, _ := conversation(t)
+	q2, _ := m.AddMessage("s1", "user", "q2")
+
+	if err := m.Retract("s1", q.ID); err == nil {
+		t.Errorf("retracted a message that isn't the head")
+	}
+	if err := m.Retract("s1", q2.ID); err != nil {
+		t.Fatal(err)
+	}
+	sess, _ := m.Get("s1")
+	if got := contents(sess.Messages); !equal(got, []string{"q1", "a1"}) || len(sess.Variants) != 0 {
+		t.Errorf("messages %q, %d variants", got, len(sess.Variants))
+	}
+	if n := len(m.Search(SearchQuery{Query: "q2"})); n != 0 {
+		t.Errorf("retracted message still searchable")
+	}
+	if err := m.Retract("nope", q2.ID); err == nil {
+		t.Errorf("retracted from a missing session")
+	}
+}
+
+func TestSiblingsAndFork(t *testing.T) {
+	m, q, a := conversation(t)
+	m.Regenerate("s1")
+	a2, _ := m.AddMessage("s1", "assistant", "a2")
+
+	siblings, err := m.Siblings("s1", a2.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(siblings); !equal(got, []string{"a1", "a2"}) {
+		t.Errorf("siblings %q", got)
+	}
+
+	fork, err := m.Fork("s1", a.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.ID == "s1" || !strings.HasSuffix(fork.Name, " (fork)") || fork.Metadata["forkedFrom"] != "s1" {
+		t.Errorf("fork %+v", fork)
+	}
+	if got := contents(fork.Messages); !equal(got, []string{"q1", "a1"}) || len(fork.Variants) != 0 {
+		t.Errorf("fork messages %q, %d variants", got, len(fork.Variants))
+	}
+	if fork.Messages[0].ID != q.ID {
+		t.Errorf("fork doesn't keep message IDs")
+	}
+}
+
+func TestMessageIDsAreUnique(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "")
+
+	const writers, each = 8, 200
+	ids := make(chan string, writers*each)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				msg, _ := m.AddMessage("s1", "user", "x")
+				ids <- msg.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate ID %s", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType identifies a session event
+type EventType string
+
+const (
+	EventSessionCreated  EventType = "session.created"
+	EventSessionUpdated  EventType = "session.updated" // Renamed, pinned or branch switched
+	EventSessionDeleted  EventType = "session.deleted"
+	EventSessionCleared  EventType = "session.cleared"
+	EventMessageAdded    EventType = "message.added"
+	EventMessageDelta    EventType = "message.delta"    // Part of an answer still being streamed
+	EventMessagesTrimmed EventType = "messages.trimmed" // Oldest messages dropped by retention
+)
+
+// DefaultEventBuffer is the number of events a subscriber may fall behind
+// before it is dropped
+const DefaultEventBuffer = 256
+
+// Event describes a change to a session
+type Event struct {
+	Type       EventType `json:"type"`
+	SessionID  string    `json:"sessionId"`
+	Session    *Summary  `json:"session,omitempty"`    // Created and updated events
+	Message    *Message  `json:"message,omitempty"`    // Added messages
+	Delta      string    `json:"delta,omitempty"`      // Streamed text
+	MessageIDs []string  `json:"messageIds,omitempty"` // Trimmed messages
+	Time       time.Time `json:"time"`
+}
+
+// Bus fans session events out to subscribers. Publishing never blocks: a
+// subscriber whose buffer is full is dropped and its channel closed.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives events from a Bus on C until it is closed or dropped
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	filter  func(Event) bool
+	bus     *Bus
+	dropped bool
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscriber. filter, if set, selects the events it
+// receives; it is called while publishing and must not block or call back
+// into the Manager.
+func (b *Bus) Subscribe(filter func(Event) bool, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	ch := make(chan Event, buffer)
+	s := &Subscription{C: ch, ch: ch, filter: filter, bus: b}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+// Publish delivers an event to every matching subscriber
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			log.Printf("Dropping slow event subscriber")
+			s.dropped = true
+			delete(b.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
+
+// Dropped reports whether the subscription was closed for falling behind
+func (s *Subscription) Dropped() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.dropped
+}
+
+// PublishDelta announces part of an assistant answer that is still being
+// generated for a session
+func (m *Manager) PublishDelta(sessionID, text string) {
+	m.Events.Publish(Event{Type: EventMessageDelta, SessionID: sessionID, Delta: text})
+}
+
+// publish emits an event about a session. Callers hold m.mu so events are
+// delivered in the order the changes were made.
+func (m *Manager) publish(t EventType, sess *Session, msg *Message) {
+	e := Event{Type: t, SessionID: sess.ID}
+	switch t {
+	case EventSessionCreated, EventSessionUpdated:
+		summary := sess.Summary()
+		e.Session = &summary
+	}
+	e.Message = msg
+	m.Events.Publish(e)
+}
@@ -0,0 +1,87 @@
+package session
+
+import "testing"
+
+func TestBus(t *testing.T) {
+	b := NewBus()
+	all := b.Subscribe(nil, 4)
+	one := b.Subscribe(func(e Event) bool { return e.SessionID == "s1" }, 4)
+	slow := b.Subscribe(nil, 1)
+
+	b.Publish(Event{Type: EventMessageAdded, SessionID: "s1"})
+	b.Publish(Event{Type: EventMessageAdded, SessionID: "s2"})
+
+	if e := <-all.C; e.SessionID != "s1" || e.Time.IsZero() {
+		t.Errorf("first event %+v", e)
+	}
+	if e := <-all.C; e.SessionID != "s2" {
+		t.Errorf("second event %+v", e)
+	}
+	if e := <-one.C; e.SessionID != "s1" {
+		t.Errorf("filtered event %+v", e)
+	}
+	select {
+	case e := <-one.C:
+		t.Errorf("filter let %+v through", e)
+	default:
+	}
+
+	// The slow subscriber fell behind on the second event
+	<-slow.C
+	if _, ok := <-slow.C; ok || !slow.Dropped() {
+		t.Errorf("slow subscriber not dropped")
+	}
+	if all.Dropped() {
+		t.Errorf("subscriber with room dropped")
+	}
+
+	all.Close()
+	all.Close()
+	if _, ok := <-all.C; ok {
+		t.Errorf("channel open after Close")
+	}
+	slow.Close() // already dropped
+	b.Publish(Event{Type: EventMessageAdded, SessionID: "s1"})
+	if e := <-one.C; e.SessionID != "s1" {
+		t.Errorf("remaining subscriber got %+v", e)
+	}
+}
+
+func TestManagerEvents(t *testing.T) {
+	m := NewManager()
+	sub := m.Events.Subscribe(nil, 0)
+	defer sub.Close()
+
+	m.CreateWithID("s1", "Chat")
+	msg, _ := m.AddMessage("s1", "user", "hi")
+	m.PublishDelta("s1", "he")
+	m.Update("s1", "Renamed", "")
+	m.Clear("s1")
+	m.Delete("s1")
+
+	want := []EventType{EventSessionCreated, EventMessageAdded, EventMessageDelta, EventSessionUpdated, EventSessionCleared, EventSessionDeleted}
+	for _, typ := range want {
+		e := <-sub.C
+		if e.Type != typ || e.SessionID != "s1" {
+			t.Fatalf("got %s for %s, want %s", e.Type, e.SessionID, typ)
+		}
+		switch typ {
+		case EventSessionCreated:
+			if e.Session == nil || e.Session.Name != "Chat" {
+				t.Errorf("created event %+v", e.Session)
+			}
+		case EventSessionUpdated:
+			if e.Session == nil || e.Session.Name != "Renamed" {
+				t.Errorf("updated event %+v", e.Session)
+			}
+		case EventMessageAdded:
+			if e.Message == nil || e.Message.ID != msg.ID {
+				t.Errorf("added event %+v", e.Message)
+			}
+		case EventMessageDelta:
+			if e.Delta != "he" {
+				t.Errorf("delta %q", e.Delta)
+			}
+		}
+	}
+}
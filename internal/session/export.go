@@ -0,0 +1,232 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	FormatMarkdown  = "markdown"
+	FormatJSON      = "json"
+	FormatOpenAI    = "openai"    // OpenAI fine-tuning JSONL
+	FormatAnthropic = "anthropic" // Anthropic fine-tuning JSONL
+)
+
+// exportVersion is the version of the canonical JSON format
+const exportVersion = 1
+
+// exportDocument is the canonical JSON export envelope
+type exportDocument struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	Session    *Session  `json:"session"`
+}
+
+// ParseFormat normalizes an export format name, accepting common aliases
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "md", "markdown":
+		return FormatMarkdown, nil
+	case "json":
+		return FormatJSON, nil
+	case "openai", "jsonl", "openai-jsonl":
+		return FormatOpenAI, nil
+	case "anthropic", "claude", "anthropic-jsonl":
+		return FormatAnthropic, nil
+	default:
+		return "", fmt.Errorf("unknown export format: %s", name)
+	}
+}
+
+// FileName returns a download file name for a session export
+func FileName(sess *Session, format string) string {
+	ext := ".md"
+	switch format {
+	case FormatJSON:
+		ext = ".json"
+	case FormatOpenAI, FormatAnthropic:
+		ext = ".jsonl"
+	}
+	return fmt.Sprintf("hiveclaw-%s%s", sess.ID, ext)
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatJSON:
+		return "application/json"
+	case FormatOpenAI, FormatAnthropic:
+		return "application/jsonl"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// Export renders a session in the given format
+func Export(sess *Session, format string) ([]byte, error) {
+	switch format {
+	case FormatMarkdown:
+		return exportMarkdown(sess), nil
+	case FormatJSON:
+		return json.MarshalIndent(exportDocument{
+			Format:     "hiveclaw.session",
+			Version:    exportVersion,
+			ExportedAt: time.Now(),
+			Session:    sess,
+		}, "", "  ")
+	case FormatOpenAI:
+		return jsonLine(map[string]interface{}{
+			"messages": trainingMessages(sess),
+		})
+	case FormatAnthropic:
+		return jsonLine(map[string]interface{}{
+			"system":   "",
+			"messages": trainingMessages(sess),
+		})
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+func jsonLine(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func exportMarkdown(sess *Session) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# %s\n\n", sess.Name)
+	fmt.Fprintf(&b, "- **Session:** `%s`\n", sess.ID)
+	fmt.Fprintf(&b, "- **Agent:** %s\n", sess.AgentID)
+	fmt.Fprintf(&b, "- **Created:** %s\n", sess.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- **Messages:** %d\n", len(sess.Messages))
+
+	for _, msg := range sess.Messages {
+		role := msg.Role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s\n\n%s\n", role, msg.Timestamp.Format("2006-01-02 15:04:05"), msg.Content)
+	}
+
+	return b.Bytes()
+}
+
+type trainingMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// trainingMessages returns the active branch as alternating user/assistant
+// turns, starting with a user turn and ending with an assistant turn
+func trainingMessages(sess *Session) []trainingMessage {
+	var out []trainingMessage
+	for _, msg := range sess.Messages {
+		role := ChatRole(msg.Role)
+		if role != "user" && role != "assistant" {
+			continue
+		}
+		if len(out) == 0 && role != "user" {
+			continue
+		}
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		out = append(out, trainingMessage{Role: role, Content: msg.Content})
+	}
+
+	for len(out) > 0 && out[len(out)-1].Role != "assistant" {
+		out = out[:len(out)-1]
+	}
+	if out == nil {
+		out = []trainingMessage{}
+	}
+	return out
+}
+
+// Export renders the session with the given ID
+func (m *Manager) Export(id, format string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return Export(sess, format)
+}
+
+// Import recreates a session from the canonical JSON export (a bare session
+// object is accepted too). The session always gets a fresh ID, so an import
+// can't take over a channel's session key; the exported ID is kept in the
+// "importedFrom" metadata. Attachment references are dropped because they
+// point at files on the original channel and would otherwise be fetched when
+// the conversation continues.
+func (m *Manager) Import(data []byte) (*Session, error) {
+	var doc exportDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid session export: %w", err)
+	}
+
+	sess := doc.Session
+	if sess == nil {
+		sess = &Session{}
+		if err := json.Unmarshal(data, sess); err != nil {
+			return nil, fmt.Errorf("invalid session export: %w", err)
+		}
+	}
+	if doc.Version > exportVersion {
+		return nil, fmt.Errorf("unsupported export version: %d", doc.Version)
+	}
+
+	if sess.Messages == nil {
+		sess.Messages = []Message{}
+	}
+	if sess.Metadata == nil {
+		sess.Metadata = make(map[string]interface{})
+	}
+	if sess.ID != "" {
+		sess.Metadata["importedFrom"] = sess.ID
+	}
+	if sess.AgentID == "" {
+		sess.AgentID = "main"
+	}
+	if sess.CreatedAt.IsZero() {
+		sess.CreatedAt = time.Now()
+	}
+	sess.UpdatedAt = time.Now()
+	stripRefs(sess.Messages)
+	stripRefs(sess.Variants)
+
+	sess.ID = newID("sess")
+	if sess.Name == "" {
+		sess.Name = sess.ID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[sess.ID] = sess
+	m.index.addSession(sess)
+	m.publish(EventSessionCreated, sess, nil)
+	return sess.Clone(), nil
+}
+
+// stripRefs drops the channel references of imported attachments
+func stripRefs(messages []Message) {
+	for i := range messages {
+		for j := range messages[i].Attachments {
+			messages[i].Attachments[j].Ref = ""
+		}
+	}
+}
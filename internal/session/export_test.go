@@ -0,0 +1,113 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("tg_42", "Support")
+	m.AddMessageWithAttachments("tg_42", "user", "look", []Attachment{{Type: "image", MediaType: "image/png", Name: "a.png", Ref: "https://example.com/a.png"}})
+	m.AddMessage("tg_42", "assistant", "a1")
+	m.Regenerate("tg_42")
+	m.AddMessage("tg_42", "assistant", "a2")
+
+	data, err := m.Export("tg_42", FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		sess, err := m.Import(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(sess.ID, "sess_") {
+			t.Errorf("imported as %s, want a fresh sess_ ID", sess.ID)
+		}
+		if sess.Metadata["importedFrom"] != "tg_42" {
+			t.Errorf("importedFrom = %v", sess.Metadata["importedFrom"])
+		}
+		if sess.Name != "Support" {
+			t.Errorf("name = %q", sess.Name)
+		}
+		if got := contents(sess.Messages); !equal(got, []string{"look", "a2"}) {
+			t.Errorf("messages %q", got)
+		}
+		if len(sess.Variants) != 1 {
+			t.Errorf("%d variants, want 1", len(sess.Variants))
+		}
+		if a := sess.Messages[0].Attachments; len(a) != 1 || a[0].Name != "a.png" || a[0].Ref != "" {
+			t.Errorf("attachments %+v, want the reference stripped", a)
+		}
+	}
+
+	orig, _ := m.Get("tg_42")
+	if orig.Messages[0].Attachments[0].Ref == "" {
+		t.Errorf("import changed the original session")
+	}
+	if n := len(m.List()); n != 3 {
+		t.Errorf("%d sessions, want 3", n)
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	m := NewManager()
+	tests := []string{
+		`not json`,
+		`{"format":"hiveclaw.session","version":99,"session":{"id":"x"}}`,
+	}
+	for _, data := range tests {
+		if _, err := m.Import([]byte(data)); err == nil {
+			t.Errorf("imported %s", data)
+		}
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "Chat")
+	m.AddMessage("s1", "assistant", "hello") // dropped: training starts with a user turn
+	m.AddMessage("s1", "user", "q1")
+	m.AddMessage("s1", "user", "more")
+	m.AddMessage("s1", "assistant", "a1")
+	m.AddMessage("s1", "user", "dangling")
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{FormatMarkdown, []string{"# Chat", "### User", "### Assistant", "dangling"}},
+		{FormatJSON, []string{`"format": "hiveclaw.session"`, `"version": 1`}},
+		{FormatOpenAI, []string{`{"messages":[{"role":"user","content":"q1\n\nmore"},{"role":"assistant","content":"a1"}]}`}},
+		{FormatAnthropic, []string{`"system":""`, `"content":"a1"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			data, err := m.Export("s1", tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !bytes.Contains(data, []byte(want)) {
+					t.Errorf("missing %s in\n%s", want, data)
+				}
+			}
+			if tt.format == FormatOpenAI || tt.format == FormatAnthropic {
+				if bytes.Count(data, []byte("\n")) != 1 || !json.Valid(bytes.TrimSpace(data)) {
+					t.Errorf("not a single JSON line: %s", data)
+				}
+			}
+		})
+	}
+
+	if _, err := m.Export("missing", FormatJSON); err == nil {
+		t.Errorf("exported a missing session")
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Errorf("accepted an unknown format")
+	}
+}
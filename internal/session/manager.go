@@ -1,17 +1,41 @@
 package session
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Manager errors
+var (
+	ErrNotFound = errors.New("session not found")      // The session does not exist
+	ErrExists   = errors.New("session already exists") // The session ID is taken
+)
+
 // Message represents a chat message
 type Message struct {
 	ID        string    `json:"id"`
-	Role      string    `json:"role"` // "user", "assistant", "system"
+	ParentID  string    `json:"parentId,omitempty"` // Previous message in the branch
+	Role      string    `json:"role"`               // "user", "assistant", "system", "operator"
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Files sent with the message. Only references are kept; the channel
+	// that received them knows how to fetch them again.
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment references a file a user sent
+type Attachment struct {
+	Type      string `json:"type"`      // "image" or "document"
+	MediaType string `json:"mediaType"` // e.g. image/jpeg
+	Name      string `json:"name,omitempty"`
+	Ref       string `json:"ref"` // Channel-specific reference, e.g. a file ID or URL
+	Size      int    `json:"size,omitempty"`
 }
 
 // Session represents a chat session
@@ -19,41 +43,161 @@ type Session struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	AgentID   string    `json:"agentId"`
-	Messages  []Message `json:"messages"`
+	Messages  []Message `json:"messages"`           // Active branch, oldest first
+	Variants  []Message `json:"variants,omitempty"` // Messages on inactive branches
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	Pinned    bool      `json:"pinned,omitempty"` // Exempt from retention
+	Paused    bool      `json:"paused,omitempty"` // LLM replies off while an operator takes over
+}
+
+// Summary describes a session without its message bodies
+type Summary struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	AgentID      string    `json:"agentId"`
+	Channel      string    `json:"channel"`
+	MessageCount int       `json:"messageCount"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	Paused       bool      `json:"paused,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
-// Manager manages all sessions
+// Summary returns the session's listing entry
+func (s *Session) Summary() Summary {
+	return Summary{
+		ID:           s.ID,
+		Name:         s.Name,
+		AgentID:      s.AgentID,
+		Channel:      ChannelOf(s.ID),
+		MessageCount: len(s.Messages),
+		Pinned:       s.Pinned,
+		Paused:       s.Paused,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+	}
+}
+
+// ChannelOf derives the originating channel from a session ID
+func ChannelOf(id string) string {
+	switch {
+	case strings.HasPrefix(id, "tg_"):
+		return "telegram"
+	case strings.HasPrefix(id, "discord_"):
+		return "discord"
+	default:
+		return "web"
+	}
+}
+
+// ChatRole maps a stored message role to the role used in LLM history.
+// Operators reply on the bot's behalf, so their messages count as assistant
+// turns.
+func ChatRole(role string) string {
+	if role == "operator" {
+		return "assistant"
+	}
+	return role
+}
+
+// Clone returns a deep copy of the session. Metadata values are copied
+// shallowly.
+func (s *Session) Clone() *Session {
+	c := *s
+	c.Messages = append([]Message{}, s.Messages...)
+	if s.Variants != nil {
+		c.Variants = append([]Message{}, s.Variants...)
+	}
+	c.Metadata = make(map[string]interface{}, len(s.Metadata))
+	for k, v := range s.Metadata {
+		c.Metadata[k] = v
+	}
+	return &c
+}
+
+// Manager manages all sessions. Sessions returned by its methods are
+// snapshots: changing them has no effect, and all writes go through the
+// Manager.
 type Manager struct {
-	sessions map[string]*Session
-	mu       sync.RWMutex
+	// Turns serializes conversation turns per session
+	Turns *TurnQueue
+
+	// Events announces changes to sessions
+	Events *Bus
+
+	sessions  map[string]*Session
+	index     *index
+	retention RetentionPolicy
+	evicted   []Eviction // Waiting for OnEvict
+	stats     RetentionStats
+	janitor   *janitor
+	mu        sync.RWMutex
 }
 
 // NewManager creates a new session manager
 func NewManager() *Manager {
 	return &Manager{
+		Turns:    NewTurnQueue(DefaultMaxQueuedTurns, 0),
+		Events:   NewBus(),
 		sessions: make(map[string]*Session),
+		index:    newIndex(),
+	}
+}
+
+// lastID is the number in the most recently generated ID
+var lastID atomic.Int64
+
+// newID returns a unique ID with the given prefix. IDs follow the clock
+// but always increase, so ones generated at the same instant differ.
+func newID(prefix string) string {
+	for {
+		last := lastID.Load()
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if lastID.CompareAndSwap(last, next) {
+			return fmt.Sprintf("%s_%d", prefix, next)
+		}
 	}
 }
 
 // Create creates a new session with auto-generated ID
 func (m *Manager) Create(name string) *Session {
-	id := fmt.Sprintf("sess_%d", time.Now().UnixNano())
-	return m.CreateWithID(id, name)
+	return m.CreateWithID(newID("sess"), name)
 }
 
-// CreateWithID creates a session with a specific ID
+// CreateWithID creates a session with a specific ID, replacing any session
+// that had it
 func (m *Manager) CreateWithID(id, name string) *Session {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.index.removeSession(id)
+	return m.add(newSession(id, name))
+}
+
+// CreateUnique creates a session with a specific ID, failing with ErrExists
+// if a session already has it
+func (m *Manager) CreateUnique(id, name string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sessions[id]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrExists, id)
+	}
+	return m.add(newSession(id, name)), nil
+}
+
+// newSession returns an empty session, named after the time if name is
+// empty
+func newSession(id, name string) *Session {
 	if name == "" {
 		name = fmt.Sprintf("Session %s", time.Now().Format("15:04"))
 	}
-
-	sess := &Session{
+	return &Session{
 		ID:        id,
 		Name:      name,
 		AgentID:   "main",
@@ -62,9 +206,13 @@ func (m *Manager) CreateWithID(id, name string) *Session {
 		UpdatedAt: time.Now(),
 		Metadata:  make(map[string]interface{}),
 	}
+}
 
-	m.sessions[id] = sess
-	return sess
+// add stores a new session and returns a snapshot of it. Callers hold m.mu.
+func (m *Manager) add(sess *Session) *Session {
+	m.sessions[sess.ID] = sess
+	m.publish(EventSessionCreated, sess, nil)
+	return sess.Clone()
 }
 
 // GetOrCreate returns existing session or creates one with the given ID
@@ -73,76 +221,207 @@ func (m *Manager) GetOrCreate(id string) *Session {
 	defer m.mu.Unlock()
 
 	if sess, ok := m.sessions[id]; ok {
-		return sess
-	}
-
-	sess := &Session{
-		ID:        id,
-		Name:      id,
-		AgentID:   "main",
-		Messages:  []Message{},
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-		Metadata:  make(map[string]interface{}),
+		return sess.Clone()
 	}
-	m.sessions[id] = sess
-	return sess
+	return m.add(newSession(id, id))
 }
 
-// Get retrieves a session by ID
+// Get retrieves a snapshot of a session by ID
 func (m *Manager) Get(id string) (*Session, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	sess, ok := m.sessions[id]
-	return sess, ok
+	if !ok {
+		return nil, false
+	}
+	return sess.Clone(), true
 }
 
-// List returns all sessions
+// List returns snapshots of all sessions
 func (m *Manager) List() []*Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	result := make([]*Session, 0, len(m.sessions))
 	for _, sess := range m.sessions {
-		result = append(result, sess)
+		result = append(result, sess.Clone())
+	}
+	return result
+}
+
+// Summaries returns session listings, most recently updated first.
+// Empty channel or agentID values match every session.
+func (m *Manager) Summaries(channel, agentID string) []Summary {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Summary, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		if channel != "" && ChannelOf(sess.ID) != channel {
+			continue
+		}
+		if agentID != "" && sess.AgentID != agentID {
+			continue
+		}
+		result = append(result, sess.Summary())
 	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UpdatedAt.After(result[j].UpdatedAt)
+	})
 	return result
 }
 
+// Update renames a session and/or changes its agent. Empty values are left
+// unchanged.
+func (m *Manager) Update(id, name, agentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	if name != "" {
+		sess.Name = name
+	}
+	if agentID != "" {
+		sess.AgentID = agentID
+	}
+	sess.UpdatedAt = time.Now()
+	m.publish(EventSessionUpdated, sess, nil)
+	return nil
+}
+
 // AddMessage adds a message to a session
 func (m *Manager) AddMessage(sessionID string, role, content string) (*Message, error) {
+	return m.AddMessageWithAttachments(sessionID, role, content, nil)
+}
+
+// AddMessageWithAttachments adds a message carrying file references to a
+// session
+func (m *Manager) AddMessageWithAttachments(sessionID string, role, content string, attachments []Attachment) (*Message, error) {
 	m.mu.Lock()
+	defer m.notifyEvicted()
 	defer m.mu.Unlock()
 
 	sess, ok := m.sessions[sessionID]
 	if !ok {
-		return nil, fmt.Errorf("session not found: %s", sessionID)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
 	}
 
 	msg := Message{
-		ID:        fmt.Sprintf("msg_%d", time.Now().UnixNano()),
-		Role:      role,
-		Content:   content,
-		Timestamp: time.Now(),
+		ID:          newID("msg"),
+		Role:        role,
+		Content:     content,
+		Timestamp:   time.Now(),
+		Attachments: attachments,
+	}
+	if n := len(sess.Messages); n > 0 {
+		msg.ParentID = sess.Messages[n-1].ID
 	}
 
 	sess.Messages = append(sess.Messages, msg)
 	sess.UpdatedAt = time.Now()
+	m.index.add(sessionID, msg)
+	m.publish(EventMessageAdded, sess, &msg)
+	m.trim(sess)
 
 	return &msg, nil
 }
 
-// GetMessages returns all messages in a session
+// GetMessages returns a copy of the active branch of a session
 func (m *Manager) GetMessages(sessionID string) ([]Message, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	sess, ok := m.sessions[sessionID]
 	if !ok {
-		return nil, fmt.Errorf("session not found: %s", sessionID)
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	return append([]Message{}, sess.Messages...), nil
+}
+
+// SetMetadata sets a metadata value on a session
+func (m *Manager) SetMetadata(id, key string, value interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	sess.Metadata[key] = value
+	sess.UpdatedAt = time.Now()
+	return nil
+}
+
+// Pause stops or resumes LLM replies in a session, so a human operator can
+// take over the conversation and later hand it back
+func (m *Manager) Pause(id string, paused bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	sess.Paused = paused
+	sess.UpdatedAt = time.Now()
+	m.publish(EventSessionUpdated, sess, nil)
+	return nil
+}
+
+// Paused reports whether LLM replies are paused in a session
+func (m *Manager) Paused(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.sessions[id]
+	return ok && sess.Paused
+}
+
+// MessagesPage returns up to limit messages following the message with ID
+// cursor (from the start if cursor is empty), and the cursor for the next
+// page, which is empty when there are no more messages.
+func (m *Manager) MessagesPage(sessionID, cursor string, limit int) ([]Message, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.sessions[sessionID]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotFound, sessionID)
+	}
+
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, msg := range sess.Messages {
+			if msg.ID == cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, "", fmt.Errorf("invalid cursor: %s", cursor)
+		}
 	}
 
-	return sess.Messages, nil
+	end := len(sess.Messages)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	page := make([]Message, end-start)
+	copy(page, sess.Messages[start:end])
+
+	next := ""
+	if end < len(sess.Messages) && end > start {
+		next = sess.Messages[end-1].ID
+	}
+	return page, next, nil
 }
 
 // Delete removes a session
@@ -151,7 +430,7 @@ func (m *Manager) Delete(id string) bool {
 	defer m.mu.Unlock()
 
 	if _, ok := m.sessions[id]; ok {
-		delete(m.sessions, id)
+		m.remove(id)
 		return true
 	}
 	return false
@@ -164,10 +443,13 @@ func (m *Manager) Clear(sessionID string) error {
 
 	sess, ok := m.sessions[sessionID]
 	if !ok {
-		return fmt.Errorf("session not found: %s", sessionID)
+		return fmt.Errorf("%w: %s", ErrNotFound, sessionID)
 	}
 
 	sess.Messages = []Message{}
+	sess.Variants = nil
 	sess.UpdatedAt = time.Now()
+	m.index.removeSession(sessionID)
+	m.publish(EventSessionCleared, sess, nil)
 	return nil
 }
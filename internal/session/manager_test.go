@@ -0,0 +1,108 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsAreIsolated(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "")
+	m.AddMessage("s1", "user", "hello")
+
+	sess, _ := m.Get("s1")
+	sess.Name = "changed"
+	sess.Messages[0].Content = "changed"
+	sess.Messages = append(sess.Messages, Message{ID: "x"})
+	sess.Metadata["k"] = "v"
+
+	messages, _ := m.GetMessages("s1")
+	messages[0].Content = "changed too"
+
+	got, _ := m.Get("s1")
+	if got.Name == "changed" {
+		t.Errorf("name changed through snapshot")
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "hello" {
+		t.Errorf("messages changed through snapshot: %+v", got.Messages)
+	}
+	if _, ok := got.Metadata["k"]; ok {
+		t.Errorf("metadata changed through snapshot")
+	}
+}
+
+// TestConcurrentTraffic simulates the gateway, Telegram and Discord using
+// one manager at the same time. Run with -race.
+func TestConcurrentTraffic(t *testing.T) {
+	m := NewManager()
+	m.SetRetention(RetentionPolicy{MaxMessages: 50, MaxSessions: 20})
+	m.StartJanitor(time.Millisecond)
+	defer m.Close()
+
+	const (
+		workers = 8
+		turns   = 50
+	)
+
+	var wg sync.WaitGroup
+
+	// Bots: each worker owns a few chats and runs user/assistant turns
+	for _, prefix := range []string{"tg", "discord"} {
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(prefix string, w int) {
+				defer wg.Done()
+				for i := 0; i < turns; i++ {
+					id := fmt.Sprintf("%s_%d", prefix, (w+i)%4)
+					m.GetOrCreate(id)
+					m.AddMessage(id, "user", fmt.Sprintf("question %d from %d", i, w))
+					m.GetMessages(id)
+					m.AddMessage(id, "assistant", fmt.Sprintf("answer %d", i))
+
+					switch i % 10 {
+					case 3:
+						m.Regenerate(id)
+						m.AddMessage(id, "assistant", "another answer")
+					case 7:
+						m.Clear(id)
+					case 9:
+						m.Delete(id)
+					}
+				}
+			}(prefix, w)
+		}
+	}
+
+	// Gateway: list, encode, page, search and export while bots write
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < turns; i++ {
+				for _, sess := range m.List() {
+					if _, err := json.Marshal(sess); err != nil {
+						t.Errorf("marshal: %v", err)
+					}
+					m.MessagesPage(sess.ID, "", 10)
+					m.Export(sess.ID, FormatMarkdown)
+				}
+				m.Summaries("", "")
+				m.Search(SearchQuery{Query: "question answer"})
+				if sess, ok := m.Get("tg_0"); ok {
+					json.Marshal(sess)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	for _, sess := range m.List() {
+		if len(sess.Messages) > 50 {
+			t.Errorf("%s has %d messages, want at most 50", sess.ID, len(sess.Messages))
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package session
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+// RetentionPolicy limits how much session data the manager keeps. Zero
+// values disable the corresponding limit. Pinned sessions are exempt.
+type RetentionPolicy struct {
+	MaxSessions int           // Evict least recently updated sessions beyond this count
+	MaxMessages int           // Trim the oldest messages of a session beyond this count
+	IdleTTL     time.Duration // Expire sessions not updated for this long
+	MaxAge      time.Duration // Expire sessions created this long ago
+
+	// OnEvict, if set, is told about everything retention removes so that a
+	// persistent store can drop it too. It is called once the manager is
+	// unlocked, so it may use the Manager; evictions made by concurrent
+	// calls can be reported in any order.
+	OnEvict func(Eviction)
+}
+
+// DefaultJanitorInterval is how often Configure enforces the retention
+// policy when the config does not say
+const DefaultJanitorInterval = 5 * time.Minute
+
+// Eviction reasons
+const (
+	EvictIdle     = "idle"
+	EvictAge      = "age"
+	EvictOverflow = "overflow"
+	EvictTrim     = "trim"
+)
+
+// Eviction describes data removed by retention
+type Eviction struct {
+	Reason    string
+	SessionID string
+	Session   *Session  // The removed session; nil for trims
+	Messages  []Message // Trimmed messages, including variants
+}
+
+// RetentionStats counts what retention has removed
+type RetentionStats struct {
+	Sessions        int       `json:"sessions"`
+	ExpiredIdle     int64     `json:"expiredIdle"`
+	ExpiredAge      int64     `json:"expiredAge"`
+	EvictedOverflow int64     `json:"evictedOverflow"`
+	TrimmedMessages int64     `json:"trimmedMessages"`
+	LastRun         time.Time `json:"lastRun,omitempty"`
+}
+
+// janitor periodically enforces the retention policy
+type janitor struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// Configure applies the session settings from the config file. It sets up
+// the turn queue and the retention policy, keeping any OnEvict hook, and
+// starts the janitor if there are session limits to enforce; Close stops
+// it. Call it before the manager is in use.
+func (m *Manager) Configure(c configs.SessionsConfig) {
+	maxQueued := c.MaxQueuedTurns
+	if maxQueued <= 0 {
+		maxQueued = DefaultMaxQueuedTurns
+	}
+	m.Turns = NewTurnQueue(maxQueued, time.Duration(c.CoalesceWindow))
+
+	m.mu.Lock()
+	m.retention = RetentionPolicy{
+		MaxSessions: c.MaxSessions,
+		MaxMessages: c.MaxMessages,
+		IdleTTL:     time.Duration(c.IdleTTL),
+		MaxAge:      time.Duration(c.MaxAge),
+		OnEvict:     m.retention.OnEvict,
+	}
+	m.mu.Unlock()
+
+	if c.MaxSessions <= 0 && c.IdleTTL <= 0 && c.MaxAge <= 0 {
+		return
+	}
+	interval := time.Duration(c.JanitorInterval)
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	m.StartJanitor(interval)
+}
+
+// SetRetention sets the retention policy. Message limits apply as messages
+// are added; session limits apply on each janitor run or Enforce call.
+func (m *Manager) SetRetention(p RetentionPolicy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retention = p
+}
+
+// Pin exempts a session from retention, or makes it subject to it again
+func (m *Manager) Pin(id string, pinned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	sess.Pinned = pinned
+	m.publish(EventSessionUpdated, sess, nil)
+	return nil
+}
+
+// RetentionStats returns eviction counters
+func (m *Manager) RetentionStats() RetentionStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := m.stats
+	stats.Sessions = len(m.sessions)
+	return stats
+}
+
+// Enforce applies the retention policy once and returns the number of
+// sessions removed
+func (m *Manager) Enforce() int {
+	m.mu.Lock()
+	defer m.notifyEvicted()
+	defer m.mu.Unlock()
+
+	p := m.retention
+	now := time.Now()
+	removed := 0
+
+	for id, sess := range m.sessions {
+		if sess.Pinned {
+			continue
+		}
+		switch {
+		case p.MaxAge > 0 && now.Sub(sess.CreatedAt) > p.MaxAge:
+			m.stats.ExpiredAge++
+			m.evict(id, EvictAge)
+		case p.IdleTTL > 0 && now.Sub(sess.UpdatedAt) > p.IdleTTL:
+			m.stats.ExpiredIdle++
+			m.evict(id, EvictIdle)
+		default:
+			m.trim(sess)
+			continue
+		}
+		removed++
+	}
+
+	if p.MaxSessions > 0 && len(m.sessions) > p.MaxSessions {
+		var candidates []*Session
+		for _, sess := range m.sessions {
+			if !sess.Pinned {
+				candidates = append(candidates, sess)
+			}
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].UpdatedAt.Before(candidates[j].UpdatedAt)
+		})
+		for _, sess := range candidates {
+			if len(m.sessions) <= p.MaxSessions {
+				break
+			}
+			m.evict(sess.ID, EvictOverflow)
+			m.stats.EvictedOverflow++
+			removed++
+		}
+	}
+
+	m.stats.LastRun = now
+	return removed
+}
+
+// StartJanitor enforces the retention policy every interval until Close
+func (m *Manager) StartJanitor(interval time.Duration) {
+	m.mu.Lock()
+	if m.janitor != nil || interval <= 0 {
+		m.mu.Unlock()
+		return
+	}
+	j := &janitor{stop: make(chan struct{})}
+	m.janitor = j
+	m.mu.Unlock()
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if n := m.Enforce(); n > 0 {
+					log.Printf("🧹 Session janitor removed %d sessions", n)
+				}
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the janitor and waits for it to exit
+func (m *Manager) Close() {
+	m.mu.RLock()
+	j := m.janitor
+	m.mu.RUnlock()
+
+	if j == nil {
+		return
+	}
+	j.once.Do(func() { close(j.stop) })
+	j.wg.Wait()
+}
+
+// remove deletes a session and its index entries. Callers hold m.mu.
+func (m *Manager) remove(id string) {
+	sess, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	delete(m.sessions, id)
+	m.index.removeSession(id)
+	m.publish(EventSessionDeleted, sess, nil)
+}
+
+// evict removes a session for the given retention reason and queues it for
+// OnEvict. Callers hold m.mu.
+func (m *Manager) evict(id, reason string) {
+	sess, ok := m.sessions[id]
+	if !ok {
+		return
+	}
+	m.remove(id)
+	if m.retention.OnEvict != nil {
+		m.evicted = append(m.evicted, Eviction{Reason: reason, SessionID: id, Session: sess})
+	}
+}
+
+// notifyEvicted passes the queued evictions to OnEvict. Callers that may
+// evict defer it before unlocking m.mu, so that it runs after.
+func (m *Manager) notifyEvicted() {
+	m.mu.Lock()
+	evicted, onEvict := m.evicted, m.retention.OnEvict
+	m.evicted = nil
+	m.mu.Unlock()
+
+	for _, e := range evicted {
+		onEvict(e)
+	}
+}
+
+// trim drops the oldest messages of an unpinned session beyond the
+// MaxMessages limit, along with any variants branching off them, and
+// announces them with a messages.trimmed event and to OnEvict. Callers
+// hold m.mu.
+func (m *Manager) trim(sess *Session) {
+	max := m.retention.MaxMessages
+	if max <= 0 || sess.Pinned || len(sess.Messages) <= max {
+		return
+	}
+
+	cut := len(sess.Messages) - max
+	removed := append([]Message{}, sess.Messages[:cut]...)
+	dropped := make(map[string]bool)
+	for _, msg := range removed {
+		dropped[msg.ID] = true
+		m.index.remove(sess.ID, msg)
+	}
+
+	sess.Messages = append([]Message{}, sess.Messages[cut:]...)
+	sess.Messages[0].ParentID = ""
+
+	// Variants are ordered oldest first, so parents are seen before children
+	var variants []Message
+	for _, msg := range sess.Variants {
+		if msg.ParentID == "" || dropped[msg.ParentID] {
+			dropped[msg.ID] = true
+			removed = append(removed, msg)
+			m.index.remove(sess.ID, msg)
+			continue
+		}
+		variants = append(variants, msg)
+	}
+	sess.Variants = variants
+
+	m.stats.TrimmedMessages += int64(len(removed))
+
+	ids := make([]string, len(removed))
+	for i, msg := range removed {
+		ids[i] = msg.ID
+	}
+	m.Events.Publish(Event{Type: EventMessagesTrimmed, SessionID: sess.ID, MessageIDs: ids})
+	if m.retention.OnEvict != nil {
+		m.evicted = append(m.evicted, Eviction{Reason: EvictTrim, SessionID: sess.ID, Messages: removed})
+	}
+}
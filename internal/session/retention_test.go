@@ -0,0 +1,272 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+// age moves a session's timestamps into the past
+func age(m *Manager, id string, created, updated time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sess := m.sessions[id]
+	sess.CreatedAt = time.Now().Add(-created)
+	sess.UpdatedAt = time.Now().Add(-updated)
+}
+
+func TestEnforce(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetentionPolicy
+		pinned  string
+		want    []string // Remaining sessions
+		reasons map[string]string
+	}{
+		{
+			name:    "idle",
+			policy:  RetentionPolicy{IdleTTL: time.Hour},
+			want:    []string{"fresh", "old"},
+			reasons: map[string]string{"idle": EvictIdle},
+		},
+		{
+			name:    "age",
+			policy:  RetentionPolicy{MaxAge: 24 * time.Hour},
+			want:    []string{"fresh", "idle"},
+			reasons: map[string]string{"old": EvictAge},
+		},
+		{
+			name:    "overflow evicts the least recently updated",
+			policy:  RetentionPolicy{MaxSessions: 1},
+			want:    []string{"old"},
+			reasons: map[string]string{"idle": EvictOverflow, "fresh": EvictOverflow},
+		},
+		{
+			name:    "pinned sessions are exempt",
+			policy:  RetentionPolicy{IdleTTL: time.Hour, MaxSessions: 2},
+			pinned:  "idle",
+			want:    []string{"idle", "old"},
+			reasons: map[string]string{"fresh": EvictOverflow},
+		},
+		{
+			name:    "no limits",
+			policy:  RetentionPolicy{},
+			want:    []string{"fresh", "idle", "old"},
+			reasons: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			for _, id := range []string{"fresh", "idle", "old"} {
+				m.CreateWithID(id, "")
+			}
+			age(m, "fresh", time.Minute, 2*time.Minute)
+			age(m, "idle", 2*time.Hour, 2*time.Hour)
+			age(m, "old", 48*time.Hour, time.Minute)
+			if tt.pinned != "" {
+				m.Pin(tt.pinned, true)
+			}
+
+			reasons := make(map[string]string)
+			tt.policy.OnEvict = func(e Eviction) {
+				if e.Session == nil || e.Session.ID != e.SessionID {
+					t.Errorf("eviction of %s without its session", e.SessionID)
+				}
+				reasons[e.SessionID] = e.Reason
+			}
+			m.SetRetention(tt.policy)
+
+			if n := m.Enforce(); n != len(tt.reasons) {
+				t.Errorf("removed %d, want %d", n, len(tt.reasons))
+			}
+			var got []string
+			for _, s := range m.List() {
+				got = append(got, s.ID)
+			}
+			sort.Strings(got)
+			if !equal(got, tt.want) {
+				t.Errorf("remaining %q, want %q", got, tt.want)
+			}
+			if len(reasons) != len(tt.reasons) {
+				t.Errorf("evictions %v, want %v", reasons, tt.reasons)
+			}
+			for id, reason := range tt.reasons {
+				if reasons[id] != reason {
+					t.Errorf("%s evicted for %q, want %q", id, reasons[id], reason)
+				}
+			}
+
+			stats := m.RetentionStats()
+			if stats.Sessions != len(tt.want) || stats.LastRun.IsZero() {
+				t.Errorf("stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestTrim(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "")
+
+	var evictions []Eviction
+	m.SetRetention(RetentionPolicy{MaxMessages: 3, OnEvict: func(e Eviction) { evictions = append(evictions, e) }})
+	sub := m.Events.Subscribe(func(e Event) bool { return e.Type == EventMessagesTrimmed }, 0)
+	defer sub.Close()
+
+	m.AddMessage("s1", "user", "q1")
+	m.AddMessage("s1", "assistant", "a1")
+	m.Regenerate("s1")
+	m.AddMessage("s1", "assistant", "a1b") // a1 becomes a variant of q1
+	m.AddMessage("s1", "user", "q2")
+	m.AddMessage("s1", "assistant", "a2") // q1 and its variant a1 go
+
+	sess, _ := m.Get("s1")
+	if got := contents(sess.Messages); !equal(got, []string{"a1b", "q2", "a2"}) {
+		t.Errorf("messages %q", got)
+	}
+	if sess.Messages[0].ParentID != "" || len(sess.Variants) != 0 {
+		t.Errorf("trimmed branch still points at dropped messages: %+v", sess)
+	}
+	if n := len(m.Search(SearchQuery{Query: "q1"})); n != 0 {
+		t.Errorf("trimmed message still searchable")
+	}
+
+	if len(evictions) != 1 || evictions[0].Reason != EvictTrim || evictions[0].Session != nil {
+		t.Fatalf("evictions %+v", evictions)
+	}
+	if got := contents(evictions[0].Messages); !equal(got, []string{"q1", "a1"}) {
+		t.Errorf("evicted %q", got)
+	}
+
+	select {
+	case e := <-sub.C:
+		if e.SessionID != "s1" || len(e.MessageIDs) != 2 || e.MessageIDs[0] != evictions[0].Messages[0].ID {
+			t.Errorf("event %+v", e)
+		}
+	default:
+		t.Error("no messages.trimmed event")
+	}
+	if stats := m.RetentionStats(); stats.TrimmedMessages != 2 {
+		t.Errorf("trimmed %d, want 2", stats.TrimmedMessages)
+	}
+
+	// Pinned sessions keep everything
+	m.Pin("s1", true)
+	m.AddMessage("s1", "user", "q3")
+	if sess, _ := m.Get("s1"); len(sess.Messages) != 4 {
+		t.Errorf("pinned session trimmed to %d", len(sess.Messages))
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("idle", "")
+	age(m, "idle", time.Hour, time.Hour)
+	m.SetRetention(RetentionPolicy{IdleTTL: time.Minute})
+
+	m.StartJanitor(5 * time.Millisecond)
+	m.StartJanitor(5 * time.Millisecond) // no second janitor
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := m.Get("idle"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("janitor didn't expire the idle session")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	m.Close()
+	m.Close() // safe to repeat
+	last := m.RetentionStats().LastRun
+	time.Sleep(20 * time.Millisecond)
+	if m.RetentionStats().LastRun != last {
+		t.Error("janitor still running after Close")
+	}
+}
+
+func TestOnEvictCanUseManager(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("idle", "")
+	m.CreateWithID("s1", "")
+	age(m, "idle", time.Hour, time.Hour)
+
+	var seen []string
+	m.SetRetention(RetentionPolicy{IdleTTL: time.Minute, MaxMessages: 1, OnEvict: func(e Eviction) {
+		// Calling back in would deadlock if the manager were still locked
+		_, ok := m.Get(e.SessionID)
+		seen = append(seen, fmt.Sprintf("%s %s %v", e.Reason, e.SessionID, ok))
+	}})
+
+	m.Enforce()
+	m.AddMessage("s1", "user", "q1")
+	m.AddMessage("s1", "assistant", "a1")
+
+	want := []string{"idle idle false", "trim s1 true"}
+	if !equal(seen, want) {
+		t.Errorf("evictions %q, want %q", seen, want)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"sessions": {"maxSessions": 1, "maxMessages": 2, "idleTtl": "1h", "janitorInterval": "5ms"}}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := configs.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	var evicted []string
+	var mu sync.Mutex
+	m.SetRetention(RetentionPolicy{OnEvict: func(e Eviction) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, e.Reason+" "+e.SessionID)
+	}})
+	m.CreateWithID("idle", "")
+	m.CreateWithID("old", "")
+	m.CreateWithID("new", "")
+	age(m, "idle", 2*time.Hour, 2*time.Hour)
+	age(m, "old", 2*time.Minute, 2*time.Minute)
+
+	m.Configure(cfg.Sessions)
+	defer m.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(m.List()) > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("janitor left %d sessions", len(m.List()))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := m.Get("new"); !ok {
+		t.Error("the most recent session was evicted")
+	}
+
+	m.AddMessage("new", "user", "q1")
+	m.AddMessage("new", "assistant", "a1")
+	m.AddMessage("new", "user", "q2")
+	if sess, _ := m.Get("new"); len(sess.Messages) != 2 {
+		t.Errorf("%d messages, want 2", len(sess.Messages))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"idle idle", "overflow old", "trim new"}; !equal(evicted, want) {
+		t.Errorf("evictions %q, want %q (the hook survives Configure)", evicted, want)
+	}
+}
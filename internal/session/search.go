@@ -0,0 +1,331 @@
+package session
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchQuery describes a full-text search across sessions
+type SearchQuery struct {
+	Query   string    `json:"q"`
+	Role    string    `json:"role,omitempty"`
+	AgentID string    `json:"agent,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+	Until   time.Time `json:"until,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+
+	// Scope restricts results to the session with this ID and sessions whose
+	// IDs extend it (e.g. "tg_42" also matches "tg_42_7")
+	Scope string `json:"scope,omitempty"`
+}
+
+// SearchResult is a message matching a search
+type SearchResult struct {
+	SessionID   string  `json:"sessionId"`
+	SessionName string  `json:"sessionName"`
+	Message     Message `json:"message"`
+	Score       float64 `json:"score"`
+	Snippet     string  `json:"snippet"` // Excerpt with matches wrapped in **
+}
+
+const (
+	defaultSearchLimit = 20
+	snippetContext     = 60
+)
+
+type docRef struct {
+	sessionID string
+	messageID string
+}
+
+// index is an inverted index from terms to the messages containing them.
+// It is guarded by the Manager's mutex.
+type index struct {
+	postings map[string]map[docRef]int // term -> message -> term frequency
+	lengths  map[docRef]int            // message -> number of terms
+	sessions map[string][]docRef       // session -> indexed messages
+	total    int                       // sum of all lengths
+}
+
+func newIndex() *index {
+	return &index{
+		postings: make(map[string]map[docRef]int),
+		lengths:  make(map[docRef]int),
+		sessions: make(map[string][]docRef),
+	}
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lowercased letter/digit runs with their byte
+// offsets
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func (idx *index) add(sessionID string, msg Message) {
+	ref := docRef{sessionID, msg.ID}
+	if _, ok := idx.lengths[ref]; ok {
+		return
+	}
+
+	tokens := tokenize(msg.Content)
+	for _, t := range tokens {
+		docs, ok := idx.postings[t.term]
+		if !ok {
+			docs = make(map[docRef]int)
+			idx.postings[t.term] = docs
+		}
+		docs[ref]++
+	}
+
+	idx.lengths[ref] = len(tokens)
+	idx.total += len(tokens)
+	idx.sessions[sessionID] = append(idx.sessions[sessionID], ref)
+}
+
+func (idx *index) remove(sessionID string, msg Message) {
+	ref := docRef{sessionID, msg.ID}
+	length, ok := idx.lengths[ref]
+	if !ok {
+		return
+	}
+
+	for _, t := range tokenize(msg.Content) {
+		if docs := idx.postings[t.term]; docs != nil {
+			delete(docs, ref)
+			if len(docs) == 0 {
+				delete(idx.postings, t.term)
+			}
+		}
+	}
+
+	idx.total -= length
+	delete(idx.lengths, ref)
+
+	refs := idx.sessions[sessionID]
+	for i, r := range refs {
+		if r == ref {
+			idx.sessions[sessionID] = append(refs[:i], refs[i+1:]...)
+			break
+		}
+	}
+}
+
+func (idx *index) addSession(sess *Session) {
+	for _, msg := range sess.Messages {
+		idx.add(sess.ID, msg)
+	}
+	for _, msg := range sess.Variants {
+		idx.add(sess.ID, msg)
+	}
+}
+
+func (idx *index) removeSession(sessionID string) {
+	removed := make(map[docRef]bool)
+	for _, ref := range idx.sessions[sessionID] {
+		removed[ref] = true
+		idx.total -= idx.lengths[ref]
+		delete(idx.lengths, ref)
+	}
+	delete(idx.sessions, sessionID)
+	if len(removed) == 0 {
+		return
+	}
+
+	for term, docs := range idx.postings {
+		for ref := range docs {
+			if removed[ref] {
+				delete(docs, ref)
+			}
+		}
+		if len(docs) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+}
+
+// score ranks messages against the query terms with BM25
+func (idx *index) score(terms []string) map[docRef]float64 {
+	const k1, b = 1.2, 0.75
+
+	n := float64(len(idx.lengths))
+	avg := 1.0
+	if n > 0 {
+		avg = math.Max(float64(idx.total)/n, 1)
+	}
+
+	scores := make(map[docRef]float64)
+	for _, term := range terms {
+		docs := idx.postings[term]
+		if len(docs) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+		for ref, tf := range docs {
+			f := float64(tf)
+			norm := f * (k1 + 1) / (f + k1*(1-b+b*float64(idx.lengths[ref])/avg))
+			scores[ref] += idf * norm
+		}
+	}
+	return scores
+}
+
+// Search finds messages matching the query across all sessions, best
+// matches first
+func (m *Manager) Search(q SearchQuery) []SearchResult {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range tokenize(q.Query) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	if len(terms) == 0 {
+		return []SearchResult{}
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	results := []SearchResult{}
+	for ref, score := range m.index.score(terms) {
+		sess, ok := m.sessions[ref.sessionID]
+		if !ok || !q.matchesSession(sess) {
+			continue
+		}
+		msg, ok := sess.find(ref.messageID)
+		if !ok || !q.matchesMessage(msg) {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			SessionID:   sess.ID,
+			SessionName: sess.Name,
+			Message:     msg,
+			Score:       score,
+			Snippet:     snippet(msg.Content, seen),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Message.Timestamp.After(results[j].Message.Timestamp)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+func (q SearchQuery) matchesSession(sess *Session) bool {
+	if q.Scope != "" && sess.ID != q.Scope && !strings.HasPrefix(sess.ID, q.Scope+"_") {
+		return false
+	}
+	if q.AgentID != "" && sess.AgentID != q.AgentID {
+		return false
+	}
+	if q.Channel != "" && ChannelOf(sess.ID) != q.Channel {
+		return false
+	}
+	return true
+}
+
+func (q SearchQuery) matchesMessage(msg Message) bool {
+	if q.Role != "" && msg.Role != q.Role {
+		return false
+	}
+	if !q.Since.IsZero() && msg.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && msg.Timestamp.After(q.Until) {
+		return false
+	}
+	return true
+}
+
+// snippet returns an excerpt around the first match with every matching
+// term wrapped in **
+func snippet(content string, terms map[string]bool) string {
+	tokens := tokenize(content)
+
+	first := -1
+	for i, t := range tokens {
+		if terms[t.term] {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start := tokens[first].start - snippetContext
+	if start < 0 {
+		start = 0
+	}
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	end := tokens[first].end + 2*snippetContext
+	if end > len(content) {
+		end = len(content)
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, t := range tokens {
+		if t.start < start || t.end > end || !terms[t.term] {
+			continue
+		}
+		b.WriteString(content[pos:t.start])
+		b.WriteString("**")
+		b.WriteString(content[t.start:t.end])
+		b.WriteString("**")
+		pos = t.end
+	}
+	b.WriteString(content[pos:end])
+	if end < len(content) {
+		b.WriteString("…")
+	}
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
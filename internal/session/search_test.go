@@ -0,0 +1,105 @@
+package session
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchFilters(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("tg_42", "Telegram")
+	m.CreateWithID("tg_42_7", "Telegram topic")
+	m.CreateWithID("discord_1", "Discord")
+	m.CreateWithID("web", "Web")
+	m.Update("discord_1", "", "coder")
+
+	m.AddMessage("tg_42", "user", "deploy the kubernetes cluster")
+	m.AddMessage("tg_42_7", "assistant", "the cluster is deployed")
+	m.AddMessage("discord_1", "user", "cluster logs please")
+	between := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	m.AddMessage("web", "user", "cluster is down")
+
+	tests := []struct {
+		name  string
+		query SearchQuery
+		want  []string // session IDs of the results
+	}{
+		{"all", SearchQuery{Query: "cluster"}, []string{"discord_1", "tg_42", "tg_42_7", "web"}},
+		{"no terms", SearchQuery{Query: "  !! "}, nil},
+		{"no match", SearchQuery{Query: "database"}, nil},
+		{"role", SearchQuery{Query: "cluster", Role: "assistant"}, []string{"tg_42_7"}},
+		{"agent", SearchQuery{Query: "cluster", AgentID: "coder"}, []string{"discord_1"}},
+		{"channel", SearchQuery{Query: "cluster", Channel: "telegram"}, []string{"tg_42", "tg_42_7"}},
+		{"web channel", SearchQuery{Query: "cluster", Channel: "web"}, []string{"web"}},
+		{"scope", SearchQuery{Query: "cluster", Scope: "tg_42"}, []string{"tg_42", "tg_42_7"}},
+		{"scope is not a prefix match", SearchQuery{Query: "cluster", Scope: "tg_4"}, nil},
+		{"since", SearchQuery{Query: "cluster", Since: between}, []string{"web"}},
+		{"until", SearchQuery{Query: "cluster", Until: between}, []string{"discord_1", "tg_42", "tg_42_7"}},
+		{"limit", SearchQuery{Query: "cluster", Limit: 1}, []string{"web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := m.Search(tt.query)
+			if results == nil {
+				t.Fatalf("nil results, want an empty slice")
+			}
+			var got []string
+			for _, r := range results {
+				got = append(got, r.SessionID)
+			}
+			if tt.query.Limit == 0 {
+				sort.Strings(got)
+			}
+			if !equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "")
+	m.AddMessage("s1", "user", "a note about golang and other things entirely unrelated to it")
+	best, _ := m.AddMessage("s1", "user", "golang golang")
+
+	results := m.Search(SearchQuery{Query: "Golang"})
+	if len(results) != 2 || results[0].Message.ID != best.ID {
+		t.Fatalf("results %+v, want the denser match first", results)
+	}
+	if results[0].Snippet != "**golang** **golang**" {
+		t.Errorf("snippet %q", results[0].Snippet)
+	}
+}
+
+func TestSearchFollowsEdits(t *testing.T) {
+	m := NewManager()
+	m.CreateWithID("s1", "")
+	msg, _ := m.AddMessage("s1", "user", "first draft")
+	m.Edit("s1", msg.ID, "second version")
+
+	// The original message survives as a variant and stays searchable
+	if n := len(m.Search(SearchQuery{Query: "draft"})); n != 1 {
+		t.Errorf("%d results for the original text, want 1", n)
+	}
+	if n := len(m.Search(SearchQuery{Query: "version"})); n != 1 {
+		t.Errorf("%d results for the edited text, want 1", n)
+	}
+
+	m.Delete("s1")
+	if n := len(m.Search(SearchQuery{Query: "draft version"})); n != 0 {
+		t.Errorf("%d results after deleting the session", n)
+	}
+}
+
+func TestSnippetTrimsLongMessages(t *testing.T) {
+	content := strings.Repeat("lorem ", 40) + "needle" + strings.Repeat(" ipsum", 60)
+	got := snippet(content, map[string]bool{"needle": true})
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "**needle**") {
+		t.Errorf("snippet %q", got)
+	}
+}
@@ -0,0 +1,149 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned when a session already has the maximum number of
+// turns waiting
+var ErrBusy = errors.New("session busy")
+
+// Default turn queue limits
+const (
+	DefaultMaxQueuedTurns = 3
+)
+
+// TurnQueue runs conversation turns one at a time per session, in the order
+// they were submitted. Turns in different sessions run concurrently.
+type TurnQueue struct {
+	// MaxPending bounds the turns waiting to run in each session; further
+	// submissions fail with ErrBusy. Zero means unbounded.
+	MaxPending int
+
+	// Coalesce is how long to wait after a message arrives for more from
+	// the same session, merging them into one turn. Zero disables it.
+	Coalesce time.Duration
+
+	mu    sync.Mutex
+	lanes map[string]*lane
+}
+
+type turn struct {
+	text   string
+	run    func(text string)
+	merged func() // Called instead of run when merged into a later turn
+	merge  bool
+}
+
+type lane struct {
+	pending []turn
+}
+
+// NewTurnQueue creates a turn queue
+func NewTurnQueue(maxPending int, coalesce time.Duration) *TurnQueue {
+	return &TurnQueue{
+		MaxPending: maxPending,
+		Coalesce:   coalesce,
+		lanes:      make(map[string]*lane),
+	}
+}
+
+// Submit queues a user message for a session. fn runs once earlier turns in
+// the session have finished. Consecutive queued messages are merged into a
+// single turn when coalescing is enabled: their texts are joined with
+// newlines and only the last submitted fn runs. The others get their merged
+// callback, if set, just before it so they can acknowledge their message.
+func (q *TurnQueue) Submit(sessionID, text string, fn func(text string), merged func()) error {
+	return q.enqueue(sessionID, turn{text: text, run: fn, merged: merged, merge: true})
+}
+
+// Do runs fn as an exclusive turn in a session, waiting for earlier turns to
+// finish first, and returns once fn has completed. It is never merged with
+// other turns.
+func (q *TurnQueue) Do(sessionID string, fn func()) error {
+	done := make(chan struct{})
+	err := q.enqueue(sessionID, turn{run: func(string) {
+		defer close(done)
+		fn()
+	}})
+	if err != nil {
+		return err
+	}
+	<-done
+	return nil
+}
+
+// Pending returns the number of turns waiting in a session
+func (q *TurnQueue) Pending(sessionID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if l, ok := q.lanes[sessionID]; ok {
+		return len(l.pending)
+	}
+	return 0
+}
+
+func (q *TurnQueue) enqueue(sessionID string, t turn) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l, running := q.lanes[sessionID]
+	if running && q.MaxPending > 0 && len(l.pending) >= q.MaxPending {
+		return ErrBusy
+	}
+	if !running {
+		l = &lane{}
+		q.lanes[sessionID] = l
+	}
+	l.pending = append(l.pending, t)
+
+	if !running {
+		go q.work(sessionID, l, q.Coalesce)
+	}
+	return nil
+}
+
+// work drains a session's lane, exiting once it is empty
+func (q *TurnQueue) work(sessionID string, l *lane, coalesce time.Duration) {
+	// Give rapid follow-up messages a chance to arrive
+	q.mu.Lock()
+	wait := coalesce > 0 && l.pending[0].merge
+	q.mu.Unlock()
+	if wait {
+		time.Sleep(coalesce)
+	}
+
+	for {
+		q.mu.Lock()
+		if len(l.pending) == 0 {
+			delete(q.lanes, sessionID)
+			q.mu.Unlock()
+			return
+		}
+
+		n := 1
+		if coalesce > 0 && l.pending[0].merge {
+			for n < len(l.pending) && l.pending[n].merge {
+				n++
+			}
+		}
+		batch := l.pending[:n]
+		l.pending = append([]turn{}, l.pending[n:]...)
+		q.mu.Unlock()
+
+		texts := make([]string, len(batch))
+		for i, t := range batch {
+			texts[i] = t.text
+		}
+		for _, t := range batch[:n-1] {
+			if t.merged != nil {
+				t.merged()
+			}
+		}
+		batch[n-1].run(strings.Join(texts, "\n"))
+	}
+}
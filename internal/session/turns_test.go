@@ -0,0 +1,151 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+func TestTurnsRunInOrder(t *testing.T) {
+	q := NewTurnQueue(0, 0)
+
+	var mu sync.Mutex
+	var got []string
+	var wg sync.WaitGroup
+	for _, text := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		err := q.Submit("s1", text, func(text string) {
+			defer wg.Done()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			got = append(got, text)
+			mu.Unlock()
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Do("s1", func() {
+		mu.Lock()
+		got = append(got, "do")
+		mu.Unlock()
+	})
+	wg.Wait()
+
+	if !equal(got, []string{"a", "b", "c", "d", "do"}) {
+		t.Errorf("ran %q", got)
+	}
+	if n := q.Pending("s1"); n != 0 {
+		t.Errorf("%d turns still pending", n)
+	}
+}
+
+func TestTurnsCoalesce(t *testing.T) {
+	q := NewTurnQueue(0, 50*time.Millisecond)
+
+	done := make(chan string, 3)
+	merged := make(chan int, 3)
+	for i, text := range []string{"one", "two", "three"} {
+		i := i
+		q.Submit("s1", text, func(text string) { done <- text }, func() { merged <- i })
+	}
+
+	select {
+	case text := <-done:
+		if text != "one\ntwo\nthree" {
+			t.Errorf("ran %q", text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("merged turn never ran")
+	}
+	close(merged)
+	var acked []int
+	for i := range merged {
+		acked = append(acked, i)
+	}
+	if len(acked) != 2 || acked[0] != 0 || acked[1] != 1 {
+		t.Errorf("merged callbacks %v, want [0 1]", acked)
+	}
+	select {
+	case text := <-done:
+		t.Errorf("extra turn ran with %q", text)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestTurnsDoIsNotMerged(t *testing.T) {
+	q := NewTurnQueue(0, 20*time.Millisecond)
+
+	release := make(chan struct{})
+	ran := make(chan string, 4)
+	go q.Do("s1", func() { <-release; ran <- "do" })
+	time.Sleep(5 * time.Millisecond)
+	q.Submit("s1", "a", func(text string) { ran <- text }, nil)
+	q.Submit("s1", "b", func(text string) { ran <- text }, nil)
+	close(release)
+
+	if got := <-ran; got != "do" {
+		t.Fatalf("first ran %q", got)
+	}
+	if got := <-ran; got != "a\nb" {
+		t.Errorf("then ran %q, want the merged messages", got)
+	}
+}
+
+func TestTurnsBusy(t *testing.T) {
+	q := NewTurnQueue(2, 0)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q.Submit("s1", "running", func(string) { close(started); <-release }, nil)
+	<-started
+
+	for i := 0; i < 2; i++ {
+		if err := q.Submit("s1", "queued", func(string) {}, nil); err != nil {
+			t.Fatalf("queued turn %d: %v", i, err)
+		}
+	}
+	if err := q.Submit("s1", "over", func(string) {}, nil); !errors.Is(err, ErrBusy) {
+		t.Errorf("got %v, want ErrBusy", err)
+	}
+	if err := q.Do("s1", func() {}); !errors.Is(err, ErrBusy) {
+		t.Errorf("Do got %v, want ErrBusy", err)
+	}
+
+	// Other sessions are independent
+	if err := q.Do("s2", func() {}); err != nil {
+		t.Errorf("other session: %v", err)
+	}
+	close(release)
+}
+
+func TestConfigureTurns(t *testing.T) {
+	tests := []struct {
+		config     configs.SessionsConfig
+		maxPending int
+		coalesce   time.Duration
+	}{
+		{configs.SessionsConfig{}, DefaultMaxQueuedTurns, 0},
+		{configs.SessionsConfig{MaxQueuedTurns: 1, CoalesceWindow: configs.Duration(1500 * time.Millisecond)}, 1, 1500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		m := NewManager()
+		m.Configure(tt.config)
+		if m.Turns.MaxPending != tt.maxPending || m.Turns.Coalesce != tt.coalesce {
+			t.Errorf("%+v: max pending %d, coalesce %v", tt.config, m.Turns.MaxPending, m.Turns.Coalesce)
+		}
+	}
+
+	// Rapid messages are merged once a window is configured
+	m := NewManager()
+	m.Configure(configs.SessionsConfig{CoalesceWindow: configs.Duration(20 * time.Millisecond)})
+	done := make(chan string, 2)
+	m.Turns.Submit("s1", "a", func(text string) { done <- text }, nil)
+	m.Turns.Submit("s1", "b", func(text string) { done <- text }, nil)
+	if got := <-done; got != "a\nb" {
+		t.Errorf("ran %q, want the merged messages", got)
+	}
+}
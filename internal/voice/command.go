@@ -0,0 +1,66 @@
+package voice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// tempFile writes data to a temporary file with name's extension, which
+// tools use to detect the format, and returns its path
+func tempFile(data []byte, name string) (string, error) {
+	f, err := os.CreateTemp("", "hiveclaw-voice-*"+filepath.Ext(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// run runs a command with "{input}" and "{output}" in its arguments
+// replaced by file paths, appending input when no argument names it, and
+// stdin as its standard input. It returns the command's standard output.
+func run(command []string, input, output, stdin string) ([]byte, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no command configured")
+	}
+
+	args := make([]string, 0, len(command))
+	hasInput := false
+	for _, arg := range command[1:] {
+		if strings.Contains(arg, "{input}") {
+			hasInput = true
+		}
+		arg = strings.ReplaceAll(arg, "{input}", input)
+		arg = strings.ReplaceAll(arg, "{output}", output)
+		args = append(args, arg)
+	}
+	if input != "" && !hasInput {
+		args = append(args, input)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
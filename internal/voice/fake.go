@@ -0,0 +1,53 @@
+package voice
+
+import "sync"
+
+// FakeTranscriber is a Transcriber for tests. It returns Text, or Err, and
+// records the files it was given.
+type FakeTranscriber struct {
+	Text string
+	Err  error
+
+	mu    sync.Mutex
+	files []string
+}
+
+// Transcribe records the call and returns the canned answer
+func (f *FakeTranscriber) Transcribe(audio []byte, name, mediaType string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files = append(f.files, name)
+	return f.Text, f.Err
+}
+
+// Files returns the names of the files transcribed so far
+func (f *FakeTranscriber) Files() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.files...)
+}
+
+// FakeSynthesizer is a Synthesizer for tests. It returns Audio as
+// audio/ogg, or Err, and records the texts it was given.
+type FakeSynthesizer struct {
+	Audio []byte
+	Err   error
+
+	mu    sync.Mutex
+	texts []string
+}
+
+// Synthesize records the call and returns the canned audio
+func (f *FakeSynthesizer) Synthesize(text string) ([]byte, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.texts = append(f.texts, text)
+	return f.Audio, "audio/ogg", f.Err
+}
+
+// Texts returns the texts synthesized so far
+func (f *FakeSynthesizer) Texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.texts...)
+}
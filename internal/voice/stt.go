@@ -0,0 +1,155 @@
+// Package voice turns voice messages into text and back. Engines are
+// pluggable: an HTTP API or a local command.
+package voice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+// Transcriber converts speech to text
+type Transcriber interface {
+	// Transcribe returns the text spoken in an audio file. name and
+	// mediaType describe the file, e.g. voice.ogg and audio/ogg.
+	Transcribe(audio []byte, name, mediaType string) (string, error)
+}
+
+// STT providers
+const (
+	STTWhisper = "whisper"
+	STTCommand = "command"
+)
+
+// Defaults for the Whisper API
+const (
+	DefaultWhisperURL   = "https://api.openai.com/v1/audio/transcriptions"
+	DefaultWhisperModel = "whisper-1"
+)
+
+const requestTimeout = 2 * time.Minute
+
+// NewTranscriber creates the transcriber a config selects. It returns nil
+// when none is configured.
+func NewTranscriber(cfg configs.STTConfig) (Transcriber, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case STTWhisper:
+		w := NewWhisper(cfg.URL, cfg.APIKey, cfg.Model)
+		w.Language = cfg.Language
+		return w, nil
+	case STTCommand:
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("stt: command provider needs a command")
+		}
+		return &CommandTranscriber{Command: cfg.Command}, nil
+	}
+	return nil, fmt.Errorf("stt: unknown provider %q", cfg.Provider)
+}
+
+// Whisper transcribes with an OpenAI-compatible /audio/transcriptions
+// endpoint, such as OpenAI's, Groq's or a whisper.cpp server
+type Whisper struct {
+	URL      string
+	APIKey   string
+	Model    string
+	Language string // Optional ISO-639-1 hint
+}
+
+// NewWhisper creates a Whisper transcriber. Empty arguments take the
+// OpenAI defaults, with the key from OPENAI_API_KEY.
+func NewWhisper(url, apiKey, model string) *Whisper {
+	if url == "" {
+		url = DefaultWhisperURL
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if model == "" {
+		model = DefaultWhisperModel
+	}
+	return &Whisper{URL: url, APIKey: apiKey, Model: model}
+}
+
+// Transcribe uploads the audio and returns the transcript
+func (w *Whisper) Transcribe(audio []byte, name, mediaType string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", name)
+	if err != nil {
+		return "", err
+	}
+	file.Write(audio)
+	form.WriteField("model", w.Model)
+	form.WriteField("response_format", "json")
+	if w.Language != "" {
+		form.WriteField("language", w.Language)
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", w.URL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if w.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+w.APIKey)
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription API error (%d): %s", resp.StatusCode, string(data))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
+
+// CommandTranscriber runs a local program, such as a whisper.cpp script,
+// on the audio file and reads the transcript from its output
+type CommandTranscriber struct {
+	// Command is the program and its arguments. "{input}" is replaced by
+	// the audio file's path, which is appended when no argument has it.
+	Command []string
+}
+
+// Transcribe writes the audio to a temporary file and runs the command
+func (c *CommandTranscriber) Transcribe(audio []byte, name, mediaType string) (string, error) {
+	input, err := tempFile(audio, name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(input)
+
+	out, err := run(c.Command, input, "", "")
+	if err != nil {
+		return "", fmt.Errorf("transcription command failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,63 @@
+package voice
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+func TestWhisper(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		if header.Filename != "voice.ogg" || string(data) != "audio" {
+			t.Errorf("file %s = %q", header.Filename, data)
+		}
+		if r.FormValue("model") != "whisper-1" || r.FormValue("language") != "de" {
+			t.Errorf("form = %v", r.Form)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"text": " Guten Tag \n"})
+	}))
+	defer srv.Close()
+
+	stt, err := NewTranscriber(configs.STTConfig{Provider: STTWhisper, URL: srv.URL, APIKey: "key", Language: "de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := stt.Transcribe([]byte("audio"), "voice.ogg", "audio/ogg")
+	if err != nil || text != "Guten Tag" {
+		t.Errorf("Transcribe() = %q, %v", text, err)
+	}
+}
+
+func TestCommandTranscriber(t *testing.T) {
+	if _, err := exec.LookPath("cat"); err != nil {
+		t.Skip("no cat")
+	}
+
+	// cat "transcribes" by printing the file back
+	stt, err := NewTranscriber(configs.STTConfig{Provider: STTCommand, Command: []string{"cat", "{input}"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := stt.Transcribe([]byte("hello there\n"), "voice.ogg", "audio/ogg")
+	if err != nil || text != "hello there" {
+		t.Errorf("Transcribe() = %q, %v", text, err)
+	}
+
+	if _, err := NewTranscriber(configs.STTConfig{Provider: "nope"}); err == nil {
+		t.Errorf("accepted an unknown provider")
+	}
+}
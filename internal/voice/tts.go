@@ -0,0 +1,200 @@
+package voice
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nanilabs/hiveclaw/configs"
+)
+
+// Synthesizer converts text to speech
+type Synthesizer interface {
+	// Synthesize returns spoken audio for text and its media type, e.g.
+	// audio/ogg
+	Synthesize(text string) ([]byte, string, error)
+}
+
+// TTS providers
+const (
+	TTSOpenAI  = "openai"
+	TTSCommand = "command"
+)
+
+// Defaults for the OpenAI speech API
+const (
+	DefaultSpeechURL   = "https://api.openai.com/v1/audio/speech"
+	DefaultSpeechModel = "tts-1"
+	DefaultSpeechVoice = "alloy"
+)
+
+// DefaultMaxSpokenChars is the longest answer spoken by default
+const DefaultMaxSpokenChars = 800
+
+// NewSynthesizer creates the synthesizer a config selects. It returns nil
+// when none is configured.
+func NewSynthesizer(cfg configs.TTSConfig) (Synthesizer, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case TTSOpenAI:
+		return NewSpeech(cfg.URL, cfg.APIKey, cfg.Model, cfg.Voice), nil
+	case TTSCommand:
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("tts: command provider needs a command")
+		}
+		return &CommandSynthesizer{Command: cfg.Command, MediaType: cfg.MediaType}, nil
+	}
+	return nil, fmt.Errorf("tts: unknown provider %q", cfg.Provider)
+}
+
+// Speech synthesizes with an OpenAI-compatible /audio/speech endpoint. It
+// asks for Opus in Ogg, the format of Telegram voice notes.
+type Speech struct {
+	URL    string
+	APIKey string
+	Model  string
+	Voice  string
+}
+
+// NewSpeech creates a speech synthesizer. Empty arguments take the OpenAI
+// defaults, with the key from OPENAI_API_KEY.
+func NewSpeech(url, apiKey, model, voice string) *Speech {
+	if url == "" {
+		url = DefaultSpeechURL
+	}
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if model == "" {
+		model = DefaultSpeechModel
+	}
+	if voice == "" {
+		voice = DefaultSpeechVoice
+	}
+	return &Speech{URL: url, APIKey: apiKey, Model: model, Voice: voice}
+}
+
+// Synthesize requests speech for text
+func (s *Speech) Synthesize(text string) ([]byte, string, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           s.Model,
+		"input":           text,
+		"voice":           s.Voice,
+		"response_format": "opus",
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	client := &http.Client{Timeout: requestTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("speech request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("speech API error (%d): %s", resp.StatusCode, string(audio))
+	}
+	return audio, "audio/ogg", nil
+}
+
+// CommandSynthesizer runs a local program such as piper. The text is
+// written to its standard input; the audio is read from "{output}" when an
+// argument names it and from its standard output otherwise.
+type CommandSynthesizer struct {
+	Command   []string
+	MediaType string // Format the command writes; default audio/ogg
+}
+
+// Synthesize runs the command on text
+func (c *CommandSynthesizer) Synthesize(text string) ([]byte, string, error) {
+	mediaType := c.MediaType
+	if mediaType == "" {
+		mediaType = "audio/ogg"
+	}
+
+	output, err := tempFile(nil, "speech")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(output)
+
+	audio, err := run(c.Command, "", output, text)
+	if err != nil {
+		return nil, "", fmt.Errorf("speech command failed: %w", err)
+	}
+	if len(audio) == 0 {
+		if audio, err = os.ReadFile(output); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(audio) == 0 {
+		return nil, "", fmt.Errorf("speech command produced no audio")
+	}
+	return audio, mediaType, nil
+}
+
+var (
+	inlineCode = regexp.MustCompile("`[^`\n]+`")
+	link       = regexp.MustCompile(`\[([^\]]+)\]\([^)]+\)`)
+	heading    = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	bullet     = regexp.MustCompile(`(?m)^\s*[-*+]\s+`)
+	emphasis   = regexp.MustCompile(`[*_~]{1,3}`)
+	bareURL    = regexp.MustCompile(`https?://\S+`)
+)
+
+// Speakable reports whether an answer suits a voice note: short enough,
+// and not mostly code, tables or links
+func Speakable(text string, maxChars int) bool {
+	if maxChars <= 0 {
+		maxChars = DefaultMaxSpokenChars
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > maxChars {
+		return false
+	}
+	if strings.Contains(text, "```") || strings.Contains(text, "\n|") {
+		return false
+	}
+
+	// A little inline code reads fine; a lot doesn't
+	code := 0
+	for _, m := range inlineCode.FindAllString(text, -1) {
+		code += len(m)
+	}
+	for _, m := range bareURL.FindAllString(text, -1) {
+		code += len(m)
+	}
+	return code*4 < len(text)
+}
+
+// SpokenText strips markdown from an answer so it reads naturally aloud
+func SpokenText(text string) string {
+	text = link.ReplaceAllString(text, "$1")
+	text = heading.ReplaceAllString(text, "")
+	text = bullet.ReplaceAllString(text, "")
+	text = strings.ReplaceAll(text, "`", "")
+	text = emphasis.ReplaceAllString(text, "")
+	return strings.TrimSpace(text)
+}